@@ -0,0 +1,237 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// embeddedAccountsJSON is the accounts response with virtual accounts and licenses included inline.
+const embeddedAccountsJSON = `{"accounts": [{
+	"accountDomain": "example.com", "accountName": "Example", "accountStatus": "ACTIVE", "accountType": "CUSTOMER",
+	"roles": [{"role": "SMART_ACCOUNT_ADMIN"}],
+	"virtualAccounts": [{"name": "VA1", "isDefault": "Yes"}],
+	"licenses": [{"license": "L1", "virtualAccount": "VA1", "quantity": 10, "inUse": 4, "available": 6}]
+}], "status": "SUCCESS"}`
+
+func TestGetAllSmartAccounts(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if want := "/services/api/smart-accounts-and-licensing/v2/accounts"; r.URL.Path != want || r.URL.RawQuery != "" {
+			t.Errorf("got %s?%s, want %s", r.URL.Path, r.URL.RawQuery, want)
+		}
+		w.Write([]byte(`{"accounts": [{"accountDomain": "example.com", "accountName": "Example"}], "status": "SUCCESS"}`))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	got, err := c.GetAllSmartAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []SmartAccount{{AccountDomain: "example.com", AccountName: "Example"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetAllSmartAccountsV1(t *testing.T) {
+	// the v1 response may be the v2 shape, an object with just the accounts, or a bare array
+	for _, body := range []string{
+		`{"accounts": [{"accountDomain": "example.com", "accountName": "Example"}], "status": "SUCCESS"}`,
+		`{"accounts": [{"accountDomain": "example.com", "accountName": "Example"}]}`,
+		`[{"accountDomain": "example.com", "accountName": "Example"}]`,
+	} {
+		h := func(w http.ResponseWriter, r *http.Request) {
+			if want := "/services/api/smart-accounts-and-licensing/v1/accounts"; r.URL.Path != want || r.URL.RawQuery != "" {
+				t.Errorf("got %s?%s, want %s", r.URL.Path, r.URL.RawQuery, want)
+			}
+			w.Write([]byte(body))
+		}
+		c := newTestClient(t, http.HandlerFunc(h), WithAccountsAPIVersion(AccountsAPIV1))
+		got, err := c.GetAllSmartAccounts()
+		if err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if want := []SmartAccount{{AccountDomain: "example.com", AccountName: "Example"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", body, got, want)
+		}
+	}
+}
+
+func TestGetAllSmartAccountsWithV1(t *testing.T) {
+	// v1 can't include virtual accounts inline, so they are always retrieved with follow up requests
+	vas := virtualAccountsHandler(t, map[string][]VirtualAccount{"example.com": {{Name: "VA1"}}})
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/services/api/smart-accounts-and-licensing/v1/accounts" {
+			if r.URL.RawQuery != "" {
+				t.Errorf("got query %q for v1, want none", r.URL.RawQuery)
+			}
+			w.Write([]byte(`[{"accountDomain": "example.com"}]`))
+			return
+		}
+		vas(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithAccountsAPIVersion(AccountsAPIV1))
+	got, err := c.GetAllSmartAccountsWith(context.Background(), AccountsRequest{IncludeVirtualAccounts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].VirtualAccounts == nil || len(*got[0].VirtualAccounts) != 1 || (*got[0].VirtualAccounts)[0].Name != "VA1" {
+		t.Errorf("got %+v, want example.com with VA1", got)
+	}
+}
+
+func TestGetAllSmartAccountsWithEmbedded(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		if r.URL.Path != endpointAccounts.path {
+			t.Errorf("got a follow up request to %s, want none", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("includeVirtualAccounts") != "true" || q.Get("includeLicenses") != "true" {
+			t.Errorf("got query %q, want both includes", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(embeddedAccountsJSON))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	accounts, err := c.GetAllSmartAccountsWith(context.Background(), AccountsRequest{IncludeVirtualAccounts: true, IncludeLicenses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].VirtualAccounts == nil || accounts[0].Licenses == nil {
+		t.Fatalf("got %+v, want one account with virtual accounts and licenses", accounts)
+	}
+	if vas := *accounts[0].VirtualAccounts; len(vas) != 1 || vas[0].Name != "VA1" {
+		t.Errorf("got virtual accounts %+v, want VA1", vas)
+	}
+	want := []License{{License: "L1", VirtualAccount: "VA1", Quantity: 10, InUse: 4, Available: 6}}
+	if got := *accounts[0].Licenses; !reflect.DeepEqual(got, want) {
+		t.Errorf("got licenses %+v, want %+v", got, want)
+	}
+	if calls.get() != 1 {
+		t.Errorf("got %d requests, want 1", calls.get())
+	}
+}
+
+func TestGetAllSmartAccountsWithFallback(t *testing.T) {
+	f := &fakeCisco{
+		accounts: []SmartAccount{{AccountDomain: "a.com"}, {AccountDomain: "b.com"}},
+		vas:      map[string][]VirtualAccount{"a.com": {{Name: "VA1"}}, "b.com": {{Name: "VA2"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 2), "VA2": makeLicenses("VA2", 1)},
+	}
+	c := newTestClient(t, f.handler(t))
+
+	accounts, err := c.GetAllSmartAccountsWith(context.Background(), AccountsRequest{IncludeVirtualAccounts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sa := range accounts {
+		if sa.VirtualAccounts == nil || len(*sa.VirtualAccounts) != 1 || sa.Licenses != nil {
+			t.Errorf("%s: got %+v, want only its virtual accounts", sa.AccountDomain, sa)
+		}
+	}
+
+	accounts, err = c.GetAllSmartAccountsWith(context.Background(), AccountsRequest{IncludeLicenses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Licenses == nil || accounts[1].Licenses == nil {
+		t.Fatalf("got %+v, want licenses for both accounts", accounts)
+	}
+	if !reflect.DeepEqual(*accounts[0].Licenses, f.licenses["VA1"]) || !reflect.DeepEqual(*accounts[1].Licenses, f.licenses["VA2"]) {
+		t.Errorf("got licenses %v and %v", *accounts[0].Licenses, *accounts[1].Licenses)
+	}
+}
+
+func TestGetAllSmartAccountsWithConcurrency(t *testing.T) {
+	f := &fakeCisco{vas: map[string][]VirtualAccount{}}
+	for i := 0; i < 8; i++ {
+		domain := fmt.Sprintf("%d.com", i)
+		f.accounts = append(f.accounts, SmartAccount{AccountDomain: domain})
+		f.vas[domain] = []VirtualAccount{{Name: "VA" + domain}}
+	}
+	fake := f.handler(t)
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/virtual-accounts") {
+			fake(w, r)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		fake(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithConcurrency(3))
+	accounts, err := c.GetAllSmartAccountsWith(context.Background(), AccountsRequest{IncludeVirtualAccounts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sa := range accounts {
+		if sa.VirtualAccounts == nil || (*sa.VirtualAccounts)[0].Name != "VA"+sa.AccountDomain {
+			t.Errorf("%s: got %+v, want its virtual account", sa.AccountDomain, sa.VirtualAccounts)
+		}
+	}
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("got %d requests at once, want 2 or 3", maxInFlight)
+	}
+}
+
+func TestGetAccountLicenseRows(t *testing.T) {
+	f := &fakeCisco{
+		accounts: []SmartAccount{{AccountDomain: "a.com", AccountName: "A"}, {AccountDomain: "b.com", AccountName: "B"}, {AccountDomain: "c.com"}},
+		vas: map[string][]VirtualAccount{
+			"a.com": {{Name: "VA1"}, {Name: "VA2"}},
+			"b.com": {{Name: "VA3"}, {Name: "broken"}, {Name: "half"}},
+		},
+		licenses: map[string][]License{
+			"VA1":  makeLicenses("VA1", 2),
+			"VA2":  makeLicenses("VA2", 1),
+			"VA3":  makeLicenses("VA3", 1),
+			"half": makeLicenses("half", 150),
+		},
+		failAfterFirstPage: map[string]bool{"half": true},
+	}
+	c := newTestClient(t, f.handler(t))
+	rows, err := c.GetAccountLicenseRows(context.Background())
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a *PartialError", err)
+	}
+	if len(pe.Failures) != 3 || !errors.Is(pe.Failures["b.com/broken"], ErrInternalError) || !errors.Is(pe.Failures["b.com/half"], ErrInternalError) || !errors.Is(pe.Failures["c.com"], ErrInternalError) {
+		t.Errorf("got failures %v, want b.com/broken, b.com/half and c.com", pe.Failures)
+	}
+	if msg := err.Error(); strings.Count(msg, "GetAccountLicenseRows") != 1 || strings.Contains(msg, "GetAllSmartAccountsWith") {
+		t.Errorf("got %q, want it labelled once with GetAccountLicenseRows", msg)
+	}
+
+	// the rows match the nested licenses, leaving out the virtual account that was only partly retrieved
+	var want []AccountLicenseRow
+	for _, sa := range []struct{ domain, name, va string }{{"a.com", "A", "VA1"}, {"a.com", "A", "VA2"}, {"b.com", "B", "VA3"}} {
+		for _, l := range f.licenses[sa.va] {
+			want = append(want, AccountLicenseRow{
+				AccountDomain: sa.domain, AccountName: sa.name, VirtualAccount: sa.va, License: l.License,
+				Quantity: l.Quantity, InUse: l.InUse, Available: l.Available,
+			})
+		}
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got rows %+v, want %+v", rows, want)
+	}
+	if !reflect.DeepEqual(pe.Result, rows) {
+		t.Errorf("got partial result %v, want the rows", pe.Result)
+	}
+}
@@ -0,0 +1,56 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// AccountsAPIVersion selects the version of the Cisco accounts endpoint used by GetAllSmartAccounts.
+type AccountsAPIVersion int
+
+const (
+	// AccountsAPIV2 uses /v2/accounts, which is the default.
+	AccountsAPIV2 AccountsAPIVersion = iota
+	// AccountsAPIV1 uses /v1/accounts.  The v1 response isn't documented alongside v2, so it is decoded leniently,
+	// accepting either the v2 shape, an object with an accounts field, or a bare array of accounts.  The v1
+	// endpoint doesn't support including virtual accounts or licenses inline, so GetAllSmartAccountsWith always
+	// retrieves those with follow up requests.
+	AccountsAPIV1
+)
+
+// WithAccountsAPIVersion sets the version of the accounts endpoint used by GetAllSmartAccounts and
+// GetAllSmartAccountsWith.  The default is AccountsAPIV2.
+func WithAccountsAPIVersion(v AccountsAPIVersion) Option {
+	return func(c *Client) {
+		c.accountsVersion = v
+	}
+}
+
+// accountsV1Response decodes the response from the v1 accounts endpoint.
+type accountsV1Response struct {
+	SmartAccountResponse
+}
+
+func (r *accountsV1Response) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		return json.Unmarshal(b, &r.Accounts)
+	}
+	return json.Unmarshal(b, &r.SmartAccountResponse)
+}
+
+func (c *Client) getSmartAccountsV1(ctx context.Context) ([]SmartAccount, error) {
+	req, err := c.newRequest(endpointAccountsV1, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var sar accountsV1Response
+	err = c.makeCachedRequest(ctx, req, &sar)
+	if c.emptyOn404(err) {
+		return []SmartAccount{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sar.Accounts, nil
+}
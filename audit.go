@@ -0,0 +1,130 @@
+package smartaccounts
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditReport represents a consolidated view of all the smart accounts the user has access to.
+type AuditReport struct {
+	GeneratedAt time.Time
+	Accounts    []AuditAccount
+}
+
+// AuditAccount represents the audit detail for a single smart account.  Subscriptions are only populated when the
+// smart account ID could be found by searching on the domain.
+type AuditAccount struct {
+	Account         SmartAccount
+	Roles           []string
+	VirtualAccounts []VirtualAccount
+	LicenseTotals   LicenseTotals
+	Subscriptions   []SubscriptionSearchSubscription
+}
+
+// LicenseTotals represents the summed quantities across a set of licenses.
+type LicenseTotals struct {
+	Licenses        int
+	Quantity        int
+	InUse           int
+	Available       int
+	Reserved        int
+	PendingQuantity int
+}
+
+// Add includes the quantities of the license in the totals.
+func (t *LicenseTotals) Add(l License) {
+	t.Licenses++
+	t.Quantity += l.Quantity
+	t.InUse += l.InUse
+	t.Available += l.Available
+	t.Reserved += l.Reserved
+	t.PendingQuantity += l.PendingQuantity
+}
+
+// GenerateAuditReport retrieves all the smart accounts the user has access to, along with their virtual accounts,
+// license totals and subscriptions, concurrently for each account.  Failures for individual accounts don't stop the
+// report being generated, instead they are returned as a *PartialError keyed by "domain: step" along with the report.
+func (c *Client) GenerateAuditReport(ctx context.Context) (_ *AuditReport, err error) {
+	defer wrapOp(&err, "GenerateAuditReport")
+	ctx, cancel := c.methodContext(ctx, "GenerateAuditReport")
+	defer cancel()
+	accounts, err := c.getAllSmartAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &AuditReport{GeneratedAt: time.Now().UTC(), Accounts: make([]AuditAccount, len(accounts))}
+	errs := map[string]error{}
+	var mu sync.Mutex
+	fail := func(domain, step string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[domain+": "+step] = err
+	}
+	for i, sa := range accounts {
+		report.Accounts[i].Account = sa
+		report.Accounts[i].Roles = RolesByDomain([]SmartAccount{sa})[sa.AccountDomain]
+	}
+	skipped := runBounded(ctx, len(accounts), c.concurrency, func(i int) error {
+		c.auditAccount(ctx, &report.Accounts[i], fail)
+		return nil
+	})
+	for i, err := range skipped {
+		if err != nil {
+			fail(accounts[i].AccountDomain, "accounts", err)
+		}
+	}
+	if len(errs) > 0 {
+		return report, &PartialError{Result: report, Failures: errs}
+	}
+	return report, nil
+}
+
+// auditAccount populates the virtual accounts, license totals and subscriptions for the account.
+func (c *Client) auditAccount(ctx context.Context, aa *AuditAccount, fail func(domain, step string, err error)) {
+	domain := aa.Account.AccountDomain
+	vas, err := c.getVirtualAccounts(ctx, domain)
+	if err != nil {
+		fail(domain, "virtual accounts", err)
+	}
+	aa.VirtualAccounts = vas
+	for _, va := range vas {
+		err := c.eachLicensePage(ctx, domain, va.Name, func(lr *LicenseResponse) error {
+			for _, l := range lr.Licenses {
+				aa.LicenseTotals.Add(l)
+			}
+			return nil
+		})
+		if err != nil {
+			fail(domain, "licenses "+va.Name, err)
+		}
+	}
+	sr, err := c.searchSmartAccountsByDomain(ctx, domain)
+	if err != nil {
+		fail(domain, "search", err)
+		return
+	}
+	sa, ok := findSearchAccount(sr, domain)
+	if !ok {
+		return
+	}
+	ssr, err := c.searchSubscriptions(ctx, sa.ID, domain)
+	if err != nil {
+		fail(domain, "subscriptions", err)
+		return
+	}
+	for _, od := range ssr.OfferDetails {
+		aa.Subscriptions = append(aa.Subscriptions, od.Subscriptions...)
+	}
+}
+
+// findSearchAccount returns the account from the search results whose domain exactly matches, ignoring case.
+func findSearchAccount(sr *SearchResponse, domain string) (SearchAccount, bool) {
+	for _, a := range sr.Accounts {
+		if strings.EqualFold(a.Domain, domain) {
+			return a, true
+		}
+	}
+	return SearchAccount{}, false
+}
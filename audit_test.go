@@ -0,0 +1,63 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateAuditReport(t *testing.T) {
+	f := &fakeCisco{
+		accounts: []SmartAccount{
+			{AccountDomain: "a.com", AccountName: "A", Roles: []Role{{Role: "SMART_ACCOUNT_ADMIN"}}},
+			{AccountDomain: "b.com", AccountName: "B"},
+			{AccountDomain: "c.com", AccountName: "C"},
+		},
+		search: []SearchAccount{{Domain: "a.com", ID: 1}, {Domain: "b.com", ID: 2}},
+		vas: map[string][]VirtualAccount{
+			"a.com": {{Name: "VA1"}, {Name: "VA2"}},
+			"b.com": {{Name: "VA3"}, {Name: "broken"}},
+		},
+		licenses: map[string][]License{
+			"VA1": makeLicenses("VA1", 3),
+			"VA2": makeLicenses("VA2", 2),
+			"VA3": makeLicenses("VA3", 1),
+		},
+		subscriptions: map[int][]SubscriptionSearchSubscription{1: {{SubRefID: "Sub-1"}}},
+	}
+	c := newTestClient(t, f.handler(t), WithConcurrency(2))
+	report, err := c.GenerateAuditReport(context.Background())
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a *PartialError", err)
+	}
+	if len(pe.Failures) != 2 || pe.Failures["b.com: licenses broken"] == nil || pe.Failures["c.com: virtual accounts"] == nil {
+		t.Errorf("got failures %v, want b.com licenses and c.com virtual accounts", pe.Failures)
+	}
+	if len(report.Accounts) != 3 || report.GeneratedAt.IsZero() {
+		t.Fatalf("got %+v, want three accounts", report)
+	}
+
+	a := report.Accounts[0]
+	if !reflect.DeepEqual(a.Roles, []string{"SMART_ACCOUNT_ADMIN"}) || len(a.VirtualAccounts) != 2 {
+		t.Errorf("a.com: got roles %v and %d virtual accounts", a.Roles, len(a.VirtualAccounts))
+	}
+	if want := (LicenseTotals{Licenses: 5, Quantity: 50, InUse: 4, Available: 46}); a.LicenseTotals != want {
+		t.Errorf("a.com: got totals %+v, want %+v", a.LicenseTotals, want)
+	}
+	if len(a.Subscriptions) != 1 || a.Subscriptions[0].SubRefID != "Sub-1" {
+		t.Errorf("a.com: got subscriptions %v, want Sub-1", a.Subscriptions)
+	}
+
+	b := report.Accounts[1]
+	if want := (LicenseTotals{Licenses: 1, Quantity: 10, Available: 10}); b.LicenseTotals != want {
+		t.Errorf("b.com: got totals %+v, want only VA3's %+v", b.LicenseTotals, want)
+	}
+	if len(b.Subscriptions) != 0 {
+		t.Errorf("b.com: got subscriptions %v, want none", b.Subscriptions)
+	}
+	if c := report.Accounts[2]; c.Account.AccountDomain != "c.com" || c.VirtualAccounts != nil {
+		t.Errorf("c.com: got %+v, want no virtual accounts", c)
+	}
+}
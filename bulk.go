@@ -0,0 +1,214 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PartialError is returned by the bulk methods when some, but not necessarily all, of the underlying requests
+// fail.  Failures holds the error for each failed item, keyed by e.g. domain or virtual account name.  Result holds
+// the data that was successfully collected, which is the same value returned alongside the error, so callers can
+// choose to use the partial data either way:
+//
+//	vas, err := c.GetVirtualAccountsForDomains(ctx, domains)
+//	var pe *smartaccounts.PartialError
+//	if errors.As(err, &pe) {
+//		// vas (and pe.Result) hold the successful domains, pe.Failures the rest
+//	}
+type PartialError struct {
+	Result   interface{}
+	Failures map[string]error
+}
+
+func (e *PartialError) Error() string {
+	keys := make([]string, 0, len(e.Failures))
+	for k := range e.Failures {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", k, e.Failures[k]))
+	}
+	return fmt.Sprintf("ccw: %d request(s) failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// GetVirtualAccountsForDomains retrieves the virtual accounts for each of the provided domains concurrently.  The
+// results are keyed by domain.  Should any domain fail, the error returned will be a *PartialError containing the
+// error for each failed domain, and the results for the successful domains are still returned.
+func (c *Client) GetVirtualAccountsForDomains(ctx context.Context, domains []string) (_ map[string][]VirtualAccount, err error) {
+	defer wrapOp(&err, "GetVirtualAccountsForDomains")
+	ctx, cancel := c.methodContext(ctx, "GetVirtualAccountsForDomains")
+	defer cancel()
+	found := make([][]VirtualAccount, len(domains))
+	failed := runBounded(ctx, len(domains), c.concurrency, func(i int) (err error) {
+		found[i], err = c.getVirtualAccounts(ctx, domains[i])
+		return err
+	})
+	results := map[string][]VirtualAccount{}
+	errs := map[string]error{}
+	for i, domain := range domains {
+		if failed[i] != nil {
+			errs[domain] = failed[i]
+			continue
+		}
+		results[domain] = found[i]
+	}
+	if len(errs) > 0 {
+		return results, &PartialError{Result: results, Failures: errs}
+	}
+	return results, nil
+}
+
+// EASubscriptionRef identifies an EA subscription within a smart account domain.
+type EASubscriptionRef struct {
+	Domain         string
+	SubscriptionID string
+}
+
+func (r EASubscriptionRef) String() string {
+	return r.Domain + "/" + r.SubscriptionID
+}
+
+// EAPortfolioReport represents the EA Consumption Reports for a number of subscriptions along with a
+// summary across all of them.
+type EAPortfolioReport struct {
+	Reports map[EASubscriptionRef]*EASmartAccountSubscriptionConsumptionReportResponse
+	Summary EAConsumptionSummary
+}
+
+// GetEAPortfolioConsumption retrieves the EA Consumption Report for each of the provided subscriptions concurrently
+// and combines them into a single EAPortfolioReport.  Subscriptions for which Cisco reports no valid subscriptions
+// are skipped.  Should any other request fail, the error returned will be a *PartialError keyed by "domain/subscription"
+// and the report for the successful subscriptions is still returned.
+func (c *Client) GetEAPortfolioConsumption(ctx context.Context, refs []EASubscriptionRef) (_ *EAPortfolioReport, err error) {
+	defer wrapOp(&err, "GetEAPortfolioConsumption")
+	ctx, cancel := c.methodContext(ctx, "GetEAPortfolioConsumption")
+	defer cancel()
+	ears := make([]*EASmartAccountSubscriptionConsumptionReportResponse, len(refs))
+	failed := runBounded(ctx, len(refs), c.concurrency, func(i int) (err error) {
+		ears[i], err = c.getEAConsumptionReport(ctx, refs[i].Domain, refs[i].SubscriptionID)
+		return err
+	})
+	report := &EAPortfolioReport{Reports: map[EASubscriptionRef]*EASmartAccountSubscriptionConsumptionReportResponse{}}
+	errs := map[string]error{}
+	for i, ref := range refs {
+		if failed[i] != nil {
+			if !errors.Is(failed[i], ErrNoSubscriptions) {
+				errs[ref.String()] = failed[i]
+			}
+			continue
+		}
+		report.Reports[ref] = ears[i]
+		report.Summary.add(ears[i])
+	}
+	if len(errs) > 0 {
+		return report, &PartialError{Result: report, Failures: errs}
+	}
+	return report, nil
+}
+
+// EAReportProgress is called by GetEAConsumptionReports each time a report has been retrieved or has failed, with
+// the number completed so far and the total.  Reports not requested because the context was done count as failed,
+// so the last call is always with completed equal to total.  Calls are not made concurrently.
+type EAReportProgress func(completed, total int)
+
+// GetEAConsumptionReports retrieves the EA Consumption Report for each of the provided subscriptions, with at most
+// maxInFlight requests outstanding at once (or the WithConcurrency setting if maxInFlight is 0 or less).  Every
+// request is subject to the client's rate limiter and, when the limiter is set to RateLimitFail, requests refused by
+// the limiter are rescheduled once it allows them rather than failing.  The reports are keyed by subscription and, as
+// with the other bulk methods, should any request fail the error returned will be a *PartialError keyed by
+// "domain/subscription" and the successful reports are still returned.  The progress callback may be nil.
+func (c *Client) GetEAConsumptionReports(ctx context.Context, refs []EASubscriptionRef, maxInFlight int, progress EAReportProgress) (_ map[EASubscriptionRef]*EASmartAccountSubscriptionConsumptionReportResponse, err error) {
+	defer wrapOp(&err, "GetEAConsumptionReports")
+	ctx, cancel := c.methodContext(ctx, "GetEAConsumptionReports")
+	defer cancel()
+	if maxInFlight <= 0 {
+		maxInFlight = c.concurrency
+	}
+	ears := make([]*EASmartAccountSubscriptionConsumptionReportResponse, len(refs))
+	completed := 0
+	var mu sync.Mutex
+	done := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		completed++
+		if progress != nil {
+			progress(completed, len(refs))
+		}
+	}
+	failed := runBounded(ctx, len(refs), maxInFlight, func(i int) (err error) {
+		defer done()
+		for {
+			ears[i], err = c.getEAConsumptionReport(ctx, refs[i].Domain, refs[i].SubscriptionID)
+			if !errors.Is(err, ErrRateLimited) || c.waitForLimiter(ctx) != nil {
+				return err
+			}
+		}
+	})
+	// those never started because the context was done are complete too, having failed with the context error
+	for completed < len(refs) {
+		done()
+	}
+	reports := map[EASubscriptionRef]*EASmartAccountSubscriptionConsumptionReportResponse{}
+	errs := map[string]error{}
+	for i, ref := range refs {
+		if failed[i] != nil {
+			errs[ref.String()] = failed[i]
+			continue
+		}
+		reports[ref] = ears[i]
+	}
+	if len(errs) > 0 {
+		return reports, &PartialError{Result: reports, Failures: errs}
+	}
+	return reports, nil
+}
+
+// waitForLimiter waits until the rate limiter would allow a request, without taking the token itself so that the
+// request can.
+func (c *Client) waitForLimiter(ctx context.Context) error {
+	r := c.lim.Reserve()
+	if !r.OK() {
+		return ErrRateLimited
+	}
+	d := r.Delay()
+	r.Cancel()
+	return sleepContext(ctx, d)
+}
+
+// runBounded calls fn for each index from 0 to n-1, with at most limit calls running at once, and returns the error
+// from each call indexed in the same way.  Once ctx is done no further calls are started and the remaining indexes
+// are given the context error instead.  fn may safely write to its own index of a slice without further locking.
+func runBounded(ctx context.Context, n, limit int, fn func(i int) error) []error {
+	if limit <= 0 {
+		limit = defaultConcurrency
+	}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,331 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// eaReport returns an EA Consumption Report for a subscription with a single suite.
+func eaReport(sub string, purchased, consumed int) *EASmartAccountSubscriptionConsumptionReportResponse {
+	suite := EASuite{SuiteName: "DNA Advantage", PurchasedEntitlements: purchased, TotalEntitlements: purchased, TotalConsumption: consumed, RemainingEntitlements: purchased - consumed}
+	return &EASmartAccountSubscriptionConsumptionReportResponse{Subscriptions: []EASubscription{{
+		SubscriptionID: sub,
+		Status:         "ACTIVE",
+		Accounts:       []EAAccount{{VirtualAccounts: []EAVirtualAccount{{VirtualAccountName: "VA1", Suites: []EASuite{suite}}}}},
+	}}}
+}
+
+// eaReportHandler responds to EA Consumption Report requests with the report for "domain/subscription".  Those
+// not in the map receive the 400 Cisco sends when there are no subscriptions, unless the subscription is "broken",
+// which fails with a 500.
+func eaReportHandler(t testing.TB, reports map[string]*EASmartAccountSubscriptionConsumptionReportResponse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// .../subscription/account/{domain}/subscription/{subscription}/consumption
+		parts := strings.Split(r.URL.Path, "/")
+		if len(parts) < 5 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		domain, sub := parts[len(parts)-4], parts[len(parts)-2]
+		if report, ok := reports[domain+"/"+sub]; ok {
+			writeJSON(t, w, report)
+			return
+		}
+		if sub == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":400001,"message":"No Valid Subscriptions found","severity":"ERROR"}`))
+	}
+}
+
+func TestGetVirtualAccountsForDomains(t *testing.T) {
+	vas := map[string][]VirtualAccount{
+		"a.com": {{Name: "A1"}, {Name: "A2"}},
+		"b.com": {{Name: "B1"}},
+		"c.com": {},
+	}
+	c := newTestClient(t, virtualAccountsHandler(t, vas), WithConcurrency(2))
+	got, err := c.GetVirtualAccountsForDomains(context.Background(), []string{"a.com", "b.com", "bad.com", "c.com"})
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a *PartialError", err)
+	}
+	if !errors.Is(pe.Failures["bad.com"], ErrInternalError) || len(pe.Failures) != 1 {
+		t.Errorf("got failures %v, want only bad.com", pe.Failures)
+	}
+	if !reflect.DeepEqual(got, vas) {
+		t.Errorf("got %v, want %v", got, vas)
+	}
+	if !reflect.DeepEqual(pe.Result, got) {
+		t.Errorf("got partial result %v, want %v", pe.Result, got)
+	}
+}
+
+func TestPartialError(t *testing.T) {
+	result := map[string]int{"ok.com": 1}
+	var err error = &PartialError{Result: result, Failures: map[string]error{"b.com": ErrNotFound, "a.com": ErrForbidden}}
+	err = fmt.Errorf("GetSomething: %w", err)
+	want := "GetSomething: ccw: 2 request(s) failed: a.com: ccw: forbidden; b.com: ccw: not found"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatal("errors.As didn't find the *PartialError")
+	}
+	if got, ok := pe.Result.(map[string]int); !ok || got["ok.com"] != 1 {
+		t.Errorf("got result %v, want %v", pe.Result, result)
+	}
+	if !errors.Is(pe.Failures["a.com"], ErrForbidden) || !errors.Is(pe.Failures["b.com"], ErrNotFound) {
+		t.Errorf("got failures %v", pe.Failures)
+	}
+}
+
+func TestGetSmartLicenseUsageSummaryPartial(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 3)}))
+	licenses, err := c.GetSmartLicenseUsageSummary(context.Background(), smartAccountWith("VA1", "broken"))
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a *PartialError", err)
+	}
+	if len(licenses) != 3 || !reflect.DeepEqual(pe.Result, licenses) {
+		t.Errorf("got %d licenses and result %v, want the 3 from VA1 in both", len(licenses), pe.Result)
+	}
+	if _, ok := pe.Failures["broken"]; !ok || len(pe.Failures) != 1 {
+		t.Errorf("got failures %v, want only broken", pe.Failures)
+	}
+}
+
+func TestGetEAPortfolioConsumption(t *testing.T) {
+	reports := map[string]*EASmartAccountSubscriptionConsumptionReportResponse{
+		"a.com/Sub-1": eaReport("Sub-1", 100, 40),
+		"a.com/Sub-2": eaReport("Sub-2", 50, 10),
+		"b.com/Sub-3": eaReport("Sub-3", 20, 20),
+	}
+	c := newTestClient(t, eaReportHandler(t, reports), WithConcurrency(2))
+	refs := []EASubscriptionRef{
+		{Domain: "a.com", SubscriptionID: "Sub-1"},
+		{Domain: "a.com", SubscriptionID: "Sub-2"},
+		{Domain: "b.com", SubscriptionID: "Sub-3"},
+		{Domain: "c.com", SubscriptionID: "Sub-4"},
+		{Domain: "c.com", SubscriptionID: "broken"},
+	}
+	got, err := c.GetEAPortfolioConsumption(context.Background(), refs)
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a *PartialError", err)
+	}
+	if len(pe.Failures) != 1 || !errors.Is(pe.Failures["c.com/broken"], ErrInternalError) {
+		t.Errorf("got failures %v, want only c.com/broken", pe.Failures)
+	}
+	if len(got.Reports) != 3 || got.Reports[refs[1]].Subscriptions[0].SubscriptionID != "Sub-2" {
+		t.Errorf("got reports %v, want Sub-1 to Sub-3", got.Reports)
+	}
+	want := EAConsumptionSummary{Subscriptions: 3, Suites: 3, PurchasedEntitlements: 170, TotalEntitlements: 170, TotalConsumption: 70, RemainingEntitlements: 100}
+	if got.Summary != want {
+		t.Errorf("got summary %+v, want %+v", got.Summary, want)
+	}
+}
+
+func TestGetEAPortfolioConsumptionNoSubscriptions(t *testing.T) {
+	c := newTestClient(t, eaReportHandler(t, nil))
+	got, err := c.GetEAPortfolioConsumption(context.Background(), []EASubscriptionRef{{Domain: "a.com", SubscriptionID: "Sub-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Reports) != 0 || got.Summary != (EAConsumptionSummary{}) {
+		t.Errorf("got %+v, want an empty report", got)
+	}
+}
+
+func TestGetEAConsumptionReports(t *testing.T) {
+	reports := map[string]*EASmartAccountSubscriptionConsumptionReportResponse{}
+	refs := []EASubscriptionRef{}
+	for i := 0; i < 6; i++ {
+		sub := fmt.Sprintf("Sub-%d", i)
+		reports["a.com/"+sub] = eaReport(sub, 100, i)
+		refs = append(refs, EASubscriptionRef{Domain: "a.com", SubscriptionID: sub})
+	}
+	refs = append(refs, EASubscriptionRef{Domain: "a.com", SubscriptionID: "broken"}, EASubscriptionRef{Domain: "b.com", SubscriptionID: "none"})
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	reportsHandler := eaReportHandler(t, reports)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		reportsHandler(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+	var progress [][2]int
+	c := newTestClient(t, http.HandlerFunc(h), WithConcurrency(8))
+	got, err := c.GetEAConsumptionReports(context.Background(), refs, 2, func(completed, total int) {
+		progress = append(progress, [2]int{completed, total})
+	})
+
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(pe.Failures) != 2 {
+		t.Fatalf("got %v, want a *PartialError for two subscriptions", err)
+	}
+	if !errors.Is(pe.Failures["a.com/broken"], ErrInternalError) || !errors.Is(pe.Failures["b.com/none"], ErrNoSubscriptions) {
+		t.Errorf("got failures %v, want a.com/broken and b.com/none", pe.Failures)
+	}
+	if len(got) != 6 || !reflect.DeepEqual(pe.Result, got) {
+		t.Fatalf("got %d reports, want 6", len(got))
+	}
+	for i := 0; i < 6; i++ {
+		ref := refs[i]
+		if r := got[ref]; r == nil || !reflect.DeepEqual(r, reports[ref.String()]) {
+			t.Errorf("%s: got %+v, want %+v", ref, r, reports[ref.String()])
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("got %d requests in flight, want at most 2", maxInFlight)
+	}
+	want := [][2]int{}
+	for i := 1; i <= len(refs); i++ {
+		want = append(want, [2]int{i, len(refs)})
+	}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("got progress %v, want %v", progress, want)
+	}
+}
+
+func TestGetEAConsumptionReportsRateLimited(t *testing.T) {
+	reports := map[string]*EASmartAccountSubscriptionConsumptionReportResponse{}
+	refs := []EASubscriptionRef{}
+	for i := 0; i < 5; i++ {
+		sub := fmt.Sprintf("Sub-%d", i)
+		reports["a.com/"+sub] = eaReport(sub, 10, 1)
+		refs = append(refs, EASubscriptionRef{Domain: "a.com", SubscriptionID: sub})
+	}
+	// a limiter refusing all but the first request is waited on rather than failing the rest
+	c := newTestClient(t, eaReportHandler(t, reports), WithRateLimiter(rate.NewLimiter(rate.Every(2*time.Millisecond), 1)), WithRateLimitMode(RateLimitFail))
+	got, err := c.GetEAConsumptionReports(context.Background(), refs, 5, nil)
+	if err != nil || len(got) != 5 {
+		t.Errorf("got %d reports and %v, want 5 and no error", len(got), err)
+	}
+}
+
+func TestRunBounded(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	called := make([]int, 10)
+	errs := runBounded(context.Background(), len(called), 3, func(i int) error {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		called[i]++
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if i%2 == 1 {
+			return fmt.Errorf("odd %d", i)
+		}
+		return nil
+	})
+	if maxInFlight > 3 {
+		t.Errorf("got %d calls at once, want at most 3", maxInFlight)
+	}
+	for i := range called {
+		if called[i] != 1 {
+			t.Errorf("index %d: called %d times, want once", i, called[i])
+		}
+		if want := fmt.Sprintf("odd %d", i); (i%2 == 1) != (errs[i] != nil) || (errs[i] != nil && errs[i].Error() != want) {
+			t.Errorf("index %d: got error %v", i, errs[i])
+		}
+	}
+	if got := runBounded(context.Background(), 0, 0, func(int) error { return nil }); len(got) != 0 {
+		t.Errorf("no items: got %v, want none", got)
+	}
+}
+
+func TestRunBoundedCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var started counter
+	release := make(chan struct{})
+	go func() {
+		// cancel once the first batch is running, then let them finish
+		for started.get() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		close(release)
+	}()
+	errs := runBounded(ctx, 10, 2, func(i int) error {
+		started.inc()
+		<-release
+		return nil
+	})
+	if got := started.get(); got != 2 {
+		t.Errorf("got %d calls, want 2 with no more started once cancelled", got)
+	}
+	for i, err := range errs {
+		if want := i >= 2; want != errors.Is(err, context.Canceled) {
+			t.Errorf("index %d: got %v", i, err)
+		}
+	}
+
+	// an already cancelled context starts nothing
+	errs = runBounded(ctx, 3, 0, func(int) error {
+		t.Error("got a call, want none")
+		return nil
+	})
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("already cancelled, index %d: got %v, want context.Canceled", i, err)
+		}
+	}
+}
+
+func TestGetEAConsumptionReportsProgressOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports := eaReportHandler(t, map[string]*EASmartAccountSubscriptionConsumptionReportResponse{"a.com/Sub-0": eaReport("Sub-0", 1, 1)})
+	h := func(w http.ResponseWriter, r *http.Request) {
+		// the first request cancels the rest
+		cancel()
+		reports(w, r)
+	}
+	refs := []EASubscriptionRef{}
+	for i := 0; i < 5; i++ {
+		refs = append(refs, EASubscriptionRef{Domain: "a.com", SubscriptionID: fmt.Sprintf("Sub-%d", i)})
+	}
+	var progress [][2]int
+	c := newTestClient(t, http.HandlerFunc(h))
+	_, err := c.GetEAConsumptionReports(ctx, refs, 1, func(completed, total int) {
+		progress = append(progress, [2]int{completed, total})
+	})
+	var pe *PartialError
+	if !errors.As(err, &pe) || !errors.Is(pe.Failures["a.com/Sub-4"], context.Canceled) {
+		t.Fatalf("got %v, want a *PartialError with the cancelled subscriptions", err)
+	}
+	want := [][2]int{{1, 5}, {2, 5}, {3, 5}, {4, 5}, {5, 5}}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("got progress %v, want %v", progress, want)
+	}
+}
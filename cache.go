@@ -0,0 +1,62 @@
+package smartaccounts
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ResponseCache is used to store response bodies along with their ETag so that subsequent requests can be sent
+// with If-None-Match, and the stored body used if Cisco responds with 304 Not Modified.  Implementations must be
+// safe for concurrent use.
+type ResponseCache interface {
+	Get(key string) (etag string, body []byte, ok bool)
+	Set(key, etag string, body []byte)
+}
+
+// WithResponseCache enables ETag based caching of GET responses using the provided cache, keyed by URL.  This
+// only has an effect if Cisco returns an ETag header.  The default is no caching.
+func WithResponseCache(cache ResponseCache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// MemoryResponseCache is a simple in memory ResponseCache.
+type MemoryResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	etag string
+	body []byte
+}
+
+// NewMemoryResponseCache returns an empty MemoryResponseCache.
+func NewMemoryResponseCache() *MemoryResponseCache {
+	return &MemoryResponseCache{entries: map[string]memoryCacheEntry{}}
+}
+
+// Get returns the ETag and body stored for the given key.
+func (m *MemoryResponseCache) Get(key string) (string, []byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	return e.etag, e.body, ok
+}
+
+// Set stores the ETag and body for the given key.
+func (m *MemoryResponseCache) Set(key, etag string, body []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = memoryCacheEntry{etag: etag, body: body}
+}
+
+// cacheKey returns the key used to cache the response for the request, or an empty string if the
+// response should not be cached.
+func (c *Client) cacheKey(req *http.Request) string {
+	if c.cache == nil || req.Method != http.MethodGet {
+		return ""
+	}
+	return req.URL.String()
+}
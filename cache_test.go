@@ -0,0 +1,49 @@
+package smartaccounts
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestResponseCacheNotModified(t *testing.T) {
+	var calls, notModified counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.inc()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		writeJSON(t, w, VirtualAccountResponse{VirtualAccounts: []VirtualAccount{{Name: "VA1"}, {Name: "VA2"}}})
+	}
+	cache := NewMemoryResponseCache()
+	c := newTestClient(t, http.HandlerFunc(h), WithResponseCache(cache))
+	first, err := c.GetVirtualAccounts("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.GetVirtualAccounts("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.get() != 2 || notModified.get() != 1 {
+		t.Errorf("got %d requests with %d not modified, want 2 with 1", calls.get(), notModified.get())
+	}
+	if len(first) != 2 || !reflect.DeepEqual(first, second) {
+		t.Errorf("got %v from the cache, want %v", second, first)
+	}
+}
+
+func TestResponseCacheIgnoresPOST(t *testing.T) {
+	cache := NewMemoryResponseCache()
+	c := New("id", "secret", "user", "pass", WithResponseCache(cache))
+	req, err := c.newRequest(endpointLicenses, &LicenseRequest{}, nil, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := c.cacheKey(req); key != "" {
+		t.Errorf("got cache key %q for a POST, want none", key)
+	}
+}
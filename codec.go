@@ -0,0 +1,62 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Codec marshals request payloads and unmarshals responses, allowing encoding/json to be replaced with a faster
+// compatible library.  The Marshal and Unmarshal functions of packages such as jsoniter and goccy/go-json can be
+// used directly, e.g. via a small struct wrapping them.  Implementations must be safe for concurrent use.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// WithCodec sets the Codec used to marshal request payloads, including EndpointSpec.Body, and unmarshal responses,
+// including error bodies and the token.  The default is encoding/json.  A custom codec is given the whole response
+// body, and WithUseNumber has no effect with it.  A few things always use encoding/json: StreamLicenses, so that it
+// can decode one license at a time, the lines written by WriteLicensesJSONL and WithRecorder, and the files read by
+// NewReplayClient.
+func WithCodec(codec Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// marshal encodes v with the client's codec.
+func (c *Client) marshal(v interface{}) ([]byte, error) {
+	if c.codec != nil {
+		return c.codec.Marshal(v)
+	}
+	return json.Marshal(v)
+}
+
+// unmarshal decodes data into v with the client's codec.
+func (c *Client) unmarshal(data []byte, v interface{}) error {
+	if c.codec != nil {
+		return c.codec.Unmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBody decodes the response body into v using the client's codec, or if v is a *[]byte, reads the raw body
+// into it.  An empty body leaves v untouched.
+func (c *Client) decodeBody(r io.Reader, v interface{}) error {
+	if c.codec == nil {
+		return decodeBody(r, v, c.useNumber)
+	}
+	switch v.(type) {
+	case *[]byte, streamDecoder:
+		return decodeBody(r, v, false)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	return c.codec.Unmarshal(b, v)
+}
@@ -0,0 +1,121 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// countingCodec is a Codec wrapping encoding/json that records the types it is given.
+type countingCodec struct {
+	mu          sync.Mutex
+	marshalled  []string
+	unmarshaled []string
+}
+
+func (cc *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	cc.mu.Lock()
+	cc.marshalled = append(cc.marshalled, reflect.TypeOf(v).String())
+	cc.mu.Unlock()
+	return json.Marshal(v)
+}
+
+func (cc *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	cc.mu.Lock()
+	cc.unmarshaled = append(cc.unmarshaled, reflect.TypeOf(v).String())
+	cc.mu.Unlock()
+	return json.Unmarshal(data, v)
+}
+
+func TestWithCodec(t *testing.T) {
+	f := &fakeCisco{
+		search:   []SearchAccount{{Domain: "example.com", Name: "Example", ID: 1}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 3)},
+		reports:  map[string]*EASmartAccountSubscriptionConsumptionReportResponse{},
+	}
+	sa := SmartAccount{AccountDomain: "example.com", VirtualAccounts: &[]VirtualAccount{{Name: "VA1"}}}
+	ctx := context.Background()
+
+	want, err := newTestClient(t, f.handler(t)).GetSmartLicenseUsage(sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec := &countingCodec{}
+	c := newTestClient(t, f.handler(t), WithCodec(codec), WithFixedToken(""))
+	got, err := c.GetSmartLicenseUsage(sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want the same licenses as encoding/json: %+v", got, want)
+	}
+	if _, err := c.SearchSmartAccountsByDomain("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetEASmartAccountSubscriptionConsumptionReport("example.com", "Sub1"); !errors.Is(err, ErrNoSubscriptions) {
+		t.Errorf("got %v, want ErrNoSubscriptions decoded from the error body", err)
+	}
+	if _, err := c.GetRaw(ctx, EndpointSpec{Method: http.MethodPost, URL: swapiHost + endpointSearchAccounts.path, Body: map[string]int{"id": 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantMarshalled := []string{"*smartaccounts.LicenseRequest", "map[string]int"}
+	wantUnmarshaled := []string{
+		"*smartaccounts.Token", "*map[string]interface {}",
+		"*smartaccounts.LicenseResponse",
+		"*smartaccounts.SearchResponse",
+		"*smartaccounts.EAConsumptionReportError",
+	}
+	if !reflect.DeepEqual(codec.marshalled, wantMarshalled) {
+		t.Errorf("marshalled %v, want %v", codec.marshalled, wantMarshalled)
+	}
+	if !reflect.DeepEqual(codec.unmarshaled, wantUnmarshaled) {
+		t.Errorf("unmarshaled %v, want %v", codec.unmarshaled, wantUnmarshaled)
+	}
+}
+
+// stdCodec is a Codec using encoding/json.
+type stdCodec struct{}
+
+func (stdCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// failingCodec fails to unmarshal anything.
+type failingCodec struct{}
+
+var errCodec = errors.New("codec failed")
+
+func (failingCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (failingCodec) Unmarshal(data []byte, v interface{}) error { return errCodec }
+
+func TestWithCodecErrors(t *testing.T) {
+	c := newTestClient(t, searchHandler(t, SearchAccount{Domain: "example.com"}), WithCodec(failingCodec{}))
+	if _, err := c.SearchSmartAccountsByDomain("example.com"); !errors.Is(err, errCodec) {
+		t.Errorf("got %v, want the codec error", err)
+	}
+	raw, err := c.GetRaw(context.Background(), EndpointSpec{URL: swapiHost + endpointSearchAccounts.path})
+	if err != nil || len(raw) == 0 {
+		t.Errorf("got %q, %v, want the raw body without decoding", raw, err)
+	}
+}
+
+// BenchmarkDecodeBodyCodec decodes a page of licenses through a custom codec, for comparison with
+// BenchmarkDecodeBody which uses encoding/json directly.
+func BenchmarkDecodeBodyCodec(b *testing.B) {
+	page := licensePageJSON(b)
+	c := New("id", "secret", "user", "pass", WithCodec(stdCodec{}))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for i := 0; i < b.N; i++ {
+		var lr LicenseResponse
+		if err := c.decodeBody(bytes.NewReader(page), &lr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
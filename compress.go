@@ -0,0 +1,30 @@
+package smartaccounts
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WithGzip explicitly requests gzip compressed responses and decompresses them.  The default transport already
+// does this transparently, so this is only needed when HTTPClient has been replaced with one whose transport
+// doesn't, e.g. one with DisableCompression set.
+func WithGzip(enabled bool) Option {
+	return func(c *Client) {
+		c.gzip = enabled
+	}
+}
+
+// gzipBody returns a reader that decompresses the response body if it is gzip encoded and hasn't already
+// been decompressed by the transport.
+func gzipBody(res *http.Response) (io.ReadCloser, error) {
+	if res.Uncompressed || !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return res.Body, nil
+	}
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
@@ -0,0 +1,60 @@
+package smartaccounts
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gzipHandler compresses the response from next when the request accepts gzip, recording whether it did.
+func gzipHandler(next http.Handler, gzipped *counter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gzipped.inc()
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, r)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(rec.Code)
+		zw := gzip.NewWriter(w)
+		zw.Write(rec.Body.Bytes())
+		zw.Close()
+	}
+}
+
+func TestWithGzip(t *testing.T) {
+	licenses := makeLicenses("VA1", 100)
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{"default transport", nil, 1},
+		{"explicit", []Option{WithGzip(true)}, 1},
+		{"transport without compression", []Option{withTransport(&http.Transport{DisableCompression: true})}, 0},
+		{"explicit with transport without compression", []Option{withTransport(&http.Transport{DisableCompression: true}), WithGzip(true)}, 1},
+	} {
+		var gzipped counter
+		c := newTestClient(t, gzipHandler(licensesHandler(t, map[string][]License{"VA1": licenses}), &gzipped), tt.opts...)
+		lr, err := c.GetLicensesPage(context.Background(), "example.com", "VA1", 0, 100)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(lr.Licenses, licenses) {
+			t.Errorf("%s: got %d licenses that differ from those sent", tt.name, len(lr.Licenses))
+		}
+		if gzipped.get() != tt.want {
+			t.Errorf("%s: got %d gzipped responses, want %d", tt.name, gzipped.get(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ValidateCredentials checks the given credentials by requesting a token from Cisco, without creating or affecting
+// any existing Client.  The options are applied as they would be for New, so the same timeouts, transport and
+// token retries can be used.  It returns nil if a token was issued, otherwise an error wrapping ErrUnauthorized if
+// the credentials were rejected, ErrInternalError if the token endpoint failed, or ErrNetwork if Cisco couldn't be
+// reached.  This is intended for things like a "test connection" button.
+func ValidateCredentials(ctx context.Context, clientID, secret, username, password string, opts ...Option) (err error) {
+	defer wrapOp(&err, "ValidateCredentials")
+	c := New(clientID, secret, username, password, opts...)
+	c.fixedToken, c.secretSource = "", nil
+	_, err = c.getToken(ctx)
+	var ne net.Error
+	if ctx.Err() == nil && errors.As(err, &ne) {
+		return fmt.Errorf("%w: %v", ErrNetwork, err)
+	}
+	return err
+}
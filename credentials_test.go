@@ -0,0 +1,79 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+)
+
+// tokenServer starts a server that responds to token requests with the given status, issuing a token if it's 200,
+// and returns an option that sends requests to it.
+func tokenServer(t *testing.T, status int, form *url.Values) Option {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isTokenRequest(r) {
+			t.Errorf("got a request for %s, want only a token request", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		*form = r.PostForm
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		serveToken(t, w)
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return withTransport(&rewriteTransport{host: u.Host, next: http.DefaultTransport})
+}
+
+func TestValidateCredentials(t *testing.T) {
+	var form url.Values
+	// a fixed token on the options mustn't prevent the credentials being checked
+	err := ValidateCredentials(context.Background(), "id", "secret", "user", "pass", tokenServer(t, http.StatusOK, &form), WithFixedToken("fixed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("client_id") != "id" || form.Get("client_secret") != "secret" || form.Get("username") != "user" || form.Get("password") != "pass" {
+		t.Errorf("got form %v, want the given credentials", form)
+	}
+}
+
+func TestValidateCredentialsInvalid(t *testing.T) {
+	var form url.Values
+	err := ValidateCredentials(context.Background(), "id", "wrong", "user", "pass", tokenServer(t, http.StatusUnauthorized, &form))
+	if !errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNetwork) {
+		t.Errorf("got %v, want ErrUnauthorized", err)
+	}
+	if !errors.Is(ValidateCredentials(context.Background(), "", "", "", ""), ErrMissingCredentials) {
+		t.Error("got no error for missing credentials, want ErrMissingCredentials")
+	}
+}
+
+func TestValidateCredentialsServerError(t *testing.T) {
+	var form url.Values
+	err := ValidateCredentials(context.Background(), "id", "secret", "user", "pass", tokenServer(t, http.StatusServiceUnavailable, &form), WithTokenRetries(0))
+	if !errors.Is(err, ErrInternalError) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got %v, want ErrInternalError", err)
+	}
+}
+
+func TestValidateCredentialsNetworkError(t *testing.T) {
+	refused := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	})
+	err := ValidateCredentials(context.Background(), "id", "secret", "user", "pass", withTransport(refused), WithTokenRetries(0))
+	if !errors.Is(err, ErrNetwork) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got %v, want ErrNetwork", err)
+	}
+}
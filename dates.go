@@ -0,0 +1,67 @@
+package smartaccounts
+
+import (
+	"strings"
+	"time"
+)
+
+// dateLayouts are the formats we've seen (or might reasonably see) for dates returned by Cisco.
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05.000Z0700",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05",
+	"01/02/2006",
+	"02-Jan-2006",
+	"Jan 2, 2006",
+}
+
+// dateOnlyLayouts are the layouts in dateLayouts that have no time of day.
+var dateOnlyLayouts = map[string]bool{
+	"2006-01-02":  true,
+	"01/02/2006":  true,
+	"02-Jan-2006": true,
+	"Jan 2, 2006": true,
+}
+
+// parseDate attempts to parse a date string from Cisco using the known layouts.  The boolean
+// will be false if the value is empty or doesn't match any of the layouts.
+func parseDate(s string) (time.Time, bool) {
+	t, _, ok := parseDateLayout(s)
+	return t, ok
+}
+
+// parseEndDate parses an end date as parseDate does, except that a date without a time of day is taken to be the
+// end of that day, so that something ending today hasn't ended until the day is over.
+func parseEndDate(s string) (time.Time, bool) {
+	t, layout, ok := parseDateLayout(s)
+	if ok && dateOnlyLayouts[layout] {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, ok
+}
+
+// parseDateLayout parses the date as parseDate does, also returning the layout that matched.
+func parseDateLayout(s string) (time.Time, string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, "", false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, layout, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// daysBetween returns the number of calendar days from the UTC date of from to the UTC date of to, which is
+// negative if to is on an earlier day.  The times of day are ignored.
+func daysBetween(from, to time.Time) int {
+	fy, fm, fd := from.UTC().Date()
+	ty, tm, td := to.UTC().Date()
+	f := time.Date(fy, fm, fd, 0, 0, 0, 0, time.UTC)
+	t := time.Date(ty, tm, td, 0, 0, 0, 0, time.UTC)
+	return int(t.Sub(f) / (24 * time.Hour))
+}
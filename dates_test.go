@@ -0,0 +1,52 @@
+package smartaccounts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEndDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-03-31", time.Date(2024, 3, 31, 23, 59, 59, 999999999, time.UTC), true},
+		{"03/31/2024", time.Date(2024, 3, 31, 23, 59, 59, 999999999, time.UTC), true},
+		{"2024-03-31T10:00:00Z", time.Date(2024, 3, 31, 10, 0, 0, 0, time.UTC), true},
+		{"", time.Time{}, false},
+		{"not a date", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseEndDate(tt.in)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseEndDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		from, to string
+		want     int
+	}{
+		{"2024-03-10T23:59:00Z", "2024-03-11T00:01:00Z", 1},
+		{"2024-03-10T00:01:00Z", "2024-03-10T23:59:00Z", 0},
+		{"2024-03-10T23:59:00Z", "2024-03-10T00:00:00Z", 0},
+		{"2024-03-10T00:00:00Z", "2024-03-09T23:59:00Z", -1},
+		{"2024-02-28T12:00:00Z", "2024-03-01T00:00:00Z", 2},
+		{"2024-03-10T12:00:00Z", "2024-03-11T01:00:00+02:00", 0},
+	}
+	for _, tt := range tests {
+		if got := daysBetween(at(tt.from), at(tt.to)); got != tt.want {
+			t.Errorf("%s to %s: got %d, want %d", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -1,19 +1,36 @@
 package smartaccounts
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
 	"fmt"
-	"net/http"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // EAConsumptionReportError represents the error received by GetEASmartAccountSubscriptionConsumptionReport which
-// Cisco sends as a 400 Bad Request, typically when there are no subscriptions for the provided details.
+// Cisco sends as a 400 Bad Request, typically when there are no subscriptions for the provided details.  Other than
+// for no subscriptions, which is returned as ErrNoSubscriptions, it is returned as a *EAConsumptionReportError
+// which matches ErrBadRequest with errors.Is, and can be retrieved with errors.As to inspect the fields.
 type EAConsumptionReportError struct {
 	Code     int    `json:"code"`
 	Message  string `json:"message"`
 	Severity string `json:"severity"`
 }
 
+func (e *EAConsumptionReportError) Error() string {
+	return fmt.Sprintf("%s: %d %s", ErrBadRequest, e.Code, e.Message)
+}
+
+// Unwrap allows errors.Is to match ErrBadRequest.
+func (e *EAConsumptionReportError) Unwrap() error {
+	return ErrBadRequest
+}
+
 // EASmartAccountSubscriptionConsumptionReportResponse represents the response from the EA Smart Account
 // Subscription Consumption Report.  Sorry for the ridiculously long name!
 type EASmartAccountSubscriptionConsumptionReportResponse struct {
@@ -98,16 +115,357 @@ type EACommerceSKU struct {
 
 // GetEASmartAccountSubscriptionConsumptionReport can be used to get the consumption report for the EA
 // Subscriptions.
-func (c *Client) GetEASmartAccountSubscriptionConsumptionReport(smartAccountDomain, subscriptionID string) (*EASmartAccountSubscriptionConsumptionReportResponse, error) {
-	url := fmt.Sprintf("https://swapi.cisco.com/services/api/enterprise-agreements/v1/subscription/account/%s/subscription/%s/consumption", smartAccountDomain, subscriptionID)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func (c *Client) GetEASmartAccountSubscriptionConsumptionReport(smartAccountDomain, subscriptionID string) (_ *EASmartAccountSubscriptionConsumptionReportResponse, err error) {
+	defer wrapOp(&err, "GetEASmartAccountSubscriptionConsumptionReport(%s, %s)", smartAccountDomain, subscriptionID)
+	ctx, cancel := c.methodContext(context.Background(), "GetEASmartAccountSubscriptionConsumptionReport")
+	defer cancel()
+	return c.getEAConsumptionReport(ctx, smartAccountDomain, subscriptionID)
+}
+
+func (c *Client) getEAConsumptionReport(ctx context.Context, smartAccountDomain, subscriptionID string) (*EASmartAccountSubscriptionConsumptionReportResponse, error) {
+	return c.getEAConsumptionReportAsOf(ctx, smartAccountDomain, subscriptionID, time.Time{})
+}
+
+// GetEASmartAccountSubscriptionConsumptionReportAsOf gets the consumption report for the EA Subscriptions as it
+// was on the given date, for historical reporting.  The date is sent as the asOfDate query parameter in the form
+// YYYY-MM-DD.  A zero time requests the current report.
+func (c *Client) GetEASmartAccountSubscriptionConsumptionReportAsOf(ctx context.Context, smartAccountDomain, subscriptionID string, asOf time.Time) (_ *EASmartAccountSubscriptionConsumptionReportResponse, err error) {
+	defer wrapOp(&err, "GetEASmartAccountSubscriptionConsumptionReportAsOf(%s, %s)", smartAccountDomain, subscriptionID)
+	ctx, cancel := c.methodContext(ctx, "GetEASmartAccountSubscriptionConsumptionReportAsOf")
+	defer cancel()
+	return c.getEAConsumptionReportAsOf(ctx, smartAccountDomain, subscriptionID, asOf)
+}
+
+func (c *Client) getEAConsumptionReportAsOf(ctx context.Context, smartAccountDomain, subscriptionID string, asOf time.Time) (*EASmartAccountSubscriptionConsumptionReportResponse, error) {
+	q := url.Values{}
+	if !asOf.IsZero() {
+		q.Set("asOfDate", asOf.Format("2006-01-02"))
+	}
+	req, err := c.newRequest(endpointEAConsumption, nil, q, smartAccountDomain, subscriptionID)
 	if err != nil {
 		return nil, err
 	}
 	var ear EASmartAccountSubscriptionConsumptionReportResponse
-	err = c.makeRequest(context.Background(), req, &ear)
+	err = c.makeRequest(ctx, req, &ear)
 	if err != nil {
 		return nil, err
 	}
 	return &ear, nil
 }
+
+// ActiveSubscriptions returns only those subscriptions from the report that are currently active.  A subscription
+// is considered active when its Status is ACTIVE (or empty) and now falls between its StartDate and EndDate.  An
+// EndDate without a time of day includes the whole of that day.  Dates that are empty or can't be parsed are ignored
+// for the comparison, so such subscriptions are included based on their Status alone.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) ActiveSubscriptions() []EASubscription {
+	now := time.Now().UTC()
+	active := []EASubscription{}
+	for _, s := range r.Subscriptions {
+		if s.Status != "" && !s.TypedStatus().Is(SubscriptionStatusActive) {
+			continue
+		}
+		if start, ok := parseDate(s.StartDate); ok && start.After(now) {
+			continue
+		}
+		if end, ok := parseEndDate(s.EndDate); ok && end.Before(now) {
+			continue
+		}
+		active = append(active, s)
+	}
+	return active
+}
+
+// ExpiringWithinMonths returns the subscriptions from the report that expire between now and the end of the day the
+// given number of months from now.  The EndDate is used where it can be parsed, taking a date without a time to be
+// the end of that day as ActiveSubscriptions does, so subscriptions that have already expired are excluded.
+// Otherwise RemainingDurationInMonths is used, provided the subscription reports some time remaining, and
+// subscriptions with neither are excluded.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) ExpiringWithinMonths(months int) []EASubscription {
+	now := time.Now().UTC()
+	y, m, d := now.AddDate(0, months, 0).Date()
+	cutoff := time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)
+	expiring := []EASubscription{}
+	for _, s := range r.Subscriptions {
+		if end, ok := parseEndDate(s.EndDate); ok {
+			if !end.Before(now) && !end.After(cutoff) {
+				expiring = append(expiring, s)
+			}
+			continue
+		}
+		if (s.RemainingDurationInMonths > 0 || s.RemainingDuration > 0) && s.RemainingDurationInMonths <= months {
+			expiring = append(expiring, s)
+		}
+	}
+	return expiring
+}
+
+// GetEASmartAccountSubscriptionConsumptionReportCSV requests the consumption report for the EA Subscriptions
+// in CSV format and returns the parsed records.  Note that Cisco does not document a CSV variant of this
+// report, so this depends on the endpoint honouring an Accept header of text/csv.
+func (c *Client) GetEASmartAccountSubscriptionConsumptionReportCSV(ctx context.Context, smartAccountDomain, subscriptionID string) (_ [][]string, err error) {
+	defer wrapOp(&err, "GetEASmartAccountSubscriptionConsumptionReportCSV(%s, %s)", smartAccountDomain, subscriptionID)
+	ctx, cancel := c.methodContext(ctx, "GetEASmartAccountSubscriptionConsumptionReportCSV")
+	defer cancel()
+	req, err := c.newRequest(endpointEAConsumption, nil, nil, smartAccountDomain, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/csv")
+	var body []byte
+	err = c.makeRequest(ctx, req, &body)
+	if err != nil {
+		return nil, err
+	}
+	return csv.NewReader(bytes.NewReader(body)).ReadAll()
+}
+
+// The EA Consumption Report doesn't document the units of Duration and RemainingDuration.  The helpers below assume
+// days, alongside DurationInMonths and RemainingDurationInMonths which are whole months.
+
+// day is the length of a day used when converting the subscription durations.
+const day = 24 * time.Hour
+
+// DurationDays returns the total length of the subscription term in days.
+func (s EASubscription) DurationDays() int {
+	return s.Duration
+}
+
+// RemainingDays returns the number of days remaining in the subscription term.
+func (s EASubscription) RemainingDays() int {
+	return s.RemainingDuration
+}
+
+// TermAsDuration returns the total length of the subscription term as a time.Duration.
+func (s EASubscription) TermAsDuration() time.Duration {
+	return time.Duration(s.Duration) * day
+}
+
+// RemainingAsDuration returns the time remaining in the subscription term as a time.Duration.  It is never negative.
+func (s EASubscription) RemainingAsDuration() time.Duration {
+	if s.RemainingDuration <= 0 {
+		return 0
+	}
+	return time.Duration(s.RemainingDuration) * day
+}
+
+// NextTrueForwardDate parses NextTrueForward, returning the date along with the number of calendar days from today
+// until it, using UTC dates, so 0 if it is today, 1 if tomorrow and negative if it has passed.  The boolean will be false if NextTrueForward is empty or invalid.
+func (s EASubscription) NextTrueForwardDate() (time.Time, int, bool) {
+	t, ok := parseDate(s.NextTrueForward)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	return t, daysBetween(time.Now(), t), true
+}
+
+// SubscriptionsByArchitecture returns the subscriptions from the report with the given ArchitectureName.  The
+// comparison ignores case.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) SubscriptionsByArchitecture(architecture string) []EASubscription {
+	subs := []EASubscription{}
+	for _, s := range r.Subscriptions {
+		if strings.EqualFold(s.ArchitectureName, architecture) {
+			subs = append(subs, s)
+		}
+	}
+	return subs
+}
+
+// EAConsumptionSummary represents a rollup of the suites in one or more EA Consumption Reports.
+type EAConsumptionSummary struct {
+	Subscriptions         int
+	Suites                int
+	PurchasedEntitlements int
+	TotalEntitlements     int
+	TotalConsumption      int
+	RemainingEntitlements int
+}
+
+// Summarize rolls up the entitlement and consumption figures of every suite in the report.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) Summarize() EAConsumptionSummary {
+	var sum EAConsumptionSummary
+	sum.add(r)
+	return sum
+}
+
+func (sum *EAConsumptionSummary) add(r *EASmartAccountSubscriptionConsumptionReportResponse) {
+	for _, sub := range r.Subscriptions {
+		sum.Subscriptions++
+		for _, acc := range sub.Accounts {
+			for _, va := range acc.VirtualAccounts {
+				for _, suite := range va.Suites {
+					sum.Suites++
+					sum.PurchasedEntitlements += suite.PurchasedEntitlements
+					sum.TotalEntitlements += suite.TotalEntitlements
+					sum.TotalConsumption += suite.TotalConsumption
+					sum.RemainingEntitlements += suite.RemainingEntitlements
+				}
+			}
+		}
+	}
+}
+
+// EASKURow represents a single commerce SKU from the EA Consumption Report along with the details of the
+// subscription, account, virtual account and suite it belongs to.
+type EASKURow struct {
+	SubscriptionID     string
+	SubscriptionStatus SubscriptionStatus
+	ArchitectureName   string
+	SmartAccountID     int
+	SmartAccountName   string
+	VirtualAccountID   int
+	VirtualAccountName string
+	SuiteName          string
+	CustSuiteName      string
+	EACommerceSKU
+}
+
+// Flatten returns the report as a flat slice with one row per commerce SKU, which is more convenient for
+// tabular output such as CSV.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) Flatten() []EASKURow {
+	rows := []EASKURow{}
+	for _, sub := range r.Subscriptions {
+		for _, acc := range sub.Accounts {
+			for _, va := range acc.VirtualAccounts {
+				for _, suite := range va.Suites {
+					for _, sku := range suite.CommerceSkUs {
+						rows = append(rows, EASKURow{
+							SubscriptionID:     sub.SubscriptionID,
+							SubscriptionStatus: sub.TypedStatus(),
+							ArchitectureName:   sub.ArchitectureName,
+							SmartAccountID:     acc.SmartAccountID,
+							SmartAccountName:   acc.SmartAccountName,
+							VirtualAccountID:   va.VirtualAccountID,
+							VirtualAccountName: va.VirtualAccountName,
+							SuiteName:          suite.SuiteName,
+							CustSuiteName:      suite.CustSuiteName,
+							EACommerceSKU:      sku,
+						})
+					}
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// eaReportCSVHeader is the header row written by WriteEAReportCSV.
+var eaReportCSVHeader = []string{
+	"subscriptionId", "subscriptionStatus", "architectureName", "smartAccountId", "smartAccountName",
+	"virtualAccountId", "virtualAccountName", "suiteName", "custSuiteName", "commerceSku", "commerceSkuDescription",
+	"eol", "eolMessage", "purchasedEntitlements", "premierEntitlements", "growthAllowance", "totalEntitlements",
+	"preEAConsumption", "licenseGenerated", "licenseMigrated", "c1ToDNAMigratedCount", "totalConsumption",
+	"remainingEntitlements", "softwareDownloads", "healthMessage", "calculationMethod", "commitmentType",
+}
+
+// WriteEAReportCSV writes the report to w as CSV, with a header row followed by one row per commerce SKU as
+// returned by Flatten, including the details of the subscription, account, virtual account and suite it belongs to.
+func WriteEAReportCSV(w io.Writer, report *EASmartAccountSubscriptionConsumptionReportResponse) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(eaReportCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range report.Flatten() {
+		err := cw.Write([]string{
+			r.SubscriptionID, string(r.SubscriptionStatus), r.ArchitectureName, strconv.Itoa(r.SmartAccountID),
+			r.SmartAccountName, strconv.Itoa(r.VirtualAccountID), r.VirtualAccountName, r.SuiteName, r.CustSuiteName,
+			r.CommerceSKU, r.CommerceSKUDescription, strconv.FormatBool(r.EOL), r.EOLMessage,
+			strconv.Itoa(r.PurchasedEntitlements), strconv.Itoa(r.PremierEntitlements), strconv.Itoa(r.GrowthAllowance),
+			strconv.Itoa(r.TotalEntitlements), strconv.Itoa(r.PreEAConsumption), strconv.Itoa(r.LicenseGenerated),
+			strconv.Itoa(r.LicenseMigrated), strconv.Itoa(r.C1ToDNAMigratedCount), strconv.Itoa(r.TotalConsumption),
+			strconv.Itoa(r.RemainingEntitlements), strconv.Itoa(r.SoftwareDownloads), r.HealthMessage,
+			r.CalculationMethod, r.CommitmentType,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// UnknownArchitecture is used to group subscriptions that have no ArchitectureName.
+const UnknownArchitecture = "UNKNOWN"
+
+// ArchitectureConsumption represents the total entitlements and consumption for an architecture.
+type ArchitectureConsumption struct {
+	Total    int
+	Consumed int
+}
+
+// ConsumptionByArchitecture sums the TotalEntitlements and TotalConsumption of every suite in the report, grouped
+// by the ArchitectureName of the subscription.  Subscriptions without an architecture are grouped under
+// UnknownArchitecture.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) ConsumptionByArchitecture() map[string]ArchitectureConsumption {
+	totals := map[string]ArchitectureConsumption{}
+	for _, sub := range r.Subscriptions {
+		arch := sub.ArchitectureName
+		if arch == "" {
+			arch = UnknownArchitecture
+		}
+		t := totals[arch]
+		for _, acc := range sub.Accounts {
+			for _, va := range acc.VirtualAccounts {
+				for _, suite := range va.Suites {
+					t.Total += suite.TotalEntitlements
+					t.Consumed += suite.TotalConsumption
+				}
+			}
+		}
+		totals[arch] = t
+	}
+	return totals
+}
+
+// EASuiteRow represents a single suite from the EA Consumption Report along with the details of the subscription,
+// account and virtual account it belongs to.
+type EASuiteRow struct {
+	SubscriptionID     string
+	ArchitectureName   string
+	SmartAccountID     int
+	SmartAccountName   string
+	VirtualAccountID   int
+	VirtualAccountName string
+	EASuite
+}
+
+// RemainingPercent returns RemainingEntitlements as a percentage of TotalEntitlements, or 0 when there are no
+// entitlements.
+func (s EASuite) RemainingPercent() float64 {
+	if s.TotalEntitlements == 0 {
+		return 0
+	}
+	return float64(s.RemainingEntitlements) / float64(s.TotalEntitlements) * 100
+}
+
+// LowEntitlementSuites returns the suites that are running low on entitlements, i.e. those with fewer than
+// minRemaining RemainingEntitlements, or whose RemainingEntitlements are less than minPercent of their
+// TotalEntitlements.  Either threshold can be 0 to disable it.  Suites without any TotalEntitlements are only
+// checked against minRemaining.
+func (r *EASmartAccountSubscriptionConsumptionReportResponse) LowEntitlementSuites(minRemaining int, minPercent float64) []EASuiteRow {
+	rows := []EASuiteRow{}
+	for _, sub := range r.Subscriptions {
+		for _, acc := range sub.Accounts {
+			for _, va := range acc.VirtualAccounts {
+				for _, suite := range va.Suites {
+					low := suite.RemainingEntitlements < minRemaining
+					if minPercent > 0 && suite.TotalEntitlements > 0 && suite.RemainingPercent() < minPercent {
+						low = true
+					}
+					if !low {
+						continue
+					}
+					rows = append(rows, EASuiteRow{
+						SubscriptionID:     sub.SubscriptionID,
+						ArchitectureName:   sub.ArchitectureName,
+						SmartAccountID:     acc.SmartAccountID,
+						SmartAccountName:   acc.SmartAccountName,
+						VirtualAccountID:   va.VirtualAccountID,
+						VirtualAccountName: va.VirtualAccountName,
+						EASuite:            suite,
+					})
+				}
+			}
+		}
+	}
+	return rows
+}
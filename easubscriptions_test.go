@@ -0,0 +1,444 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// dateFromToday formats a date relative to today as YYYY-MM-DD.
+func dateFromToday(days int) string {
+	return time.Now().UTC().AddDate(0, 0, days).Format("2006-01-02")
+}
+
+func subscriptionIDs(subs []EASubscription) []string {
+	ids := []string{}
+	for _, s := range subs {
+		ids = append(ids, s.SubscriptionID)
+	}
+	return ids
+}
+
+func TestActiveSubscriptions(t *testing.T) {
+	report := &EASmartAccountSubscriptionConsumptionReportResponse{Subscriptions: []EASubscription{
+		{SubscriptionID: "active", Status: "ACTIVE", StartDate: dateFromToday(-30), EndDate: dateFromToday(30)},
+		{SubscriptionID: "lowercase", Status: "active", StartDate: dateFromToday(-30), EndDate: dateFromToday(30)},
+		{SubscriptionID: "no-status", StartDate: dateFromToday(-30), EndDate: dateFromToday(30)},
+		{SubscriptionID: "ends-today", Status: "ACTIVE", StartDate: dateFromToday(-30), EndDate: dateFromToday(0)},
+		{SubscriptionID: "no-dates", Status: "ACTIVE"},
+		{SubscriptionID: "bad-dates", Status: "ACTIVE", StartDate: "soon", EndDate: "later"},
+		{SubscriptionID: "expired", Status: "ACTIVE", StartDate: dateFromToday(-60), EndDate: dateFromToday(-1)},
+		{SubscriptionID: "future", Status: "ACTIVE", StartDate: dateFromToday(1), EndDate: dateFromToday(60)},
+		{SubscriptionID: "expired-status", Status: "EXPIRED", StartDate: dateFromToday(-30), EndDate: dateFromToday(30)},
+	}}
+	got := subscriptionIDs(report.ActiveSubscriptions())
+	want := []string{"active", "lowercase", "no-status", "ends-today", "no-dates", "bad-dates"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestActiveSubscriptionsEmpty(t *testing.T) {
+	report := &EASmartAccountSubscriptionConsumptionReportResponse{}
+	if got := report.ActiveSubscriptions(); got == nil || len(got) != 0 {
+		t.Fatalf("got %v, want an empty slice", got)
+	}
+}
+
+func TestExpiringWithinMonths(t *testing.T) {
+	now := time.Now().UTC()
+	inMonths := func(months, days int) string {
+		return now.AddDate(0, months, days).Format("2006-01-02")
+	}
+	report := &EASmartAccountSubscriptionConsumptionReportResponse{Subscriptions: []EASubscription{
+		{SubscriptionID: "near", EndDate: dateFromToday(30)},
+		{SubscriptionID: "ends-today", EndDate: dateFromToday(0)},
+		{SubscriptionID: "ends-on-cutoff", EndDate: inMonths(3, 0)},
+		{SubscriptionID: "rfc3339", EndDate: now.Add(48 * time.Hour).Format(time.RFC3339)},
+		{SubscriptionID: "other-layout", EndDate: now.AddDate(0, 0, 10).Format("02-Jan-2006")},
+		{SubscriptionID: "after-cutoff", EndDate: inMonths(3, 1)},
+		{SubscriptionID: "long-remaining", EndDate: inMonths(24, 0), RemainingDurationInMonths: 24},
+		{SubscriptionID: "expired", EndDate: dateFromToday(-1), RemainingDurationInMonths: 1},
+		{SubscriptionID: "no-date-near", RemainingDurationInMonths: 2},
+		{SubscriptionID: "no-date-days", RemainingDuration: 20},
+		{SubscriptionID: "bad-date-near", EndDate: "soon", RemainingDurationInMonths: 3},
+		{SubscriptionID: "no-date-long", RemainingDurationInMonths: 12},
+		{SubscriptionID: "no-date-expired"},
+	}}
+	got := subscriptionIDs(report.ExpiringWithinMonths(3))
+	want := []string{"near", "ends-today", "ends-on-cutoff", "rfc3339", "other-layout", "no-date-near", "no-date-days", "bad-date-near"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := (&EASmartAccountSubscriptionConsumptionReportResponse{}).ExpiringWithinMonths(3); got == nil || len(got) != 0 {
+		t.Errorf("empty: got %v, want an empty slice", got)
+	}
+}
+
+func TestGetEASmartAccountSubscriptionConsumptionReportCSV(t *testing.T) {
+	const fixture = "subscriptionId,suiteName,totalConsumption\nSub-1,DNA Advantage,42\nSub-1,\"ISE, Plus\",7\n"
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept"); got != "text/csv" {
+			t.Errorf("got Accept %q, want text/csv", got)
+		}
+		if want := "/services/api/enterprise-agreements/v1/subscription/account/example.com/subscription/Sub-1/consumption"; r.URL.Path != want {
+			t.Errorf("got path %s, want %s", r.URL.Path, want)
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(fixture))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	got, err := c.GetEASmartAccountSubscriptionConsumptionReportCSV(context.Background(), "example.com", "Sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"subscriptionId", "suiteName", "totalConsumption"},
+		{"Sub-1", "DNA Advantage", "42"},
+		{"Sub-1", "ISE, Plus", "7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNextTrueForwardDate(t *testing.T) {
+	in10 := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10).Add(12 * time.Hour)
+	s := EASubscription{NextTrueForward: in10.Format(time.RFC3339)}
+	got, days, ok := s.NextTrueForwardDate()
+	if !ok || !got.Equal(in10.Truncate(time.Second)) || days != 10 {
+		t.Errorf("valid: got %v, %d, %v, want %v, 10, true", got, days, ok, in10)
+	}
+
+	for _, offset := range []int{-5, -1, 0, 1, 30} {
+		s := EASubscription{NextTrueForward: dateFromToday(offset)}
+		if _, days, ok := s.NextTrueForwardDate(); !ok || days != offset {
+			t.Errorf("%s: got %d, %v, want %d days", s.NextTrueForward, days, ok, offset)
+		}
+	}
+
+	// a time earlier today is still today, not a day ago
+	s = EASubscription{NextTrueForward: time.Now().UTC().Truncate(24 * time.Hour).Format(time.RFC3339)}
+	if _, days, ok := s.NextTrueForwardDate(); !ok || days != 0 {
+		t.Errorf("start of today: got %d, %v, want 0 days", days, ok)
+	}
+
+	for _, v := range []string{"", "   ", "next tuesday", "2024-13-45"} {
+		s := EASubscription{NextTrueForward: v}
+		if got, days, ok := s.NextTrueForwardDate(); ok || !got.IsZero() || days != 0 {
+			t.Errorf("%q: got %v, %d, %v, want not ok", v, got, days, ok)
+		}
+	}
+}
+
+func TestEASubscriptionsByArchitecture(t *testing.T) {
+	report := &EASmartAccountSubscriptionConsumptionReportResponse{Subscriptions: []EASubscription{
+		{SubscriptionID: "Sub-1", ArchitectureName: "DNA"},
+		{SubscriptionID: "Sub-2", ArchitectureName: "Security"},
+		{SubscriptionID: "Sub-3", ArchitectureName: "dna"},
+		{SubscriptionID: "Sub-4"},
+	}}
+	if got := subscriptionIDs(report.SubscriptionsByArchitecture("DNA")); !reflect.DeepEqual(got, []string{"Sub-1", "Sub-3"}) {
+		t.Errorf("got %v, want Sub-1 and Sub-3", got)
+	}
+	if got := subscriptionIDs(report.SubscriptionsByArchitecture("Collaboration")); len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+}
+
+func TestEAConsumptionReportError(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if strings.Contains(r.URL.Path, "/Sub-1/") {
+			w.Write([]byte(`{"code":400001,"message":"No Valid Subscriptions found","severity":"ERROR"}`))
+			return
+		}
+		w.Write([]byte(`{"code":400002,"message":"Invalid Smart Account Domain","severity":"ERROR"}`))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+
+	_, err := c.GetEASmartAccountSubscriptionConsumptionReport("example.com", "Sub-1")
+	if !errors.Is(err, ErrNoSubscriptions) {
+		t.Errorf("no subscriptions: got %v, want ErrNoSubscriptions", err)
+	}
+
+	_, err = c.GetEASmartAccountSubscriptionConsumptionReport("example.com", "Sub-2")
+	var eaErr *EAConsumptionReportError
+	if !errors.As(err, &eaErr) {
+		t.Fatalf("got %v, want a *EAConsumptionReportError", err)
+	}
+	want := EAConsumptionReportError{Code: 400002, Message: "Invalid Smart Account Domain", Severity: "ERROR"}
+	if *eaErr != want {
+		t.Errorf("got %+v, want %+v", *eaErr, want)
+	}
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("got %v, want it to match ErrBadRequest", err)
+	}
+}
+
+// eaReportFixture is a nested EA Consumption Report as returned by Cisco, including the misspelled vitualAccounts.
+const eaReportFixture = `{"subscriptions": [{
+	"subscriptionID": "Sub-1", "status": "ACTIVE", "architectureName": "DNA",
+	"accounts": [{
+		"smartAccountId": 101, "smartAccountName": "Example",
+		"vitualAccounts": [
+			{"virtualAccountId": 1, "virtualAccountName": "VA1", "suites": [
+				{"suiteName": "DNA Advantage", "custSuiteName": "DNA-A", "commerceSkus": [
+					{"commerceSku": "SKU-1", "totalConsumption": 5},
+					{"commerceSku": "SKU-2", "totalConsumption": 3}
+				]},
+				{"suiteName": "No SKUs", "commerceSkus": []}
+			]},
+			{"virtualAccountId": 2, "virtualAccountName": "VA2", "suites": [
+				{"suiteName": "ISE Plus", "custSuiteName": "ISE-P", "commerceSkus": [
+					{"commerceSku": "SKU-3", "totalConsumption": 7, "commitmentType": "COMMITTED"}
+				]}
+			]}
+		]
+	}]
+}]}`
+
+func TestFlatten(t *testing.T) {
+	var report EASmartAccountSubscriptionConsumptionReportResponse
+	if err := json.Unmarshal([]byte(eaReportFixture), &report); err != nil {
+		t.Fatal(err)
+	}
+	row := func(vaID int, va, suite, custSuite string, sku EACommerceSKU) EASKURow {
+		return EASKURow{
+			SubscriptionID: "Sub-1", SubscriptionStatus: SubscriptionStatusActive, ArchitectureName: "DNA",
+			SmartAccountID: 101, SmartAccountName: "Example", VirtualAccountID: vaID, VirtualAccountName: va,
+			SuiteName: suite, CustSuiteName: custSuite, EACommerceSKU: sku,
+		}
+	}
+	want := []EASKURow{
+		row(1, "VA1", "DNA Advantage", "DNA-A", EACommerceSKU{CommerceSKU: "SKU-1", TotalConsumption: 5}),
+		row(1, "VA1", "DNA Advantage", "DNA-A", EACommerceSKU{CommerceSKU: "SKU-2", TotalConsumption: 3}),
+		row(2, "VA2", "ISE Plus", "ISE-P", EACommerceSKU{CommerceSKU: "SKU-3", TotalConsumption: 7, CommitmentType: "COMMITTED"}),
+	}
+	if got := report.Flatten(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := (&EASmartAccountSubscriptionConsumptionReportResponse{}).Flatten(); got == nil || len(got) != 0 {
+		t.Errorf("empty report: got %v, want an empty slice", got)
+	}
+}
+
+func TestConsumptionByArchitecture(t *testing.T) {
+	// decoded from JSON so that the misspelled vitualAccounts is traversed
+	const fixture = `{"subscriptions": [
+		{"architectureName": "DNA", "accounts": [{"vitualAccounts": [
+			{"suites": [{"totalEntitlements": 100, "totalConsumption": 40}, {"totalEntitlements": 10, "totalConsumption": 12}]},
+			{"suites": [{"totalEntitlements": 5, "totalConsumption": 1}]}
+		]}]},
+		{"architectureName": "Security", "accounts": [{"vitualAccounts": [{"suites": [{"totalEntitlements": 50, "totalConsumption": 50}]}]}]},
+		{"architectureName": "DNA", "accounts": [{"vitualAccounts": [{"suites": [{"totalEntitlements": 20, "totalConsumption": 2}]}]}]},
+		{"architectureName": "", "accounts": [{"vitualAccounts": [{"suites": [{"totalEntitlements": 7, "totalConsumption": 3}]}]}]},
+		{"architectureName": "Collaboration", "accounts": []}
+	]}`
+	var report EASmartAccountSubscriptionConsumptionReportResponse
+	if err := json.Unmarshal([]byte(fixture), &report); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ArchitectureConsumption{
+		"DNA":               {Total: 135, Consumed: 55},
+		"Security":          {Total: 50, Consumed: 50},
+		UnknownArchitecture: {Total: 7, Consumed: 3},
+		"Collaboration":     {},
+	}
+	if got := report.ConsumptionByArchitecture(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetEASmartAccountSubscriptionConsumptionReport(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if want := "/services/api/enterprise-agreements/v1/subscription/account/example.com/subscription/Sub-1/consumption"; r.URL.Path != want {
+			t.Errorf("got path %s, want %s", r.URL.Path, want)
+		}
+		if r.URL.RawQuery != "" {
+			t.Errorf("got query %q, want none", r.URL.RawQuery)
+		}
+		writeJSON(t, w, json.RawMessage(eaReportFixture))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	got, err := c.GetEASmartAccountSubscriptionConsumptionReport("example.com", "Sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Subscriptions) != 1 || got.Subscriptions[0].SubscriptionID != "Sub-1" {
+		t.Errorf("got %+v, want the Sub-1 report", got)
+	}
+}
+
+func TestLowEntitlementSuites(t *testing.T) {
+	const fixture = `{"subscriptions": [{"subscriptionID": "Sub-1", "architectureName": "DNA", "accounts": [{
+		"smartAccountId": 101, "smartAccountName": "Example",
+		"vitualAccounts": [{"virtualAccountId": 1, "virtualAccountName": "VA1", "suites": [
+			{"suiteName": "healthy", "totalEntitlements": 100, "remainingEntitlements": 50},
+			{"suiteName": "few", "totalEntitlements": 1000, "remainingEntitlements": 5},
+			{"suiteName": "low percent", "totalEntitlements": 100, "remainingEntitlements": 15},
+			{"suiteName": "none left", "totalEntitlements": 10, "remainingEntitlements": 0},
+			{"suiteName": "no totals", "totalEntitlements": 0, "remainingEntitlements": 20},
+			{"suiteName": "no totals low", "totalEntitlements": 0, "remainingEntitlements": 2}
+		]}]
+	}]}]}`
+	var report EASmartAccountSubscriptionConsumptionReportResponse
+	if err := json.Unmarshal([]byte(fixture), &report); err != nil {
+		t.Fatal(err)
+	}
+	names := func(rows []EASuiteRow) []string {
+		list := []string{}
+		for _, r := range rows {
+			list = append(list, r.SuiteName)
+		}
+		return list
+	}
+	tests := []struct {
+		minRemaining int
+		minPercent   float64
+		want         []string
+	}{
+		{10, 0, []string{"few", "none left", "no totals low"}},
+		{0, 20, []string{"few", "low percent", "none left"}},
+		{10, 20, []string{"few", "low percent", "none left", "no totals low"}},
+		{0, 0, []string{}},
+	}
+	for _, tt := range tests {
+		if got := names(report.LowEntitlementSuites(tt.minRemaining, tt.minPercent)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d, %v%%: got %v, want %v", tt.minRemaining, tt.minPercent, got, tt.want)
+		}
+	}
+
+	rows := report.LowEntitlementSuites(1, 0)
+	want := EASuiteRow{SubscriptionID: "Sub-1", ArchitectureName: "DNA", SmartAccountID: 101, SmartAccountName: "Example",
+		VirtualAccountID: 1, VirtualAccountName: "VA1", EASuite: report.Subscriptions[0].Accounts[0].VirtualAccounts[0].Suites[3]}
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+
+	if got := (EASuite{}).RemainingPercent(); got != 0 {
+		t.Errorf("no entitlements: got %v%%, want 0", got)
+	}
+	if got := (EASuite{TotalEntitlements: 200, RemainingEntitlements: 50}).RemainingPercent(); got != 25 {
+		t.Errorf("got %v%%, want 25", got)
+	}
+}
+
+func TestEASubscriptionDurations(t *testing.T) {
+	tests := []struct {
+		duration, remaining int
+		term, left          time.Duration
+	}{
+		{1095, 365, 1095 * 24 * time.Hour, 365 * 24 * time.Hour},
+		{1, 0, 24 * time.Hour, 0},
+		{365, -10, 365 * 24 * time.Hour, 0},
+		{0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		s := EASubscription{Duration: tt.duration, RemainingDuration: tt.remaining, DurationInMonths: 36, RemainingDurationInMonths: 12}
+		if got := s.DurationDays(); got != tt.duration {
+			t.Errorf("%d: DurationDays got %d, want %d", tt.duration, got, tt.duration)
+		}
+		if got := s.RemainingDays(); got != tt.remaining {
+			t.Errorf("%d: RemainingDays got %d, want %d", tt.remaining, got, tt.remaining)
+		}
+		if got := s.TermAsDuration(); got != tt.term {
+			t.Errorf("%d: TermAsDuration got %s, want %s", tt.duration, got, tt.term)
+		}
+		if got := s.RemainingAsDuration(); got != tt.left {
+			t.Errorf("%d: RemainingAsDuration got %s, want %s", tt.remaining, got, tt.left)
+		}
+	}
+}
+
+func TestWriteEAReportCSV(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "ea_report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report EASmartAccountSubscriptionConsumptionReportResponse
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteEAReportCSV(&buf, &report); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "ea_report.csv.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.Bytes(), want)
+	}
+
+	// the quoted fields must read back as they were
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || !reflect.DeepEqual(records[0], eaReportCSVHeader) {
+		t.Fatalf("got %d records, want a header and 3 rows", len(records))
+	}
+	if records[1][4] != "Example, Inc." || records[1][6] != `VA "Primary"` || records[2][12] != "End of life.\nUse C9300-DNA-A-3Y instead" {
+		t.Errorf("got %q, want the fields unchanged after quoting", records[1:3])
+	}
+}
+
+func TestWriteEAReportCSVEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEAReportCSV(&buf, &EASmartAccountSubscriptionConsumptionReportResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(eaReportCSVHeader, ",") + "\n"; buf.String() != want {
+		t.Errorf("got %q, want only the header", buf.String())
+	}
+}
+
+func TestGetEASmartAccountSubscriptionConsumptionReportAsOf(t *testing.T) {
+	tests := []struct {
+		asOf time.Time
+		want string
+	}{
+		{time.Time{}, ""},
+		{time.Date(2024, time.March, 5, 23, 30, 0, 0, time.UTC), "asOfDate=2024-03-05"},
+	}
+	for _, tt := range tests {
+		h := func(w http.ResponseWriter, r *http.Request) {
+			if want := "/services/api/enterprise-agreements/v1/subscription/account/example.com/subscription/Sub-1/consumption"; r.URL.Path != want {
+				t.Errorf("got path %s, want %s", r.URL.Path, want)
+			}
+			if r.URL.RawQuery != tt.want {
+				t.Errorf("got query %q, want %q", r.URL.RawQuery, tt.want)
+			}
+			writeJSON(t, w, json.RawMessage(eaReportFixture))
+		}
+		c := newTestClient(t, http.HandlerFunc(h))
+		got, err := c.GetEASmartAccountSubscriptionConsumptionReportAsOf(context.Background(), "example.com", "Sub-1", tt.asOf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Subscriptions) != 1 || got.Subscriptions[0].SubscriptionID != "Sub-1" {
+			t.Errorf("got %+v, want the Sub-1 report", got)
+		}
+	}
+}
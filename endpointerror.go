@@ -0,0 +1,63 @@
+package smartaccounts
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// EndpointError is returned, wrapped in a *RequestIDError, for any failed request to Cisco.  It records the name of
+// the endpoint, e.g. "GetVirtualAccounts", the method and URL, the HTTP status if a response was received, and the
+// number of attempts made including any retries.  Query parameter values are redacted from the URL.  Err holds the
+// underlying error, so errors.Is still matches sentinels such as ErrNotFound.  Use errors.As to retrieve it.
+type EndpointError struct {
+	Operation string
+	Method    string
+	URL       string
+	Status    int
+	Attempts  int
+	Err       error
+}
+
+func (e *EndpointError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%s %s: %s (after %d attempts)", e.Method, e.URL, e.Err, e.Attempts)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
+
+// newEndpointError returns err as an *EndpointError for the request, completing the one returned by doRequest for
+// an unsuccessful status, or wrapping any other error.
+func newEndpointError(req *http.Request, attempts int, err error) *EndpointError {
+	ee, ok := err.(*EndpointError)
+	if !ok {
+		ee = &EndpointError{Err: err}
+	}
+	ee.Operation = requestEndpoint(req)
+	ee.Method = req.Method
+	ee.URL = redactURL(req.URL)
+	ee.Attempts = attempts
+	return ee
+}
+
+// redactURL returns the URL without any user information and with the query parameter values replaced.
+func redactURL(u *url.URL) string {
+	r := *u
+	r.User = nil
+	q, err := url.ParseQuery(r.RawQuery)
+	switch {
+	case err != nil:
+		// a query that doesn't parse can't be redacted key by key
+		r.RawQuery = "REDACTED"
+	case len(q) > 0:
+		for k := range q {
+			q.Set(k, "REDACTED")
+		}
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
@@ -0,0 +1,81 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	apxHost      = "https://apx.cisco.com"
+	swapiHost    = "https://swapi.cisco.com"
+	cloudSSOHost = "https://cloudsso.cisco.com"
+)
+
+// endpoint describes a Cisco API endpoint.  The path may contain %s verbs which are filled, escaped, from the
+// arguments given when building a request.
+type endpoint struct {
+	name   string
+	method string
+	host   string
+	path   string
+}
+
+var (
+	endpointAccounts           = endpoint{"GetAllSmartAccounts", http.MethodGet, swapiHost, "/services/api/smart-accounts-and-licensing/v2/accounts"}
+	endpointAccountsV1         = endpoint{"GetAllSmartAccountsV1", http.MethodGet, swapiHost, "/services/api/smart-accounts-and-licensing/v1/accounts"}
+	endpointSearchAccounts     = endpoint{"SearchSmartAccounts", http.MethodGet, apxHost, "/services/api/smart-accounts-and-licensing/v1/accounts/search"}
+	endpointVirtualAccounts    = endpoint{"GetVirtualAccounts", http.MethodGet, swapiHost, "/services/api/smart-accounts-and-licensing/v1/accounts/%s/customer/virtual-accounts"}
+	endpointLicenses           = endpoint{"GetLicenses", http.MethodPost, apxHost, "/services/api/smart-accounts-and-licensing/v1/accounts/%s/licenses"}
+	endpointSubscriptionSearch = endpoint{"SearchSubscriptions", http.MethodPost, swapiHost, "/services/api/smart-accounts-and-licensing/v1/subscription/search"}
+	endpointEAConsumption      = endpoint{"GetEAConsumptionReport", http.MethodGet, swapiHost, "/services/api/enterprise-agreements/v1/subscription/account/%s/subscription/%s/consumption"}
+	endpointToken              = endpoint{"Token", http.MethodPost, cloudSSOHost, "/as/token.oauth2"}
+)
+
+// url returns the full URL for the endpoint, with the path arguments escaped and the query added.
+func (e endpoint) url(query url.Values, args ...string) string {
+	escaped := make([]interface{}, len(args))
+	for i, a := range args {
+		escaped[i] = url.PathEscape(a)
+	}
+	u := e.host + fmt.Sprintf(e.path, escaped...)
+	if q := query.Encode(); q != "" {
+		u += "?" + q
+	}
+	return u
+}
+
+// newRequest builds a request for the endpoint, marshalling body with the client's codec if it isn't nil.  The
+// endpoint name is recorded on the request so that it can be used to label logs and errors.
+func (c *Client) newRequest(e endpoint, body interface{}, query url.Values, args ...string) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		payload, err := c.marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(payload)
+	}
+	ctx := context.WithValue(context.Background(), endpointKey{}, e.name)
+	return http.NewRequestWithContext(ctx, e.method, e.url(query, args...), r)
+}
+
+type endpointKey struct{}
+
+// withRequestEndpoint returns ctx carrying the endpoint name of req, so that it is kept when the request is sent
+// with a different context.
+func withRequestEndpoint(ctx context.Context, req *http.Request) context.Context {
+	return context.WithValue(ctx, endpointKey{}, requestEndpoint(req))
+}
+
+// requestEndpoint returns the name of the endpoint the request was built for, or "Raw" for requests that
+// weren't built from an endpoint.
+func requestEndpoint(req *http.Request) string {
+	if name, ok := req.Context().Value(endpointKey{}).(string); ok {
+		return name
+	}
+	return "Raw"
+}
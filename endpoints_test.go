@@ -0,0 +1,78 @@
+package smartaccounts
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNewRequest(t *testing.T) {
+	c := newTestClient(t, http.NotFoundHandler())
+	tests := []struct {
+		endpoint endpoint
+		args     []string
+		method   string
+		url      string
+	}{
+		{endpointAccounts, nil, http.MethodGet, "https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v2/accounts"},
+		{endpointAccountsV1, nil, http.MethodGet, "https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts"},
+		{endpointSearchAccounts, nil, http.MethodGet, "https://apx.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts/search"},
+		{endpointVirtualAccounts, []string{"example.com"}, http.MethodGet, "https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts/example.com/customer/virtual-accounts"},
+		{endpointLicenses, []string{"example.com"}, http.MethodPost, "https://apx.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts/example.com/licenses"},
+		{endpointSubscriptionSearch, nil, http.MethodPost, "https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v1/subscription/search"},
+		{endpointEAConsumption, []string{"example.com", "Sub-1"}, http.MethodGet, "https://swapi.cisco.com/services/api/enterprise-agreements/v1/subscription/account/example.com/subscription/Sub-1/consumption"},
+		{endpointToken, nil, http.MethodPost, "https://cloudsso.cisco.com/as/token.oauth2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint.name, func(t *testing.T) {
+			req, err := c.newRequest(tt.endpoint, nil, nil, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Method != tt.method || req.URL.String() != tt.url {
+				t.Errorf("got %s %s, want %s %s", req.Method, req.URL, tt.method, tt.url)
+			}
+			if req.Body != nil {
+				t.Error("got a body, want none")
+			}
+			if got := requestEndpoint(req); got != tt.endpoint.name {
+				t.Errorf("got endpoint %q, want %q", got, tt.endpoint.name)
+			}
+		})
+	}
+}
+
+func TestNewRequestEscapingQueryAndBody(t *testing.T) {
+	c := newTestClient(t, http.NotFoundHandler())
+	req, err := c.newRequest(endpointEAConsumption, nil, url.Values{"b": {"x y"}, "a": {"1"}}, "a/b.com", "Sub 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://swapi.cisco.com/services/api/enterprise-agreements/v1/subscription/account/a%2Fb.com/subscription/Sub%201/consumption?a=1&b=x+y"
+	if got := req.URL.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	req, err = c.newRequest(endpointLicenses, LicenseRequest{Limit: 50, VirtualAccounts: []string{"VA1"}}, nil, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"virtualAccounts":["VA1"],"limit":50,"offset":0}`; string(body) != want {
+		t.Errorf("got body %s, want %s", body, want)
+	}
+}
+
+func TestRequestEndpointRaw(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := requestEndpoint(req); got != "Raw" {
+		t.Errorf("got %q, want Raw", got)
+	}
+}
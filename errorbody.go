@@ -0,0 +1,37 @@
+package smartaccounts
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// maxErrorText is the most of a non JSON error body included in the error.
+const maxErrorText = 512
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// nonJSONErrorText returns the text of an error response body that isn't JSON, such as the HTML page returned by
+// a gateway for a 502 or 504, so that it can be included in the error rather than failing to decode.  HTML tags
+// and repeated whitespace are removed and the text is truncated.  It returns an empty string, leaving the body
+// unread, when the Content-Type is JSON or not set.
+func nonJSONErrorText(res *http.Response) string {
+	ct := strings.ToLower(res.Header.Get("Content-Type"))
+	if ct == "" || strings.Contains(ct, "json") {
+		return ""
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxErrorText*4))
+	if err != nil {
+		return ""
+	}
+	text := string(b)
+	if strings.Contains(ct, "html") {
+		text = htmlTags.ReplaceAllString(text, " ")
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxErrorText {
+		text = text[:maxErrorText] + "..."
+	}
+	return text
+}
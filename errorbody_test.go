@@ -0,0 +1,73 @@
+package smartaccounts
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNonJSONErrorBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        error
+		wantText    string
+	}{
+		{"html gateway", http.StatusBadGateway, "text/html; charset=UTF-8", "<html><head><title>502 Bad Gateway</title></head>\n<body><h1>Bad   Gateway</h1></body></html>", nil, "502 Bad Gateway Bad Gateway"},
+		{"plain text", http.StatusGatewayTimeout, "text/plain", "upstream request timeout\n", nil, "upstream request timeout"},
+		{"html bad request", http.StatusBadRequest, "text/html", "<p>Bad request</p>", ErrBadRequest, "Bad request"},
+		{"html internal error", http.StatusInternalServerError, "text/html", "<b>oops</b>", ErrInternalError, "oops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}
+			c := newTestClient(t, http.HandlerFunc(h))
+			_, err := c.GetVirtualAccounts("example.com")
+			var ee *EndpointError
+			if !errors.As(err, &ee) || ee.Status != tt.status {
+				t.Fatalf("got %v, want an EndpointError with status %d", err, tt.status)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), ": "+tt.wantText+" (") {
+				t.Errorf("got %q, want it to include the text %q", err, tt.wantText)
+			}
+			if strings.Contains(err.Error(), "invalid character") {
+				t.Errorf("got %q, want no JSON decode failure", err)
+			}
+		})
+	}
+}
+
+func TestJSONErrorBodyStillDecoded(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":400001,"message":"No Valid Subscriptions found"}`))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	if _, err := c.GetVirtualAccounts("example.com"); !errors.Is(err, ErrNoSubscriptions) {
+		t.Errorf("got %v, want ErrNoSubscriptions", err)
+	}
+}
+
+func TestNonJSONErrorTextTruncated(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(strings.Repeat("x", 10*maxErrorText)))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	_, err := c.GetVirtualAccounts("example.com")
+	if err == nil || !strings.Contains(err.Error(), ": "+strings.Repeat("x", maxErrorText)+"... (") {
+		t.Errorf("got %v, want the text truncated to %d characters", err, maxErrorText)
+	}
+}
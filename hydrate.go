@@ -0,0 +1,148 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Hydrator retrieves a smart account along with the related details selected with its With methods, e.g.
+//
+//	ha, err := c.Hydrate("example.com").WithLicenses().WithEAReports().Do(ctx)
+//
+// Use Client.Hydrate to create one.
+type Hydrator struct {
+	c             *Client
+	domain        string
+	vas           bool
+	licenses      bool
+	subscriptions bool
+	eaReports     bool
+}
+
+// HydratedAccount represents a smart account along with the details requested from a Hydrator.  The ID, and
+// VirtualAccounts and Licenses fields of Account are populated as requested.  EAReports is keyed by subscription
+// reference ID.
+type HydratedAccount struct {
+	Account       SmartAccount
+	Subscriptions []SubscriptionSearchSubscription
+	EAReports     map[string]*EASmartAccountSubscriptionConsumptionReportResponse
+}
+
+// Hydrate returns a Hydrator for the smart account with the given domain.  No requests are made until Do is called.
+func (c *Client) Hydrate(domain string) *Hydrator {
+	return &Hydrator{c: c, domain: domain}
+}
+
+// WithVirtualAccounts requests the virtual accounts for the smart account.
+func (h *Hydrator) WithVirtualAccounts() *Hydrator {
+	h.vas = true
+	return h
+}
+
+// WithLicenses requests the licenses for each of the virtual accounts, and so implies WithVirtualAccounts.
+func (h *Hydrator) WithLicenses() *Hydrator {
+	h.vas, h.licenses = true, true
+	return h
+}
+
+// WithSubscriptions requests the subscriptions for the smart account.
+func (h *Hydrator) WithSubscriptions() *Hydrator {
+	h.subscriptions = true
+	return h
+}
+
+// WithEAReports requests the EA Consumption Report for each of the subscriptions, and so implies WithSubscriptions.
+// Subscriptions for which Cisco reports no valid subscriptions are skipped.
+func (h *Hydrator) WithEAReports() *Hydrator {
+	h.subscriptions, h.eaReports = true, true
+	return h
+}
+
+// Do retrieves the smart account and the requested details.  The account is found by searching on the domain, and
+// ErrNotFound is returned if it doesn't exist.  The licenses and EA reports are retrieved concurrently, subject to
+// WithConcurrency and the rate limiter.  Should any of the follow up requests fail, the error returned will be a
+// *PartialError keyed by step, e.g. "licenses <virtual account>", along with everything that was retrieved.  Only
+// virtual accounts whose licenses were all retrieved are included in Licenses.
+func (h *Hydrator) Do(ctx context.Context) (_ *HydratedAccount, err error) {
+	defer wrapOp(&err, "Hydrate(%s)", h.domain)
+	c := h.c
+	ctx, cancel := c.methodContext(ctx, "Hydrate")
+	defer cancel()
+	sr, err := c.searchSmartAccountsByDomain(ctx, h.domain)
+	if err != nil {
+		return nil, err
+	}
+	sa, ok := findSearchAccount(sr, h.domain)
+	if !ok {
+		return nil, fmt.Errorf("%w: smart account %s", ErrNotFound, h.domain)
+	}
+	ha := &HydratedAccount{Account: sa.ToSmartAccount()}
+	errs := map[string]error{}
+	var mu sync.Mutex
+	fail := func(step string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[step] = err
+	}
+	if h.vas {
+		vas, err := c.getVirtualAccounts(ctx, h.domain)
+		if err != nil {
+			fail("virtual accounts", err)
+		} else {
+			ha.Account.VirtualAccounts = &vas
+		}
+	}
+	if h.licenses && ha.Account.VirtualAccounts != nil {
+		vas := *ha.Account.VirtualAccounts
+		perVA := make([][]License, len(vas))
+		failed := runBounded(ctx, len(vas), c.concurrency, func(i int) error {
+			return c.eachLicensePage(ctx, h.domain, vas[i].Name, func(lr *LicenseResponse) error {
+				perVA[i] = append(perVA[i], lr.Licenses...)
+				return nil
+			})
+		})
+		licenses := []License{}
+		for i, err := range failed {
+			if err != nil {
+				fail("licenses "+vas[i].Name, err)
+				continue
+			}
+			licenses = append(licenses, perVA[i]...)
+		}
+		SortLicenses(licenses)
+		ha.Account.Licenses = &licenses
+	}
+	if h.subscriptions {
+		ssr, err := c.searchSubscriptions(ctx, sa.ID, h.domain)
+		if err != nil {
+			fail("subscriptions", err)
+		} else {
+			for _, od := range ssr.OfferDetails {
+				ha.Subscriptions = append(ha.Subscriptions, od.Subscriptions...)
+			}
+		}
+	}
+	if h.eaReports {
+		ha.EAReports = map[string]*EASmartAccountSubscriptionConsumptionReportResponse{}
+		ears := make([]*EASmartAccountSubscriptionConsumptionReportResponse, len(ha.Subscriptions))
+		failed := runBounded(ctx, len(ha.Subscriptions), c.concurrency, func(i int) (err error) {
+			ears[i], err = c.getEAConsumptionReport(ctx, h.domain, ha.Subscriptions[i].SubRefID)
+			return err
+		})
+		for i, sub := range ha.Subscriptions {
+			switch {
+			case errors.Is(failed[i], ErrNoSubscriptions):
+			case failed[i] != nil:
+				fail("ea report "+sub.SubRefID, failed[i])
+			default:
+				ha.EAReports[sub.SubRefID] = ears[i]
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return ha, &PartialError{Result: ha, Failures: errs}
+	}
+	return ha, nil
+}
@@ -0,0 +1,109 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// hydrateFake returns a fakeCisco with a single smart account, example.com, with two virtual accounts and three
+// subscriptions, one of which has no EA report.
+func hydrateFake() *fakeCisco {
+	return &fakeCisco{
+		search:   []SearchAccount{{Domain: "example.com", Name: "Example", ID: 101}},
+		vas:      map[string][]VirtualAccount{"example.com": {{Name: "VA1"}, {Name: "VA2"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 2), "VA2": makeLicenses("VA2", 1)},
+		subscriptions: map[int][]SubscriptionSearchSubscription{
+			101: {{SubRefID: "Sub-1"}, {SubRefID: "Sub-2"}, {SubRefID: "Sub-3"}},
+		},
+		reports: map[string]*EASmartAccountSubscriptionConsumptionReportResponse{
+			"example.com/Sub-1": eaReport("Sub-1", 10, 1),
+			"example.com/Sub-2": eaReport("Sub-2", 20, 2),
+		},
+	}
+}
+
+func TestHydrate(t *testing.T) {
+	c := newTestClient(t, hydrateFake().handler(t))
+	ctx := context.Background()
+	account := SmartAccount{ID: 101, AccountDomain: "example.com", AccountName: "Example"}
+	vas := []VirtualAccount{{Name: "VA1"}, {Name: "VA2"}}
+	licenses := append(makeLicenses("VA1", 2), makeLicenses("VA2", 1)...)
+	SortLicenses(licenses)
+	subs := []SubscriptionSearchSubscription{{SubRefID: "Sub-1"}, {SubRefID: "Sub-2"}, {SubRefID: "Sub-3"}}
+	reports := map[string]*EASmartAccountSubscriptionConsumptionReportResponse{"Sub-1": eaReport("Sub-1", 10, 1), "Sub-2": eaReport("Sub-2", 20, 2)}
+
+	withVAs, withLicenses := account, account
+	withVAs.VirtualAccounts = &vas
+	withLicenses.VirtualAccounts, withLicenses.Licenses = &vas, &licenses
+
+	tests := []struct {
+		name string
+		h    *Hydrator
+		want HydratedAccount
+	}{
+		{"account only", c.Hydrate("example.com"), HydratedAccount{Account: account}},
+		{"virtual accounts", c.Hydrate("example.com").WithVirtualAccounts(), HydratedAccount{Account: withVAs}},
+		{"licenses", c.Hydrate("example.com").WithLicenses(), HydratedAccount{Account: withLicenses}},
+		{"subscriptions", c.Hydrate("example.com").WithSubscriptions(), HydratedAccount{Account: account, Subscriptions: subs}},
+		{"ea reports", c.Hydrate("example.com").WithEAReports(), HydratedAccount{Account: account, Subscriptions: subs, EAReports: reports}},
+		{"everything", c.Hydrate("example.com").WithLicenses().WithEAReports(), HydratedAccount{Account: withLicenses, Subscriptions: subs, EAReports: reports}},
+	}
+	for _, tt := range tests {
+		got, err := tt.h.Do(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestHydrateNotFound(t *testing.T) {
+	c := newTestClient(t, hydrateFake().handler(t))
+	if _, err := c.Hydrate("missing.com").WithLicenses().Do(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestHydratePartial(t *testing.T) {
+	f := hydrateFake()
+	f.vas["example.com"] = append(f.vas["example.com"], VirtualAccount{Name: "broken"})
+	f.subscriptions[101] = append(f.subscriptions[101], SubscriptionSearchSubscription{SubRefID: "broken"})
+	c := newTestClient(t, f.handler(t))
+	got, err := c.Hydrate("example.com").WithLicenses().WithEAReports().Do(context.Background())
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(pe.Failures) != 2 {
+		t.Fatalf("got %v, want a *PartialError for two steps", err)
+	}
+	if !errors.Is(pe.Failures["licenses broken"], ErrInternalError) || !errors.Is(pe.Failures["ea report broken"], ErrInternalError) {
+		t.Errorf("got failures %v, want the licenses and EA report for broken", pe.Failures)
+	}
+	if pe.Result != got || got.Account.Licenses == nil || len(*got.Account.Licenses) != 3 || len(got.EAReports) != 2 {
+		t.Errorf("got %+v, want the three licenses and two EA reports that were retrieved", got)
+	}
+}
+
+func TestHydrateOnlyCompleteVirtualAccounts(t *testing.T) {
+	f := hydrateFake()
+	f.vas["example.com"] = append(f.vas["example.com"], VirtualAccount{Name: "VA3"})
+	f.licenses["VA3"] = makeLicenses("VA3", 150)
+	f.failAfterFirstPage = map[string]bool{"VA3": true}
+	c := newTestClient(t, f.handler(t))
+	got, err := c.Hydrate("example.com").WithLicenses().Do(context.Background())
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(pe.Failures) != 1 || !errors.Is(pe.Failures["licenses VA3"], ErrInternalError) {
+		t.Fatalf("got %v, want a *PartialError for the licenses of VA3", err)
+	}
+	for _, l := range *got.Account.Licenses {
+		if l.VirtualAccount == "VA3" {
+			t.Fatalf("got licenses from the first page of VA3, want only complete virtual accounts")
+		}
+	}
+	if n := len(*got.Account.Licenses); n != 3 {
+		t.Errorf("got %d licenses, want the 3 from VA1 and VA2", n)
+	}
+}
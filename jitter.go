@@ -0,0 +1,62 @@
+package smartaccounts
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// WithStartupJitter delays the first request made by the client by a random amount up to max.  This helps to
+// stop a fleet of clients started at the same time from all hitting Cisco at the same instant.  The default
+// is no jitter.
+func WithStartupJitter(max time.Duration) Option {
+	return func(c *Client) {
+		if max > 0 {
+			c.startupJitter = max
+		}
+	}
+}
+
+// WithRequestJitter delays every request by a random amount up to max.  The default is no jitter.
+func WithRequestJitter(max time.Duration) Option {
+	return func(c *Client) {
+		if max > 0 {
+			c.requestJitter = max
+		}
+	}
+}
+
+// WithJitterSeed seeds the random number generator used for jitter so that delays are deterministic.
+func WithJitterSeed(seed int64) Option {
+	return func(c *Client) {
+		c.rng = rand.New(rand.NewSource(seed))
+	}
+}
+
+// jitter returns a random duration in the range [0, max).
+func (c *Client) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	c.rngMu.Lock()
+	defer c.rngMu.Unlock()
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return time.Duration(c.rng.Int63n(int64(max)))
+}
+
+// waitJitter applies the startup jitter on the first request and the request jitter on every request.
+func (c *Client) waitJitter(ctx context.Context) error {
+	var err error
+	c.startupOnce.Do(func() {
+		err = sleepContext(ctx, c.jitter(c.startupJitter))
+	})
+	if err != nil {
+		return err
+	}
+	if c.requestJitter > 0 {
+		return sleepContext(ctx, c.jitter(c.requestJitter))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package smartaccounts
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJitterWithinBounds(t *testing.T) {
+	c := New("id", "secret", "user", "pass", WithJitterSeed(42))
+	max := 50 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if d := c.jitter(max); d < 0 || d >= max {
+			t.Fatalf("got %s, want a delay in [0, %s)", d, max)
+		}
+	}
+	if d := c.jitter(0); d != 0 {
+		t.Errorf("got %s for no jitter, want 0", d)
+	}
+}
+
+func TestJitterSeedIsDeterministic(t *testing.T) {
+	a := New("id", "secret", "user", "pass", WithJitterSeed(7))
+	b := New("id", "secret", "user", "pass", WithJitterSeed(7))
+	for i := 0; i < 10; i++ {
+		if da, db := a.jitter(time.Second), b.jitter(time.Second); da != db {
+			t.Fatalf("draw %d: got %s and %s, want the same delay from the same seed", i, da, db)
+		}
+	}
+}
+
+func TestStartupJitterOnlyDelaysFirstRequest(t *testing.T) {
+	max := 40 * time.Millisecond
+	c := New("id", "secret", "user", "pass", WithStartupJitter(max), WithJitterSeed(1))
+	want := New("id", "secret", "user", "pass", WithJitterSeed(1)).jitter(max)
+	start := time.Now()
+	if err := c.waitJitter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < want || elapsed > max+time.Second {
+		t.Errorf("first wait took %s, want at least %s and within the %s bound", elapsed, want, max)
+	}
+	start = time.Now()
+	if err := c.waitJitter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= max {
+		t.Errorf("second wait took %s, want no startup jitter", elapsed)
+	}
+}
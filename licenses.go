@@ -0,0 +1,667 @@
+package smartaccounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// licensePageLimit is the number of licenses requested per page.
+const licensePageLimit = 100
+
+// GetLicensesPage retrieves a single page of licenses for the given domain and virtual account, starting at offset
+// and containing at most limit licenses.  The TotalRecords field of the response can be used to determine whether
+// more pages remain.  This is useful for callers who want to control pagination themselves, e.g. to resume a
+// long running job; GetSmartLicenseUsage and the other license methods are built on it.
+func (c *Client) GetLicensesPage(ctx context.Context, domain, virtualAccount string, offset, limit int) (_ *LicenseResponse, err error) {
+	defer wrapOp(&err, "GetLicensesPage(%s, %s, %d)", domain, virtualAccount, offset)
+	ctx, cancel := c.methodContext(ctx, "GetLicensesPage")
+	defer cancel()
+	return c.getLicensesPage(ctx, domain, virtualAccount, offset, limit)
+}
+
+// getLicensesPage retrieves a single page of licenses for the given domain and virtual account.
+func (c *Client) getLicensesPage(ctx context.Context, domain, virtualAccount string, offset, limit int) (*LicenseResponse, error) {
+	var lr LicenseResponse
+	err := c.fetchLicensesPage(ctx, domain, virtualAccount, offset, limit, &lr)
+	if err != nil {
+		return nil, err
+	}
+	return &lr, nil
+}
+
+// getLicensesSummaryPage retrieves a single page of licenses without decoding the LicenseSubstitutions and
+// LicenseDetails fields.
+func (c *Client) getLicensesSummaryPage(ctx context.Context, domain, virtualAccount string, offset, limit int) (*LicenseResponse, error) {
+	var sr licenseSummaryResponse
+	err := c.fetchLicensesPage(ctx, domain, virtualAccount, offset, limit, &sr)
+	if err != nil {
+		return nil, err
+	}
+	lr := &LicenseResponse{TotalRecords: sr.TotalRecords, StatusMessage: sr.StatusMessage, Status: sr.Status}
+	lr.Licenses = make([]License, len(sr.Licenses))
+	for i, l := range sr.Licenses {
+		lr.Licenses[i] = l.License
+	}
+	return lr, nil
+}
+
+// fetchLicensesPage requests a single page of licenses, decoding the response into v.  When WithTreat404AsEmpty is
+// set, a 404 leaves v untouched, i.e. an empty page.
+func (c *Client) fetchLicensesPage(ctx context.Context, domain, virtualAccount string, offset, limit int, v interface{}) error {
+	return c.fetchLicenses(ctx, domain, &LicenseRequest{Offset: offset, Limit: limit, VirtualAccounts: []string{virtualAccount}}, v)
+}
+
+// fetchLicenses is as fetchLicensesPage, but sends the provided LicenseRequest.
+func (c *Client) fetchLicenses(ctx context.Context, domain string, lreq *LicenseRequest, v interface{}) error {
+	req, err := c.newRequest(endpointLicenses, lreq, nil, domain)
+	if err != nil {
+		return err
+	}
+	if err := c.makeRequest(ctx, req, v); err != nil && !c.emptyOn404(err) {
+		return err
+	}
+	return nil
+}
+
+// licenseSummaryResponse is used to decode a page of licenses while skipping the heavier nested fields.
+type licenseSummaryResponse struct {
+	TotalRecords  int              `json:"totalRecords"`
+	Licenses      []licenseSummary `json:"licenses"`
+	StatusMessage string           `json:"statusMessage"`
+	Status        string           `json:"status"`
+}
+
+// licenseSummary shadows the nested fields of License so they are skipped rather than decoded.
+type licenseSummary struct {
+	License
+	LicenseSubstitutions skipJSON `json:"licenseSubstitutions"`
+	LicenseDetails       skipJSON `json:"licenseDetails"`
+}
+
+// skipJSON discards whatever JSON value it is decoded from.
+type skipJSON struct{}
+
+func (*skipJSON) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+// eachLicensePage pages through the licenses for the given domain and virtual account, calling fn for each page.
+// Any error from fn or from retrieving a page stops the iteration and is returned, except for a 400 Bad Request
+// for an offset at or beyond the TotalRecords reported by the previous page, which is treated as the end of the data.
+// When WithValidateTotals is set, the number of licenses collected is checked against the TotalRecords reported.
+func (c *Client) eachLicensePage(ctx context.Context, domain, virtualAccount string, fn func(*LicenseResponse) error) error {
+	return c.eachLicensePageWith(ctx, c.getLicensesPage, domain, virtualAccount, fn)
+}
+
+// eachLicensePageWith is as eachLicensePage, but uses the provided function to retrieve each page.
+func (c *Client) eachLicensePageWith(ctx context.Context, getPage func(context.Context, string, string, int, int) (*LicenseResponse, error), domain, virtualAccount string, fn func(*LicenseResponse) error) error {
+	var ferr error
+	err := c.pageLicenses(func(offset, limit int) (int, int, error) {
+		lr, err := getPage(ctx, domain, virtualAccount, offset, limit)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ferr = fn(lr); ferr != nil {
+			return 0, 0, errStopPaging
+		}
+		return len(lr.Licenses), lr.TotalRecords, nil
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// errStopPaging is returned to pageLicenses when the caller's function fails, so that the failure is never
+// mistaken for the end of the data.
+var errStopPaging = errors.New("ccw: stop paging")
+
+// pageLicenses holds the paging rules for licenses, calling fetch for each page in turn until the end of the data.
+// fetch returns the number of licenses on the page and the TotalRecords reported with it.  A 400 Bad Request for an
+// offset at or beyond the TotalRecords reported by the previous page is treated as the end of the data, and when
+// WithValidateTotals is set the number of licenses collected is checked against the TotalRecords reported.
+func (c *Client) pageLicenses(fetch func(offset, limit int) (int, int, error)) error {
+	offset, limit := 0, licensePageLimit
+	collected, total := 0, 0
+	for {
+		n, t, err := fetch(offset, limit)
+		if err != nil {
+			if endOfLicenses(err, offset, total) {
+				return c.validateTotal(collected, total)
+			}
+			return err
+		}
+		collected, total = collected+n, t
+		if total < limit {
+			return c.validateTotal(collected, total)
+		}
+		offset += limit
+		if offset > total {
+			return c.validateTotal(collected, total)
+		}
+	}
+}
+
+// endOfLicenses reports whether err, returned for the page at offset, indicates the end of the data rather than a
+// failure.  Cisco sometimes responds with a 400 rather than an empty page once the offset reaches the end of the
+// records, so a 400 for an offset at or beyond the total reported by the previous page is treated as the end.
+func endOfLicenses(err error, offset, total int) bool {
+	return offset > 0 && offset >= total && errors.Is(err, ErrBadRequest)
+}
+
+// validateTotal checks the number of records collected matches the total reported by Cisco when
+// WithValidateTotals is set.
+func (c *Client) validateTotal(collected, total int) error {
+	if c.validateTotals && collected != total {
+		return fmt.Errorf("%w: collected %d records, expected %d", ErrTotalMismatch, collected, total)
+	}
+	return nil
+}
+
+// WriteLicensesJSONL retrieves the licenses for each of the virtual accounts on the provided SmartAccount, writing
+// each license to w as a single line of JSON as it is retrieved.  If w has a Flush method, it is called after each
+// page.  A failure to retrieve licenses for a virtual account doesn't stop the others being written, instead the
+// failures are returned together as a *PartialError, keyed by virtual account, once all have been attempted.
+func (c *Client) WriteLicensesJSONL(ctx context.Context, w io.Writer, sa SmartAccount) (err error) {
+	defer wrapOp(&err, "WriteLicensesJSONL(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "WriteLicensesJSONL")
+	defer cancel()
+	if sa.VirtualAccounts == nil {
+		return fmt.Errorf("%w for %s", ErrNoVirtualAccounts, sa.AccountDomain)
+	}
+	flusher, _ := w.(interface{ Flush() error })
+	enc := json.NewEncoder(w)
+	failures := map[string]error{}
+	for _, va := range *sa.VirtualAccounts {
+		var werr error
+		err := c.eachLicensePage(ctx, sa.AccountDomain, va.Name, func(lr *LicenseResponse) error {
+			for _, l := range lr.Licenses {
+				if werr = enc.Encode(&l); werr != nil {
+					return werr
+				}
+			}
+			if flusher != nil {
+				werr = flusher.Flush()
+			}
+			return werr
+		})
+		if werr != nil {
+			return werr
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures[va.Name] = err
+		}
+	}
+	if len(failures) > 0 {
+		return &PartialError{Failures: failures}
+	}
+	return nil
+}
+
+// LicensesIterator pages through the licenses for a smart account one license at a time, hiding the details
+// of the pagination.  It is not safe for concurrent use by multiple goroutines.
+type LicensesIterator struct {
+	c        *Client
+	domain   string
+	vas      []string
+	vaIdx    int
+	offset   int
+	total    int
+	lastPage bool
+	page     []License
+	pos      int
+	err      error
+}
+
+// NewLicensesIterator returns a LicensesIterator for the licenses in each of the virtual accounts on the provided
+// SmartAccount.  No requests are made until Next is called.
+func (c *Client) NewLicensesIterator(sa SmartAccount) *LicensesIterator {
+	it := &LicensesIterator{c: c, domain: sa.AccountDomain}
+	if sa.VirtualAccounts != nil {
+		for _, va := range *sa.VirtualAccounts {
+			it.vas = append(it.vas, va.Name)
+		}
+	}
+	return it
+}
+
+// Next returns the next license, fetching further pages as required.  It returns io.EOF, unwrapped so that it can be
+// compared directly, once all licenses have been returned.  Any other error stops the iteration and is returned from
+// all subsequent calls.
+func (it *LicensesIterator) Next(ctx context.Context) (_ License, err error) {
+	defer func() {
+		if err != io.EOF {
+			wrapOp(&err, "LicensesIterator.Next(%s)", it.domain)
+		}
+	}()
+	for it.err == nil {
+		if it.pos < len(it.page) {
+			l := it.page[it.pos]
+			it.pos++
+			return l, nil
+		}
+		if it.lastPage {
+			it.vaIdx++
+			it.offset, it.total, it.lastPage = 0, 0, false
+		}
+		if it.vaIdx >= len(it.vas) {
+			it.err = io.EOF
+			break
+		}
+		pctx, cancel := it.c.methodContext(ctx, "LicensesIterator.Next")
+		lr, err := it.c.getLicensesPage(pctx, it.domain, it.vas[it.vaIdx], it.offset, licensePageLimit)
+		cancel()
+		if err != nil && endOfLicenses(err, it.offset, it.total) {
+			it.lastPage = true
+			continue
+		}
+		if err != nil {
+			it.err = err
+			break
+		}
+		it.page, it.pos, it.total = lr.Licenses, 0, lr.TotalRecords
+		it.offset += licensePageLimit
+		it.lastPage = lr.TotalRecords < licensePageLimit || it.offset > lr.TotalRecords
+	}
+	return License{}, it.err
+}
+
+// GetSmartLicenseUsageSummary returns the licenses for each of the virtual accounts on the provided SmartAccount
+// as GetSmartLicenseUsage does, but without the LicenseSubstitutions and LicenseDetails fields.  Cisco doesn't
+// support selecting fields on the licenses endpoint, so the full payload is still transferred, but those nested
+// fields are skipped when decoding which reduces allocations for large result sets.  The licenses are sorted as by
+// SortLicenses, and if the SmartAccount has no virtual accounts they are retrieved when WithAutoFetchVirtualAccounts
+// is set, otherwise ErrNoVirtualAccounts is returned.  Unlike GetSmartLicenseUsage, failures are returned as a
+// *PartialError, keyed by virtual account, along with the licenses for the virtual accounts retrieved in full.
+func (c *Client) GetSmartLicenseUsageSummary(ctx context.Context, sa SmartAccount) (_ []License, err error) {
+	defer wrapOp(&err, "GetSmartLicenseUsageSummary(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "GetSmartLicenseUsageSummary")
+	defer cancel()
+	licenses, failures, err := c.getVirtualAccountLicenses(ctx, c.getLicensesSummaryPage, sa)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return licenses, &PartialError{Result: licenses, Failures: failures}
+	}
+	return licenses, nil
+}
+
+// GetSmartLicenseUsageByName returns the licenses with the given names, e.g. a specific SKU, for each of the
+// virtual accounts on the provided SmartAccount.  The names are sent to Cisco in the licenses field of the
+// LicenseRequest, but as the licenses endpoint doesn't document a filter by name, the licenses are also filtered
+// here, and those whose name matches, ignoring case, are returned either way.  With no names no filter is sent and
+// all licenses are returned.  If the SmartAccount has no virtual accounts they are retrieved when
+// WithAutoFetchVirtualAccounts is set, otherwise ErrNoVirtualAccounts is returned.  Should the licenses for any
+// virtual account not be retrieved in full, the failures are returned as a *PartialError, keyed by virtual account,
+// along with the matching licenses from the rest.
+func (c *Client) GetSmartLicenseUsageByName(ctx context.Context, sa SmartAccount, names []string) (_ []License, err error) {
+	defer wrapOp(&err, "GetSmartLicenseUsageByName(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "GetSmartLicenseUsageByName")
+	defer cancel()
+	getPage := func(ctx context.Context, domain, virtualAccount string, offset, limit int) (*LicenseResponse, error) {
+		var lr LicenseResponse
+		lreq := &LicenseRequest{Offset: offset, Limit: limit, VirtualAccounts: []string{virtualAccount}, Licenses: names}
+		if err := c.fetchLicenses(ctx, domain, lreq, &lr); err != nil {
+			return nil, err
+		}
+		return &lr, nil
+	}
+	licenses, failures, err := c.getVirtualAccountLicenses(ctx, getPage, sa)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		wanted := map[string]bool{}
+		for _, n := range names {
+			wanted[strings.ToLower(n)] = true
+		}
+		matched := []License{}
+		for _, l := range licenses {
+			if wanted[strings.ToLower(l.License)] {
+				matched = append(matched, l)
+			}
+		}
+		licenses = matched
+	}
+	if len(failures) > 0 {
+		return licenses, &PartialError{Result: licenses, Failures: failures}
+	}
+	return licenses, nil
+}
+
+// GetLicensesForDomain retrieves the virtual accounts for the domain and then the licenses for each of them
+// concurrently, subject to WithConcurrency and the rate limiter.  Each license has its VirtualAccount set to the
+// virtual account it was retrieved for, should Cisco not include it, and the licenses are sorted as by
+// SortLicenses.  Failures for individual virtual accounts are returned as a *PartialError keyed by virtual account,
+// along with the licenses for the rest, so only virtual accounts retrieved in full are included.
+func (c *Client) GetLicensesForDomain(ctx context.Context, domain string) (_ []License, err error) {
+	defer wrapOp(&err, "GetLicensesForDomain(%s)", domain)
+	ctx, cancel := c.methodContext(ctx, "GetLicensesForDomain")
+	defer cancel()
+	licenses, failures, err := c.getLicensesForDomain(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return licenses, &PartialError{Result: licenses, Failures: failures}
+	}
+	return licenses, nil
+}
+
+// getLicensesForDomain retrieves the licenses for every virtual account in the domain, returning the failures for
+// individual virtual accounts keyed by name.  An error is only returned if the virtual accounts can't be retrieved.
+func (c *Client) getLicensesForDomain(ctx context.Context, domain string) ([]License, map[string]error, error) {
+	vas, err := c.getVirtualAccounts(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make([][]License, len(vas))
+	failed := runBounded(ctx, len(vas), c.concurrency, func(i int) error {
+		return c.eachLicensePage(ctx, domain, vas[i].Name, func(lr *LicenseResponse) error {
+			for _, l := range lr.Licenses {
+				if l.VirtualAccount == "" {
+					l.VirtualAccount = vas[i].Name
+				}
+				found[i] = append(found[i], l)
+			}
+			return nil
+		})
+	})
+	licenses := []License{}
+	failures := map[string]error{}
+	for i, va := range vas {
+		if failed[i] != nil {
+			failures[va.Name] = failed[i]
+			continue
+		}
+		licenses = append(licenses, found[i]...)
+	}
+	SortLicenses(licenses)
+	return licenses, failures, nil
+}
+
+// getVirtualAccountLicenses retrieves the licenses for each of the virtual accounts on the provided SmartAccount in
+// turn, using getPage for each page, and returns them sorted as by SortLicenses.  Only virtual accounts whose
+// licenses were all retrieved are included, the failures for any others being returned keyed by virtual account.
+// If the SmartAccount has no virtual accounts they are retrieved when WithAutoFetchVirtualAccounts is set,
+// otherwise ErrNoVirtualAccounts is returned.
+func (c *Client) getVirtualAccountLicenses(ctx context.Context, getPage func(context.Context, string, string, int, int) (*LicenseResponse, error), sa SmartAccount) ([]License, map[string]error, error) {
+	if sa.VirtualAccounts == nil {
+		if !c.autoFetchVAs {
+			return nil, nil, fmt.Errorf("%w for %s", ErrNoVirtualAccounts, sa.AccountDomain)
+		}
+		vas, err := c.getVirtualAccounts(ctx, sa.AccountDomain)
+		if err != nil {
+			return nil, nil, err
+		}
+		sa.VirtualAccounts = &vas
+	}
+	licenses := []License{}
+	failures := map[string]error{}
+	for _, va := range *sa.VirtualAccounts {
+		var found []License
+		err := c.eachLicensePageWith(ctx, getPage, sa.AccountDomain, va.Name, func(lr *LicenseResponse) error {
+			found = append(found, lr.Licenses...)
+			return nil
+		})
+		if err != nil {
+			failures[va.Name] = err
+			continue
+		}
+		licenses = append(licenses, found...)
+	}
+	SortLicenses(licenses)
+	return licenses, failures, nil
+}
+
+// DistinctVirtualAccounts returns the sorted, unique VirtualAccount names from the provided licenses.  Empty names
+// are ignored.
+func DistinctVirtualAccounts(licenses []License) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, l := range licenses {
+		if l.VirtualAccount == "" || seen[l.VirtualAccount] {
+			continue
+		}
+		seen[l.VirtualAccount] = true
+		names = append(names, l.VirtualAccount)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpiringWithin returns the licenses that have at least one license detail with an EndDate between now and now plus
+// within.  Details that are PERPETUAL, have no EndDate, or have already expired are ignored.  An EndDate without a
+// time of day is taken to be the end of that day, so a license ending today is expiring rather than expired.
+func ExpiringWithin(licenses []License, within time.Duration) []License {
+	now := time.Now().UTC()
+	cutoff := now.Add(within)
+	expiring := []License{}
+	for _, l := range licenses {
+		for _, d := range l.LicenseDetails {
+			if strings.EqualFold(d.LicenseType, "PERPETUAL") {
+				continue
+			}
+			end, ok := parseEndDate(d.EndDate)
+			if !ok || end.Before(now) || end.After(cutoff) {
+				continue
+			}
+			expiring = append(expiring, l)
+			break
+		}
+	}
+	return expiring
+}
+
+// SortLicenses sorts the licenses in place by VirtualAccount and then License, giving a stable order for
+// comparisons and output.
+func SortLicenses(licenses []License) {
+	sort.SliceStable(licenses, func(i, j int) bool {
+		if licenses[i].VirtualAccount != licenses[j].VirtualAccount {
+			return licenses[i].VirtualAccount < licenses[j].VirtualAccount
+		}
+		return licenses[i].License < licenses[j].License
+	})
+}
+
+// Overconsumed returns the licenses where InUse exceeds Available, or Available is negative.
+func Overconsumed(licenses []License) []License {
+	over := []License{}
+	for _, l := range licenses {
+		if l.InUse > l.Available || l.Available < 0 {
+			over = append(over, l)
+		}
+	}
+	return over
+}
+
+// UtilizationPercent returns InUse as a percentage of Quantity, which may exceed 100 when the license is
+// overconsumed, and 0 when InUse is zero or negative.  The percentage is undefined when there is no Quantity, in
+// which case it returns 0 and false.
+func (l License) UtilizationPercent() (float64, bool) {
+	if l.Quantity <= 0 {
+		return 0, false
+	}
+	if l.InUse <= 0 {
+		return 0, true
+	}
+	return float64(l.InUse) / float64(l.Quantity) * 100, true
+}
+
+// UtilizedAbove returns the licenses whose UtilizationPercent is at or above the given percentage.  Licenses without
+// any Quantity are included when they are in use, as they are overconsumed however many are in use, and otherwise
+// treated as 0% utilized.
+func UtilizedAbove(licenses []License, percent float64) []License {
+	above := []License{}
+	for _, l := range licenses {
+		p, ok := l.UtilizationPercent()
+		if (!ok && l.InUse > 0) || p >= percent {
+			above = append(above, l)
+		}
+	}
+	return above
+}
+
+// GetOverconsumedLicenses retrieves the licenses for the provided SmartAccount and returns only those that are
+// overconsumed, as per Overconsumed.  Should the licenses for any virtual account not be retrieved in full, the
+// failures are returned as a *PartialError, keyed by virtual account, along with the overconsumed licenses from
+// the rest.
+func (c *Client) GetOverconsumedLicenses(ctx context.Context, sa SmartAccount) (_ []License, err error) {
+	defer wrapOp(&err, "GetOverconsumedLicenses(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "GetOverconsumedLicenses")
+	defer cancel()
+	licenses, failures, err := c.getVirtualAccountLicenses(ctx, c.getLicensesPage, sa)
+	if err != nil {
+		return nil, err
+	}
+	over := Overconsumed(licenses)
+	if len(failures) > 0 {
+		return over, &PartialError{Result: over, Failures: failures}
+	}
+	return over, nil
+}
+
+// MergeLicenses combines licenses with the same License name, e.g. the same license across virtual accounts, into
+// a single license.  Quantity, InUse, Available, Reserved and PendingQuantity are summed, LicenseDetails are
+// concatenated, and substitutions of the same license and type have their SubstitutedQuantity summed.  The
+// VirtualAccount of a merged license is the sorted, comma separated list of the virtual accounts it came from, and
+// the remaining fields are taken from the first license seen.  Licenses are returned in the order first seen.
+func MergeLicenses(licenses []License) []License {
+	merged := []License{}
+	index := map[string]int{}
+	vas := map[string][]string{}
+	for _, l := range licenses {
+		i, ok := index[l.License]
+		if !ok {
+			index[l.License] = len(merged)
+			m := l
+			m.LicenseDetails = append([]LicenseDetail(nil), l.LicenseDetails...)
+			m.LicenseSubstitutions = mergeSubstitutions(nil, l.LicenseSubstitutions)
+			merged = append(merged, m)
+			vas[l.License] = appendUnique(nil, l.VirtualAccount)
+			continue
+		}
+		m := &merged[i]
+		m.Quantity += l.Quantity
+		m.InUse += l.InUse
+		m.Available += l.Available
+		m.Reserved += l.Reserved
+		m.PendingQuantity += l.PendingQuantity
+		m.LicenseDetails = append(m.LicenseDetails, l.LicenseDetails...)
+		m.LicenseSubstitutions = mergeSubstitutions(m.LicenseSubstitutions, l.LicenseSubstitutions)
+		vas[l.License] = appendUnique(vas[l.License], l.VirtualAccount)
+	}
+	for i := range merged {
+		names := vas[merged[i].License]
+		sort.Strings(names)
+		merged[i].VirtualAccount = strings.Join(names, ",")
+	}
+	return merged
+}
+
+// mergeSubstitutions adds the substitutions to existing, summing the quantity of any that match on
+// LicenseName, SubstitutedLicense and SubstitutionType.
+func mergeSubstitutions(existing, subs []LicenseSubstitution) []LicenseSubstitution {
+	for _, s := range subs {
+		found := false
+		for i := range existing {
+			e := &existing[i]
+			if e.LicenseName == s.LicenseName && e.SubstitutedLicense == s.SubstitutedLicense && e.SubstitutionType == s.SubstitutionType {
+				e.SubstitutedQuantity += s.SubstitutedQuantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing = append(existing, s)
+		}
+	}
+	return existing
+}
+
+// appendUnique appends s to list if it isn't empty or already present.
+func appendUnique(list []string, s string) []string {
+	if s == "" {
+		return list
+	}
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// BillingTypeTotals represents license totals split by BillingType.  Licenses with an empty or unrecognised
+// BillingType are included in Other.
+type BillingTypeTotals struct {
+	Prepaid LicenseTotals
+	Usage   LicenseTotals
+	Other   LicenseTotals
+}
+
+// TotalsByBillingType sums the quantities of the licenses separately for PREPAID and USAGE billing types.  The
+// comparison ignores case.
+func TotalsByBillingType(licenses []License) BillingTypeTotals {
+	var t BillingTypeTotals
+	for _, l := range licenses {
+		switch strings.ToUpper(strings.TrimSpace(l.BillingType)) {
+		case "PREPAID":
+			t.Prepaid.Add(l)
+		case "USAGE":
+			t.Usage.Add(l)
+		default:
+			t.Other.Add(l)
+		}
+	}
+	return t
+}
+
+// SubstitutionDiscrepancy describes an inconsistency found by CheckSubstitutions.  Index is the position of the
+// substitution in LicenseSubstitutions, or -1 when the discrepancy concerns the substitutions as a whole.
+type SubstitutionDiscrepancy struct {
+	License        string
+	VirtualAccount string
+	Index          int
+	Reason         string
+}
+
+// CheckSubstitutions checks the LicenseSubstitutions of the license are consistent with its totals, returning any
+// discrepancies found.  A substitution is flagged if its SubstitutedQuantity is negative or it doesn't name the
+// SubstitutedLicense, and the substitutions as a whole are flagged if their total SubstitutedQuantity exceeds the
+// license Quantity, or its InUse, as substituted licenses are counted as in use.  A license without substitutions
+// has no discrepancies.
+func CheckSubstitutions(l License) []SubstitutionDiscrepancy {
+	found := []SubstitutionDiscrepancy{}
+	flag := func(index int, format string, args ...interface{}) {
+		found = append(found, SubstitutionDiscrepancy{License: l.License, VirtualAccount: l.VirtualAccount, Index: index, Reason: fmt.Sprintf(format, args...)})
+	}
+	total := 0
+	for i, s := range l.LicenseSubstitutions {
+		if s.SubstitutedQuantity < 0 {
+			flag(i, "negative substituted quantity %d", s.SubstitutedQuantity)
+		} else {
+			total += s.SubstitutedQuantity
+		}
+		if strings.TrimSpace(s.SubstitutedLicense) == "" {
+			flag(i, "no substituted license")
+		}
+	}
+	if total > l.Quantity {
+		flag(-1, "total substituted quantity %d exceeds quantity %d", total, l.Quantity)
+	}
+	if total > l.InUse {
+		flag(-1, "total substituted quantity %d exceeds in use %d", total, l.InUse)
+	}
+	return found
+}
@@ -0,0 +1,828 @@
+package smartaccounts
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// makeLicenses returns n licenses for the virtual account, named L000 onwards.
+func makeLicenses(va string, n int) []License {
+	licenses := make([]License, n)
+	for i := range licenses {
+		licenses[i] = License{License: fmt.Sprintf("L%03d", i), VirtualAccount: va, Quantity: 10, InUse: i % 10, Available: 10 - i%10}
+	}
+	return licenses
+}
+
+// licensesHandler serves the licenses for each virtual account a page at a time, as per the offset and limit in
+// the request.  Virtual accounts not in the map fail with a 500.
+func licensesHandler(t testing.TB, licenses map[string][]License) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lreq LicenseRequest
+		if err := json.NewDecoder(r.Body).Decode(&lreq); err != nil || len(lreq.VirtualAccounts) != 1 {
+			t.Errorf("invalid license request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		all, ok := licenses[lreq.VirtualAccounts[0]]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		start, end := lreq.Offset, lreq.Offset+lreq.Limit
+		if start > len(all) {
+			start = len(all)
+		}
+		if end > len(all) {
+			end = len(all)
+		}
+		writeJSON(t, w, LicenseResponse{TotalRecords: len(all), Licenses: all[start:end], Status: "SUCCESS"})
+	}
+}
+
+// smartAccountWith returns a SmartAccount for example.com with the named virtual accounts.
+func smartAccountWith(vas ...string) SmartAccount {
+	list := []VirtualAccount{}
+	for _, va := range vas {
+		list = append(list, VirtualAccount{Name: va})
+	}
+	return SmartAccount{AccountDomain: "example.com", VirtualAccounts: &list}
+}
+
+func TestWriteLicensesJSONL(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{
+		"VA1": makeLicenses("VA1", 150),
+		"VA2": makeLicenses("VA2", 3),
+	}))
+	var buf bytes.Buffer
+	if err := c.WriteLicensesJSONL(context.Background(), &buf, smartAccountWith("VA1", "VA2")); err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var l License
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v", lines+1, err)
+		}
+		lines++
+	}
+	if lines != 153 {
+		t.Errorf("got %d lines, want 153", lines)
+	}
+}
+
+func TestWriteLicensesJSONLPartialFailure(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 2)}))
+	var buf bytes.Buffer
+	err := c.WriteLicensesJSONL(context.Background(), &buf, smartAccountWith("VA1", "broken"))
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a *PartialError", err)
+	}
+	if _, ok := pe.Failures["broken"]; !ok || len(pe.Failures) != 1 {
+		t.Errorf("got failures %v, want only broken", pe.Failures)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 2 {
+		t.Errorf("got %d lines, want 2", n)
+	}
+}
+
+func TestLicensesIterator(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{
+		"VA1": makeLicenses("VA1", 250),
+		"VA2": {},
+		"VA3": makeLicenses("VA3", 3),
+	}))
+	it := c.NewLicensesIterator(smartAccountWith("VA1", "VA2", "VA3"))
+	counts := map[string]int{}
+	for {
+		l, err := it.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[l.VirtualAccount]++
+	}
+	if counts["VA1"] != 250 || counts["VA3"] != 3 || len(counts) != 2 {
+		t.Errorf("got %v, want 250 from VA1 and 3 from VA3", counts)
+	}
+	if _, err := it.Next(context.Background()); err != io.EOF {
+		t.Errorf("got %v after exhaustion, want io.EOF", err)
+	}
+}
+
+func TestLicensesIteratorError(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 1)}))
+	it := c.NewLicensesIterator(smartAccountWith("VA1", "broken"))
+	if _, err := it.Next(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := it.Next(context.Background())
+		if !errors.Is(err, ErrInternalError) {
+			t.Fatalf("call %d: got %v, want ErrInternalError", i, err)
+		}
+		if !strings.HasPrefix(err.Error(), "LicensesIterator.Next(example.com): ") {
+			t.Errorf("call %d: got %q, want it labelled with the operation", i, err)
+		}
+	}
+}
+
+func TestLicensesIteratorCancelled(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 1)}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.NewLicensesIterator(smartAccountWith("VA1")).Next(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestHydrateLicenses(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{
+		"VA1": makeLicenses("VA1", 120),
+		"VA2": makeLicenses("VA2", 2),
+	}))
+	sa := smartAccountWith("VA2", "VA1")
+	if sa.Licenses != nil {
+		t.Fatal("Licenses populated before hydration")
+	}
+	if err := c.HydrateLicenses(context.Background(), &sa); err != nil {
+		t.Fatal(err)
+	}
+	if sa.Licenses == nil || len(*sa.Licenses) != 122 {
+		t.Fatalf("got %v, want 122 licenses across both virtual accounts", sa.Licenses)
+	}
+	if got := DistinctVirtualAccounts(*sa.Licenses); !reflect.DeepEqual(got, []string{"VA1", "VA2"}) {
+		t.Errorf("got virtual accounts %v, want VA1 and VA2", got)
+	}
+}
+
+func TestHydrateLicensesWithoutVirtualAccounts(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, nil))
+	sa := SmartAccount{AccountDomain: "example.com"}
+	if err := c.HydrateLicenses(context.Background(), &sa); !errors.Is(err, ErrNoVirtualAccounts) {
+		t.Errorf("got %v, want ErrNoVirtualAccounts", err)
+	}
+	if sa.Licenses != nil {
+		t.Errorf("got %v, want Licenses left nil", sa.Licenses)
+	}
+}
+
+func TestValidateTotals(t *testing.T) {
+	lying := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, LicenseResponse{TotalRecords: 5, Licenses: makeLicenses("VA1", 3)})
+	}
+
+	c := newTestClient(t, http.HandlerFunc(lying))
+	if _, err := c.GetSmartLicenseUsageSummary(context.Background(), smartAccountWith("VA1")); err != nil {
+		t.Errorf("without validation: got %v, want nil", err)
+	}
+
+	c = newTestClient(t, http.HandlerFunc(lying), WithValidateTotals(true))
+	_, err := c.GetSmartLicenseUsageSummary(context.Background(), smartAccountWith("VA1"))
+	var pe *PartialError
+	if !errors.As(err, &pe) || !errors.Is(pe.Failures["VA1"], ErrTotalMismatch) {
+		t.Errorf("with validation: got %v, want ErrTotalMismatch for VA1", err)
+	}
+
+	c = newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 200)}), WithValidateTotals(true))
+	if _, err := c.GetSmartLicenseUsageSummary(context.Background(), smartAccountWith("VA1")); err != nil {
+		t.Errorf("honest server: got %v, want nil", err)
+	}
+}
+
+func TestValidateTotalsSearch(t *testing.T) {
+	lying := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, SearchResponse{TotalRecords: 10, Accounts: []SearchAccount{{Domain: "example.com"}}})
+	}
+	c := newTestClient(t, http.HandlerFunc(lying), WithValidateTotals(true))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); !errors.Is(err, ErrTotalMismatch) {
+		t.Errorf("got %v, want ErrTotalMismatch", err)
+	}
+}
+
+func TestGetSmartLicenseUsageSummarySkipsNestedFields(t *testing.T) {
+	full := makeLicenses("VA1", 2)
+	for i := range full {
+		full[i].LicenseDetails = []LicenseDetail{{LicenseType: "TERM", Quantity: 1}}
+		full[i].LicenseSubstitutions = []LicenseSubstitution{{LicenseName: "X", SubstitutedQuantity: 1}}
+		full[i].BillingType = "PREPAID"
+	}
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": full}))
+	got, err := c.GetSmartLicenseUsageSummary(context.Background(), smartAccountWith("VA1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(full) {
+		t.Fatalf("got %d licenses, want %d", len(got), len(full))
+	}
+	for i, l := range got {
+		if l.LicenseDetails != nil || l.LicenseSubstitutions != nil {
+			t.Errorf("license %d: got nested fields %v %v, want them skipped", i, l.LicenseDetails, l.LicenseSubstitutions)
+		}
+		want := full[i]
+		want.LicenseDetails, want.LicenseSubstitutions = nil, nil
+		if !reflect.DeepEqual(l, want) {
+			t.Errorf("license %d: got %+v, want %+v", i, l, want)
+		}
+	}
+}
+
+func TestDistinctVirtualAccounts(t *testing.T) {
+	licenses := []License{{VirtualAccount: "VA2"}, {VirtualAccount: "VA1"}, {VirtualAccount: ""}, {VirtualAccount: "VA2"}, {VirtualAccount: "VA1"}}
+	if got, want := DistinctVirtualAccounts(licenses), []string{"VA1", "VA2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, in := range [][]License{nil, {}, {{VirtualAccount: ""}}} {
+		if got := DistinctVirtualAccounts(in); got == nil || len(got) != 0 {
+			t.Errorf("%v: got %v, want an empty slice", in, got)
+		}
+	}
+}
+
+func TestExpiringWithin(t *testing.T) {
+	license := func(name string, details ...LicenseDetail) License {
+		return License{License: name, LicenseDetails: details}
+	}
+	term := func(end string) LicenseDetail {
+		return LicenseDetail{LicenseType: "TERM", EndDate: end}
+	}
+	licenses := []License{
+		license("soon", term(dateFromToday(10))),
+		license("today", term(dateFromToday(0))),
+		license("later", term(dateFromToday(60))),
+		license("expired", term(dateFromToday(-1))),
+		license("perpetual", LicenseDetail{LicenseType: "PERPETUAL", EndDate: dateFromToday(5)}),
+		license("no-end", term("")),
+		license("bad-end", term("soon")),
+		license("mixed", LicenseDetail{LicenseType: "PERPETUAL"}, term(dateFromToday(-30)), term(dateFromToday(20))),
+		license("no-details"),
+	}
+	var got []string
+	for _, l := range ExpiringWithin(licenses, 30*24*time.Hour) {
+		got = append(got, l.License)
+	}
+	if want := []string{"soon", "today", "mixed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := ExpiringWithin(nil, time.Hour); got == nil || len(got) != 0 {
+		t.Errorf("no licenses: got %v, want an empty slice", got)
+	}
+}
+
+func TestGetSmartLicenseUsageOrdering(t *testing.T) {
+	shuffled := []License{{License: "L2", VirtualAccount: "VA2"}, {License: "L1", VirtualAccount: "VA2"}, {License: "L3", VirtualAccount: "VA2"}}
+	c := newTestClient(t, licensesHandler(t, map[string][]License{
+		"VA1": {{License: "L9", VirtualAccount: "VA1"}, {License: "L0", VirtualAccount: "VA1"}},
+		"VA2": shuffled,
+	}))
+	want := []License{
+		{License: "L0", VirtualAccount: "VA1"}, {License: "L9", VirtualAccount: "VA1"},
+		{License: "L1", VirtualAccount: "VA2"}, {License: "L2", VirtualAccount: "VA2"}, {License: "L3", VirtualAccount: "VA2"},
+	}
+	for i := 0; i < 5; i++ {
+		got, err := c.GetSmartLicenseUsage(smartAccountWith("VA2", "VA1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Fatalf("run %d: got %v, want %v", i, *got, want)
+		}
+	}
+}
+
+func TestSortLicensesStable(t *testing.T) {
+	licenses := []License{
+		{License: "L1", VirtualAccount: "VA1", Status: "first"},
+		{License: "L0", VirtualAccount: "VA2"},
+		{License: "L1", VirtualAccount: "VA1", Status: "second"},
+		{License: "L0", VirtualAccount: "VA1"},
+	}
+	SortLicenses(licenses)
+	var got []string
+	for _, l := range licenses {
+		got = append(got, l.VirtualAccount+"/"+l.License+l.Status)
+	}
+	if want := []string{"VA1/L0", "VA1/L1first", "VA1/L1second", "VA2/L0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetSmartLicenseUsageAutoFetch(t *testing.T) {
+	var vaCalls counter
+	f := &fakeCisco{
+		vas:      map[string][]VirtualAccount{"example.com": {{Name: "VA1"}, {Name: "VA2"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 2), "VA2": makeLicenses("VA2", 1)},
+	}
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/virtual-accounts") {
+			vaCalls.inc()
+		}
+		f.handler(t)(w, r)
+	}
+	nilVAs := SmartAccount{AccountDomain: "example.com"}
+
+	c := newTestClient(t, http.HandlerFunc(h))
+	if _, err := c.GetSmartLicenseUsage(nilVAs); !errors.Is(err, ErrNoVirtualAccounts) {
+		t.Errorf("strict, nil: got %v, want ErrNoVirtualAccounts", err)
+	}
+
+	c = newTestClient(t, http.HandlerFunc(h), WithAutoFetchVirtualAccounts(true))
+	licenses, err := c.GetSmartLicenseUsage(nilVAs)
+	if err != nil || len(*licenses) != 3 {
+		t.Fatalf("auto, nil: got %v, %v, want the licenses for both virtual accounts", licenses, err)
+	}
+	if vaCalls.get() != 1 {
+		t.Errorf("auto, nil: got %d virtual account requests, want 1", vaCalls.get())
+	}
+
+	licenses, err = c.GetSmartLicenseUsage(smartAccountWith("VA1"))
+	if err != nil || len(*licenses) != 2 {
+		t.Fatalf("auto, populated: got %v, %v, want the licenses for VA1", licenses, err)
+	}
+	if vaCalls.get() != 1 {
+		t.Errorf("auto, populated: got %d virtual account requests, want none made", vaCalls.get()-1)
+	}
+}
+
+func TestGetOverconsumedLicenses(t *testing.T) {
+	va1 := []License{
+		{License: "normal", VirtualAccount: "VA1", Quantity: 10, InUse: 5, Available: 5},
+		{License: "full", VirtualAccount: "VA1", Quantity: 10, InUse: 10, Available: 10},
+		{License: "over", VirtualAccount: "VA1", Quantity: 10, InUse: 12, Available: 10},
+		{License: "negative", VirtualAccount: "VA1", Quantity: 10, InUse: 0, Available: -2},
+	}
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": va1, "VA2": {{License: "over2", VirtualAccount: "VA2", InUse: 3, Available: 1}}}))
+
+	got, err := c.GetOverconsumedLicenses(context.Background(), smartAccountWith("VA1", "VA2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, l := range got {
+		names = append(names, l.License)
+	}
+	if want := []string{"negative", "over", "over2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	got, err = c.GetOverconsumedLicenses(context.Background(), smartAccountWith("VA1", "broken"))
+	var pe *PartialError
+	if !errors.As(err, &pe) || !errors.Is(pe.Failures["broken"], ErrInternalError) || len(pe.Failures) != 1 {
+		t.Fatalf("got %v, want a *PartialError for the broken virtual account", err)
+	}
+	if len(got) != 2 || !reflect.DeepEqual(pe.Result, got) {
+		t.Errorf("got %v, want the two overconsumed licenses from VA1", got)
+	}
+}
+
+func TestMergeLicenses(t *testing.T) {
+	sub := func(qty int) []LicenseSubstitution {
+		return []LicenseSubstitution{{LicenseName: "A", SubstitutedLicense: "B", SubstitutionType: "UPGRADE", SubstitutedQuantity: qty}}
+	}
+	in := []License{
+		{License: "A", VirtualAccount: "VA2", Status: "first", Quantity: 10, InUse: 4, Available: 6, Reserved: 1, PendingQuantity: 2,
+			LicenseDetails: []LicenseDetail{{SubscriptionID: "Sub-1", Quantity: 10}}, LicenseSubstitutions: sub(3)},
+		{License: "B", VirtualAccount: "VA1", Quantity: 5, InUse: 5},
+		{License: "A", VirtualAccount: "VA1", Status: "second", Quantity: 20, InUse: 25, Available: -5, Reserved: 2, PendingQuantity: 3,
+			LicenseDetails:       []LicenseDetail{{SubscriptionID: "Sub-2", Quantity: 20}},
+			LicenseSubstitutions: append(sub(4), LicenseSubstitution{LicenseName: "A", SubstitutedLicense: "B", SubstitutionType: "DOWNGRADE", SubstitutedQuantity: 1})},
+		{License: "A", VirtualAccount: "VA2", Quantity: 1, InUse: 1},
+		{License: "B", Quantity: 2, Available: 2},
+	}
+	want := []License{
+		{License: "A", VirtualAccount: "VA1,VA2", Status: "first", Quantity: 31, InUse: 30, Available: 1, Reserved: 3, PendingQuantity: 5,
+			LicenseDetails:       []LicenseDetail{{SubscriptionID: "Sub-1", Quantity: 10}, {SubscriptionID: "Sub-2", Quantity: 20}},
+			LicenseSubstitutions: append(sub(7), LicenseSubstitution{LicenseName: "A", SubstitutedLicense: "B", SubstitutionType: "DOWNGRADE", SubstitutedQuantity: 1})},
+		{License: "B", VirtualAccount: "VA1", Quantity: 7, InUse: 5, Available: 2},
+	}
+	got := MergeLicenses(in)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if in[0].Quantity != 10 || in[0].LicenseSubstitutions[0].SubstitutedQuantity != 3 || len(in[0].LicenseDetails) != 1 {
+		t.Errorf("the input licenses were modified: %+v", in[0])
+	}
+	if got := MergeLicenses(nil); got == nil || len(got) != 0 {
+		t.Errorf("nil: got %v, want an empty slice", got)
+	}
+}
+
+func TestGetLicensesPage(t *testing.T) {
+	var got LicenseRequest
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if want := "/services/api/smart-accounts-and-licensing/v1/accounts/example.com/licenses"; r.Method != http.MethodPost || r.URL.Path != want {
+			t.Errorf("got %s %s, want POST %s", r.Method, r.URL.Path, want)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		all := makeLicenses("VA1", 120)
+		writeJSON(t, w, LicenseResponse{TotalRecords: len(all), Licenses: all[got.Offset : got.Offset+got.Limit], Status: "SUCCESS"})
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	lr, err := c.GetLicensesPage(context.Background(), "example.com", "VA1", 50, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (LicenseRequest{VirtualAccounts: []string{"VA1"}, Offset: 50, Limit: 25}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got request %+v, want %+v", got, want)
+	}
+	if lr.TotalRecords != 120 || len(lr.Licenses) != 25 || lr.Licenses[0].License != "L050" || lr.Status != "SUCCESS" {
+		t.Errorf("got %d of %d licenses starting at %s, want 25 of 120 starting at L050", len(lr.Licenses), lr.TotalRecords, lr.Licenses[0].License)
+	}
+}
+
+// offsetLimitHandler serves the licenses a page at a time like licensesHandler, but responds with a 400 Bad
+// Request, as Cisco sometimes does, for an offset at or beyond the end of the records or equal to badOffset.
+func offsetLimitHandler(t testing.TB, all []License, badOffset int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lreq LicenseRequest
+		if err := json.NewDecoder(r.Body).Decode(&lreq); err != nil {
+			t.Error(err)
+		}
+		if lreq.Offset >= len(all) || lreq.Offset == badOffset {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"ERROR","statusMessage":"Invalid offset"}`))
+			return
+		}
+		end := lreq.Offset + lreq.Limit
+		if end > len(all) {
+			end = len(all)
+		}
+		writeJSON(t, w, LicenseResponse{TotalRecords: len(all), Licenses: all[lreq.Offset:end], Status: "SUCCESS"})
+	}
+}
+
+func TestLicensePagingEndsOnOverLargeOffset(t *testing.T) {
+	// 200 licenses fill two pages exactly, so a third page is requested at offset 200
+	all := makeLicenses("VA1", 200)
+	c := newTestClient(t, offsetLimitHandler(t, all, -1), WithValidateTotals(true))
+	sa := smartAccountWith("VA1")
+
+	got, err := c.GetSmartLicenseUsage(sa)
+	if err != nil || len(*got) != 200 {
+		t.Fatalf("GetSmartLicenseUsage: got %v, want 200 licenses and no error", err)
+	}
+
+	n := 0
+	if err := c.StreamLicenses(context.Background(), sa, func(License) error { n++; return nil }); err != nil || n != 200 {
+		t.Errorf("StreamLicenses: got %d licenses and %v, want 200 and no error", n, err)
+	}
+
+	n = 0
+	it := c.NewLicensesIterator(sa)
+	for {
+		_, err := it.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("LicensesIterator: got %v after %d licenses", err, n)
+		}
+		n++
+	}
+	if n != 200 {
+		t.Errorf("LicensesIterator: got %d licenses, want 200", n)
+	}
+}
+
+func TestLicensePagingBadRequest(t *testing.T) {
+	// a 400 for the first page, or for an offset within the records, is a real error
+	for _, bad := range []int{0, 100} {
+		c := newTestClient(t, offsetLimitHandler(t, makeLicenses("VA1", 250), bad))
+		err := c.StreamLicenses(context.Background(), smartAccountWith("VA1"), func(License) error { return nil })
+		if !errors.Is(err, ErrBadRequest) {
+			t.Errorf("bad request at offset %d: got %v, want ErrBadRequest", bad, err)
+		}
+	}
+}
+
+func TestUtilizationPercent(t *testing.T) {
+	tests := []struct {
+		quantity, inUse int
+		want            float64
+		ok              bool
+	}{
+		{100, 50, 50, true},
+		{100, 100, 100, true},
+		{10, 15, 150, true},
+		{4, 1, 25, true},
+		{100, 0, 0, true},
+		{100, -5, 0, true},
+		{0, 0, 0, false},
+		{-10, 0, 0, false},
+		{0, 5, 0, false},
+		{-10, 5, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := (License{Quantity: tt.quantity, InUse: tt.inUse}).UtilizationPercent()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%d of %d: got %v, %v, want %v, %v", tt.inUse, tt.quantity, got, ok, tt.want, tt.ok)
+		}
+		if math.IsInf(got, 0) || math.IsNaN(got) {
+			t.Errorf("%d of %d: got %v, want a finite percentage", tt.inUse, tt.quantity, got)
+		}
+	}
+}
+
+func TestUtilizedAbove(t *testing.T) {
+	licenses := []License{
+		{License: "half", Quantity: 100, InUse: 50},
+		{License: "most", Quantity: 100, InUse: 80},
+		{License: "over", Quantity: 10, InUse: 12},
+		{License: "unused", Quantity: 10},
+		{License: "no quantity", InUse: 3},
+		{License: "negative quantity", Quantity: -1, InUse: 1},
+		{License: "nothing"},
+	}
+	names := func(ls []License) []string {
+		list := []string{}
+		for _, l := range ls {
+			list = append(list, l.License)
+		}
+		return list
+	}
+	tests := []struct {
+		percent float64
+		want    []string
+	}{
+		{80, []string{"most", "over", "no quantity", "negative quantity"}},
+		{100, []string{"over", "no quantity", "negative quantity"}},
+		{1000, []string{"no quantity", "negative quantity"}},
+		{0, []string{"half", "most", "over", "unused", "no quantity", "negative quantity", "nothing"}},
+		{-1, []string{"half", "most", "over", "unused", "no quantity", "negative quantity", "nothing"}},
+	}
+	for _, tt := range tests {
+		if got := names(UtilizedAbove(licenses, tt.percent)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v%%: got %v, want %v", tt.percent, got, tt.want)
+		}
+	}
+	if got := UtilizedAbove(nil, 50); got == nil || len(got) != 0 {
+		t.Errorf("nil: got %v, want an empty slice", got)
+	}
+}
+
+func TestGetSmartLicenseUsageByName(t *testing.T) {
+	f := &fakeCisco{
+		vas: map[string][]VirtualAccount{"example.com": {{Name: "VA1"}, {Name: "VA2"}, {Name: "half"}}},
+		licenses: map[string][]License{
+			"VA1":  makeLicenses("VA1", 150),
+			"VA2":  makeLicenses("VA2", 3),
+			"half": makeLicenses("half", 150),
+		},
+		failAfterFirstPage: map[string]bool{"half": true},
+	}
+	fake := f.handler(t)
+	var mu sync.Mutex
+	var filters []json.RawMessage
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/licenses") {
+			body, _ := io.ReadAll(r.Body)
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Errorf("got request %s: %v", body, err)
+			}
+			mu.Lock()
+			filters = append(filters, fields["licenses"])
+			mu.Unlock()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		fake(w, r)
+	}
+	sentFilters := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		list := []string{}
+		for _, f := range filters {
+			list = append(list, string(f))
+		}
+		filters = nil
+		return list
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	ctx := context.Background()
+
+	// Cisco may ignore the filter, so the licenses are matched here regardless
+	got, err := c.GetSmartLicenseUsageByName(ctx, smartAccountWith("VA1", "VA2"), []string{"l001", "L120", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []License{f.licenses["VA1"][1], f.licenses["VA1"][120], f.licenses["VA2"][1]}
+	SortLicenses(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	filter := `["l001","L120","missing"]`
+	if got, want := sentFilters(), []string{filter, filter, filter}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got licenses filters %v for the 3 pages, want %v", got, want)
+	}
+
+	// with no names the filter is left out of the request
+	if got, err := c.GetSmartLicenseUsageByName(ctx, smartAccountWith("VA2"), nil); err != nil || len(got) != 3 {
+		t.Errorf("no names: got %d licenses and %v, want all 3", len(got), err)
+	}
+	if got := sentFilters(); !reflect.DeepEqual(got, []string{""}) {
+		t.Errorf("no names: got licenses filters %v, want none", got)
+	}
+
+	// only virtual accounts retrieved in full are included
+	got, err = c.GetSmartLicenseUsageByName(ctx, smartAccountWith("VA2", "half"), []string{"L001"})
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(pe.Failures) != 1 || !errors.Is(pe.Failures["half"], ErrInternalError) {
+		t.Fatalf("got %v, want a *PartialError for half", err)
+	}
+	if len(got) != 1 || got[0].VirtualAccount != "VA2" || !reflect.DeepEqual(pe.Result, got) {
+		t.Errorf("got %+v, want only L001 from VA2", got)
+	}
+
+	// the virtual accounts are only retrieved when WithAutoFetchVirtualAccounts is set
+	sa := SmartAccount{AccountDomain: "example.com"}
+	if _, err := c.GetSmartLicenseUsageByName(ctx, sa, []string{"L002"}); !errors.Is(err, ErrNoVirtualAccounts) {
+		t.Errorf("no virtual accounts: got %v, want ErrNoVirtualAccounts", err)
+	}
+	c = newTestClient(t, http.HandlerFunc(h), WithAutoFetchVirtualAccounts(true))
+	got, err = c.GetSmartLicenseUsageByName(ctx, sa, []string{"L002"})
+	if !errors.As(err, &pe) || len(got) != 2 {
+		t.Errorf("auto fetch: got %+v and %v, want L002 from VA1 and VA2 and a failure for half", got, err)
+	}
+}
+
+func TestTotalsByBillingType(t *testing.T) {
+	licenses := []License{
+		{BillingType: "PREPAID", Quantity: 10, InUse: 4, Available: 6, Reserved: 1},
+		{BillingType: "prepaid ", Quantity: 5, InUse: 5, PendingQuantity: 2},
+		{BillingType: "USAGE", Quantity: 0, InUse: 7, Available: -7},
+		{BillingType: "", Quantity: 3, InUse: 1, Available: 2},
+		{BillingType: "SUBSCRIPTION", Quantity: 1, Available: 1},
+	}
+	want := BillingTypeTotals{
+		Prepaid: LicenseTotals{Licenses: 2, Quantity: 15, InUse: 9, Available: 6, Reserved: 1, PendingQuantity: 2},
+		Usage:   LicenseTotals{Licenses: 1, InUse: 7, Available: -7},
+		Other:   LicenseTotals{Licenses: 2, Quantity: 4, InUse: 1, Available: 3},
+	}
+	if got := TotalsByBillingType(licenses); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := TotalsByBillingType(nil); got != (BillingTypeTotals{}) {
+		t.Errorf("nil: got %+v, want zero totals", got)
+	}
+}
+
+func TestGetLicensesForDomain(t *testing.T) {
+	// VA2's licenses don't say which virtual account they belong to
+	f := &fakeCisco{
+		vas: map[string][]VirtualAccount{
+			"example.com": {{Name: "VA2"}, {Name: "VA1"}},
+			"partial.com": {{Name: "VA1"}, {Name: "BIG"}},
+		},
+		licenses:           map[string][]License{"VA1": makeLicenses("VA1", 250), "VA2": makeLicenses("", 3), "BIG": makeLicenses("BIG", 150)},
+		failAfterFirstPage: map[string]bool{"BIG": true},
+	}
+	var mu sync.Mutex
+	pages, inFlight, maxInFlight := 0, 0, 0
+	fake := f.handler(t)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/licenses") {
+			fake(w, r)
+			return
+		}
+		mu.Lock()
+		pages++
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		fake(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithConcurrency(2))
+
+	got, err := c.GetLicensesForDomain(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(makeLicenses("VA1", 250), makeLicenses("VA2", 3)...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d licenses, want all 250 for VA1 then 3 attributed to VA2, sorted", len(got))
+	}
+	if pages != 4 {
+		t.Errorf("got %d license pages, want 3 for VA1 and 1 for VA2", pages)
+	}
+	if maxInFlight != 2 {
+		t.Errorf("got at most %d license requests in flight, want 2", maxInFlight)
+	}
+
+	got, err = c.GetLicensesForDomain(context.Background(), "partial.com")
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(pe.Failures) != 1 || pe.Failures["BIG"] == nil {
+		t.Fatalf("got %v, want a PartialError for BIG", err)
+	}
+	if !reflect.DeepEqual(got, makeLicenses("VA1", 250)) || !reflect.DeepEqual(pe.Result, got) {
+		t.Errorf("got %d licenses, want only those for the complete VA1", len(got))
+	}
+
+	if got, err := c.GetLicensesForDomain(context.Background(), "unknown.com"); !errors.Is(err, ErrInternalError) || got != nil {
+		t.Errorf("discovery failure: got %v, %v, want ErrInternalError", got, err)
+	}
+}
+
+func TestCheckSubstitutions(t *testing.T) {
+	sub := func(name string, qty int) LicenseSubstitution {
+		return LicenseSubstitution{LicenseName: "DNA Essentials", SubstitutedLicense: name, SubstitutedQuantity: qty, SubstitutionType: "BORROWED"}
+	}
+	tests := []struct {
+		name string
+		l    License
+		want []SubstitutionDiscrepancy
+	}{
+		{"no substitutions", License{License: "DNA Essentials", Quantity: 10}, []SubstitutionDiscrepancy{}},
+		{"consistent", License{License: "DNA Essentials", Quantity: 10, InUse: 12, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", 2), sub("DNA Premier", 8),
+		}}, []SubstitutionDiscrepancy{}},
+		{"zero quantity", License{License: "DNA Essentials", Quantity: 10, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", 0),
+		}}, []SubstitutionDiscrepancy{}},
+		{"negative and unnamed", License{License: "DNA Essentials", VirtualAccount: "VA1", Quantity: 10, InUse: 2, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", -3), sub(" ", 2),
+		}}, []SubstitutionDiscrepancy{
+			{License: "DNA Essentials", VirtualAccount: "VA1", Index: 0, Reason: "negative substituted quantity -3"},
+			{License: "DNA Essentials", VirtualAccount: "VA1", Index: 1, Reason: "no substituted license"},
+		}},
+		{"exceeds quantity", License{License: "DNA Essentials", VirtualAccount: "VA1", Quantity: 5, InUse: 7, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", 4), sub("DNA Premier", 3),
+		}}, []SubstitutionDiscrepancy{
+			{License: "DNA Essentials", VirtualAccount: "VA1", Index: -1, Reason: "total substituted quantity 7 exceeds quantity 5"},
+		}},
+		{"negative excluded from total", License{License: "DNA Essentials", Quantity: 5, InUse: 5, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", 5), sub("DNA Premier", -10),
+		}}, []SubstitutionDiscrepancy{
+			{License: "DNA Essentials", Index: 1, Reason: "negative substituted quantity -10"},
+		}},
+		{"exceeds in use", License{License: "DNA Essentials", VirtualAccount: "VA1", Quantity: 10, InUse: 3, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", 2), sub("DNA Premier", 2),
+		}}, []SubstitutionDiscrepancy{
+			{License: "DNA Essentials", VirtualAccount: "VA1", Index: -1, Reason: "total substituted quantity 4 exceeds in use 3"},
+		}},
+		{"exceeds both", License{License: "DNA Essentials", Quantity: 2, InUse: 1, LicenseSubstitutions: []LicenseSubstitution{
+			sub("DNA Advantage", 3),
+		}}, []SubstitutionDiscrepancy{
+			{License: "DNA Essentials", Index: -1, Reason: "total substituted quantity 3 exceeds quantity 2"},
+			{License: "DNA Essentials", Index: -1, Reason: "total substituted quantity 3 exceeds in use 1"},
+		}},
+	}
+	for _, tt := range tests {
+		if got := CheckSubstitutions(tt.l); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetSmartLicenseUsageSummarySharedBehaviour(t *testing.T) {
+	f := &fakeCisco{
+		vas: map[string][]VirtualAccount{"example.com": {{Name: "VA2"}, {Name: "VA1"}, {Name: "BIG"}}},
+		licenses: map[string][]License{
+			"VA1": makeLicenses("VA1", 2),
+			"VA2": {{License: "B", VirtualAccount: "VA2"}, {License: "A", VirtualAccount: "VA2"}},
+			"BIG": makeLicenses("BIG", 150),
+		},
+		failAfterFirstPage: map[string]bool{"BIG": true},
+	}
+	sa := SmartAccount{AccountDomain: "example.com"}
+
+	c := newTestClient(t, f.handler(t))
+	if _, err := c.GetSmartLicenseUsageSummary(context.Background(), sa); !errors.Is(err, ErrNoVirtualAccounts) {
+		t.Errorf("without auto fetch: got %v, want ErrNoVirtualAccounts", err)
+	}
+
+	c = newTestClient(t, f.handler(t), WithAutoFetchVirtualAccounts(true))
+	got, err := c.GetSmartLicenseUsageSummary(context.Background(), sa)
+	var pe *PartialError
+	if !errors.As(err, &pe) || len(pe.Failures) != 1 || pe.Failures["BIG"] == nil {
+		t.Fatalf("got %v, want a PartialError for BIG", err)
+	}
+	want := append(makeLicenses("VA1", 2), License{License: "A", VirtualAccount: "VA2"}, License{License: "B", VirtualAccount: "VA2"})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want the complete virtual accounts sorted %+v", got, want)
+	}
+}
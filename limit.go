@@ -0,0 +1,44 @@
+package smartaccounts
+
+import "io"
+
+// WithResponseSizeLimit limits the size of response bodies the client will read to n bytes, returning
+// ErrResponseTooLarge for anything bigger.  This protects against a broad search or misbehaving endpoint
+// exhausting memory.  The default is no limit.
+func WithResponseSizeLimit(n int64) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.responseSizeLimit = n
+		}
+	}
+}
+
+// limitBody wraps the response body so that reading more than the configured limit returns ErrResponseTooLarge.
+func (c *Client) limitBody(body io.ReadCloser) io.ReadCloser {
+	if c.responseSizeLimit <= 0 {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, remaining: c.responseSizeLimit}
+}
+
+// limitedBody is like io.LimitReader, but returns an error rather than io.EOF when the limit is exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	// allow reading one byte past the limit so we know it has been exceeded
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	return n, err
+}
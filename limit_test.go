@@ -0,0 +1,44 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWithResponseSizeLimit(t *testing.T) {
+	name := strings.Repeat("x", 4096)
+	h := searchHandler(t, SearchAccount{Domain: "example.com", Name: name})
+
+	c := newTestClient(t, h, WithResponseSizeLimit(1024))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("over the limit: got %v, want ErrResponseTooLarge", err)
+	}
+
+	c = newTestClient(t, h, WithResponseSizeLimit(8192))
+	res, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Accounts) != 1 || res.Accounts[0].Name != name {
+		t.Errorf("under the limit: got %+v, want the account", res)
+	}
+}
+
+func TestLimitedBodyExact(t *testing.T) {
+	c := &Client{responseSizeLimit: 5}
+	for _, tt := range []struct {
+		body    string
+		wantErr bool
+	}{{"", false}, {"12345", false}, {"123456", true}} {
+		got, err := io.ReadAll(c.limitBody(io.NopCloser(strings.NewReader(tt.body))))
+		if errors.Is(err, ErrResponseTooLarge) != tt.wantErr {
+			t.Errorf("%q: got %v, want too large %v", tt.body, err, tt.wantErr)
+		}
+		if !tt.wantErr && string(got) != tt.body {
+			t.Errorf("%q: got %q", tt.body, got)
+		}
+	}
+}
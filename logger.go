@@ -0,0 +1,62 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Logger receives structured log records from the client.  The keyvals alternate between string keys and their
+// values, which matches the arguments accepted by slog and go-kit/log, so either can be adapted with a LoggerFunc.
+// Records emitted during a request include the "request_id" sent to Cisco and the "endpoint" name.
+type Logger interface {
+	Log(ctx context.Context, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts a function to the Logger interface, e.g.
+//
+//	smartaccounts.LoggerFunc(func(ctx context.Context, msg string, kv ...interface{}) { slog.InfoContext(ctx, msg, kv...) })
+type LoggerFunc func(ctx context.Context, msg string, keyvals ...interface{})
+
+// Log calls f.
+func (f LoggerFunc) Log(ctx context.Context, msg string, keyvals ...interface{}) {
+	f(ctx, msg, keyvals...)
+}
+
+// WithLogger sets the Logger used to record each request attempt and failures that are otherwise only logged with
+// the standard log package.  The default is no structured logging.
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// logAttempt records a single attempt of a request along with its request ID, endpoint and any error.
+func (c *Client) logAttempt(ctx context.Context, req *http.Request, attempt int, err error) {
+	if c.logger == nil {
+		return
+	}
+	kv := []interface{}{
+		"request_id", req.Header.Get(c.requestIDHeader),
+		"endpoint", requestEndpoint(req),
+		"method", req.Method,
+		"attempt", attempt + 1,
+	}
+	if err != nil {
+		c.logger.Log(ctx, "request failed", append(kv, "error", err)...)
+		return
+	}
+	c.logger.Log(ctx, "request succeeded", kv...)
+}
+
+// logError records err with the given message and fields, adding the request ID if err carries one.
+func (c *Client) logError(ctx context.Context, msg string, err error, keyvals ...interface{}) {
+	if c.logger == nil {
+		return
+	}
+	var rerr *RequestIDError
+	if errors.As(err, &rerr) {
+		keyvals = append(keyvals, "request_id", rerr.RequestID)
+	}
+	c.logger.Log(ctx, msg, append(keyvals, "error", err)...)
+}
@@ -0,0 +1,93 @@
+package smartaccounts
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// logRecord is a record captured by recordingLogger, with its keyvals as a map.
+type logRecord struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger captures the records logged by a client.
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) Log(_ context.Context, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := logRecord{msg: msg, fields: map[string]interface{}{}}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		r.fields[keyvals[i].(string)] = keyvals[i+1]
+	}
+	l.records = append(l.records, r)
+}
+
+func TestLoggerRequestFields(t *testing.T) {
+	var sent []string
+	var mu sync.Mutex
+	h := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent = append(sent, r.Header.Get(defaultRequestIDHeader))
+		mu.Unlock()
+		if r.URL.Query().Get("name") == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		searchHandler(t, SearchAccount{Name: "Example"})(w, r)
+	}
+	logger := &recordingLogger{}
+	c := newTestClient(t, http.HandlerFunc(h), WithLogger(logger))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "fail"); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+
+	if len(logger.records) != 2 || len(sent) != 2 {
+		t.Fatalf("got %d records for %d requests, want 2 of each", len(logger.records), len(sent))
+	}
+	for i, want := range []string{"request succeeded", "request failed"} {
+		r := logger.records[i]
+		if r.msg != want {
+			t.Errorf("record %d: got %q, want %q", i, r.msg, want)
+		}
+		if r.fields["request_id"] != sent[i] || sent[i] == "" {
+			t.Errorf("record %d: got request_id %v, want %q as sent to Cisco", i, r.fields["request_id"], sent[i])
+		}
+		if r.fields["endpoint"] != endpointSearchAccounts.name || r.fields["method"] != http.MethodGet || r.fields["attempt"] != 1 {
+			t.Errorf("record %d: got fields %v, want the endpoint, method and attempt", i, r.fields)
+		}
+	}
+	if _, ok := logger.records[1].fields["error"]; !ok {
+		t.Error("got no error field for the failed request")
+	}
+}
+
+func TestLoggerLicenseFailure(t *testing.T) {
+	logger := &recordingLogger{}
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 1)}), WithLogger(logger))
+	if _, err := c.GetSmartLicenseUsage(smartAccountWith("VA1", "broken")); err != nil {
+		t.Fatal(err)
+	}
+	var found *logRecord
+	for i := range logger.records {
+		if logger.records[i].msg == "error retrieving licenses" {
+			found = &logger.records[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("got records %v, want one for the broken virtual account", logger.records)
+	}
+	f := found.fields
+	if f["virtual_account"] != "broken" || f["domain"] != "example.com" || f["endpoint"] != endpointLicenses.name || f["request_id"] == "" || f["request_id"] == nil {
+		t.Errorf("got fields %v, want the virtual account, domain, endpoint and request ID", f)
+	}
+}
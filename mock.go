@@ -0,0 +1,86 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewMockFromDir returns a Client that serves responses from fixture files in dir rather than calling Cisco, so
+// that tests can exercise the real decoding without a server.  Each endpoint is served from a file named after
+// the endpoint, e.g. GetAllSmartAccounts.json, GetVirtualAccounts.json, SearchSmartAccounts.json, GetLicenses.json,
+// SearchSubscriptions.json and GetEAConsumptionReport.json.  A missing fixture results in a 404.
+//
+// Errors can be injected for an endpoint with a file named after it with a .status extension containing the
+// status code to respond with, e.g. GetLicenses.status containing 500.  The .json file, if present, is then used
+// as the error body.  No token is requested and rate limiting is disabled, though the options can still be
+// used to configure the client as for New, except that ErrTransportConflict is returned for options that set the
+// HTTPClient's transport, as the fixtures are served by one.
+func NewMockFromDir(dir string, opts ...Option) (*Client, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("ccw: mock fixtures %s is not a directory", dir)
+	}
+	var conflict bool
+	opts = append([]Option{WithFixedToken("mock"), WithoutRateLimiting()}, opts...)
+	opts = append(opts, withFakeTransport(&mockTransport{dir: dir}, &conflict))
+	c := New("mock", "mock", "mock", "mock", opts...)
+	if conflict {
+		return nil, ErrTransportConflict
+	}
+	return c, nil
+}
+
+// withFakeTransport installs rt as the transport for HTTPClient, so that New wires it up as it would any other,
+// e.g. wrapping it with WithRecorder.  It must be the last option, and if an earlier option has already set a
+// transport, which rt would replace, conflict is set instead.  HTTPClient is copied rather than modified, as an
+// option may have set it to a client shared elsewhere.
+func withFakeTransport(rt http.RoundTripper, conflict *bool) Option {
+	return func(c *Client) {
+		if c.HTTPClient.Transport != nil {
+			*conflict = true
+			return
+		}
+		hc := *c.HTTPClient
+		hc.Transport = rt
+		c.HTTPClient = &hc
+	}
+}
+
+// mockTransport serves fixture files keyed by endpoint name.
+type mockTransport struct {
+	dir string
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := requestEndpoint(req)
+	status := http.StatusOK
+	if b, err := os.ReadFile(filepath.Join(t.dir, name+".status")); err == nil {
+		if status, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+			return nil, fmt.Errorf("ccw: invalid mock status for %s: %w", name, err)
+		}
+	}
+	body, err := os.ReadFile(filepath.Join(t.dir, name+".json"))
+	if err != nil && status == http.StatusOK {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFixtures writes each of the named fixtures to a temporary directory and returns it.
+func writeFixtures(t *testing.T, fixtures map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestNewMockFromDir(t *testing.T) {
+	dir := writeFixtures(t, map[string]string{
+		"GetAllSmartAccounts.json":      `{"accounts": [{"accountDomain": "example.com", "accountName": "Example"}], "status": "SUCCESS"}`,
+		"GetVirtualAccounts.json":       `{"virtualAccounts": [{"name": "VA1"}, {"name": "VA2"}], "status": "SUCCESS"}`,
+		"GetLicenses.json":              `{"totalRecords": 1, "licenses": [{"license": "L1", "virtualAccount": "VA1", "quantity": 10, "inUse": 4}], "status": "SUCCESS"}`,
+		"SearchSubscriptions.status":    "500\n",
+		"GetEAConsumptionReport.status": "400",
+		"GetEAConsumptionReport.json":   `{"code":400001,"message":"No Valid Subscriptions found","severity":"ERROR"}`,
+	})
+	c, err := NewMockFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := c.GetAllSmartAccounts()
+	if err != nil || !reflect.DeepEqual(accounts, []SmartAccount{{AccountDomain: "example.com", AccountName: "Example"}}) {
+		t.Errorf("GetAllSmartAccounts: got %+v, %v", accounts, err)
+	}
+	vas, err := c.GetVirtualAccounts("example.com")
+	if err != nil || !reflect.DeepEqual(vas, []VirtualAccount{{Name: "VA1"}, {Name: "VA2"}}) {
+		t.Errorf("GetVirtualAccounts: got %+v, %v", vas, err)
+	}
+	lr, err := c.GetLicensesPage(context.Background(), "example.com", "VA1", 0, 100)
+	if err != nil || lr.TotalRecords != 1 || lr.Licenses[0].License != "L1" || lr.Licenses[0].InUse != 4 {
+		t.Errorf("GetLicensesPage: got %+v, %v", lr, err)
+	}
+
+	// injected errors are returned as they would be from Cisco
+	if _, err := c.SearchSubscriptions(101, "example.com"); !errors.Is(err, ErrInternalError) {
+		t.Errorf("SearchSubscriptions: got %v, want ErrInternalError", err)
+	}
+	if _, err := c.GetEASmartAccountSubscriptionConsumptionReport("example.com", "Sub-1"); !errors.Is(err, ErrNoSubscriptions) {
+		t.Errorf("GetEASmartAccountSubscriptionConsumptionReport: got %v, want ErrNoSubscriptions", err)
+	}
+	// endpoints without a fixture aren't found
+	if _, err := c.SearchSmartAccountsByDomain("example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SearchSmartAccountsByDomain: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewMockFromDirInvalid(t *testing.T) {
+	if _, err := NewMockFromDir(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing: got %v, want os.ErrNotExist", err)
+	}
+	dir := writeFixtures(t, map[string]string{"file": "", "GetAllSmartAccounts.status": "oops"})
+	if _, err := NewMockFromDir(filepath.Join(dir, "file")); err == nil {
+		t.Error("file: got nil, want an error")
+	}
+	c, err := NewMockFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetAllSmartAccounts(); err == nil {
+		t.Error("invalid status: got nil, want an error")
+	}
+}
+
+func TestNewMockFromDirOptions(t *testing.T) {
+	dir := writeFixtures(t, map[string]string{
+		"GetVirtualAccounts.json": `{"virtualAccounts": [{"name": "VA1"}], "status": "SUCCESS"}`,
+	})
+
+	// the fixtures are served through the recorder rather than replacing it
+	var rec bytes.Buffer
+	shared := &http.Client{Timeout: time.Minute}
+	c, err := NewMockFromDir(dir, WithRecorder(&rec), func(c *Client) { c.HTTPClient = shared })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vas, err := c.GetVirtualAccounts("example.com"); err != nil || len(vas) != 1 {
+		t.Fatalf("GetVirtualAccounts: got %+v, %v", vas, err)
+	}
+	var in Interaction
+	if err := json.Unmarshal(rec.Bytes(), &in); err != nil || in.Endpoint != "GetVirtualAccounts" || !strings.Contains(string(in.ResponseBody), "VA1") {
+		t.Errorf("got recording %q, %v, want the fixture response", rec.String(), err)
+	}
+	if shared.Transport != nil {
+		t.Errorf("got the shared client's transport set to %T, want it left alone", shared.Transport)
+	}
+
+	if _, err := NewMockFromDir(dir, withTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("unused")
+	}))); !errors.Is(err, ErrTransportConflict) {
+		t.Errorf("with a transport: got %v, want ErrTransportConflict", err)
+	}
+}
@@ -0,0 +1,50 @@
+package smartaccounts
+
+import (
+	"net/http"
+	"sync"
+)
+
+// WithIfModifiedSince enables sending If-Modified-Since on GET requests, such as GetAllSmartAccounts and
+// GetVirtualAccounts, using the Last-Modified value from the previous response for the same URL.  Should Cisco
+// respond with 304 Not Modified, and the response isn't available from a ResponseCache, ErrNotModified is
+// returned so that scheduled jobs can skip reprocessing unchanged data.  The default is off.
+func WithIfModifiedSince(enabled bool) Option {
+	return func(c *Client) {
+		if enabled {
+			c.lastModified = &lastModifiedStore{values: map[string]string{}}
+		} else {
+			c.lastModified = nil
+		}
+	}
+}
+
+// lastModifiedStore holds the Last-Modified values for previously requested URLs.
+type lastModifiedStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// setIfModifiedSince adds the If-Modified-Since header to GET requests when enabled and a previous value is known.
+func (c *Client) setIfModifiedSince(req *http.Request) {
+	if c.lastModified == nil || req.Method != http.MethodGet {
+		return
+	}
+	c.lastModified.mu.Lock()
+	defer c.lastModified.mu.Unlock()
+	if v, ok := c.lastModified.values[req.URL.String()]; ok {
+		req.Header.Set("If-Modified-Since", v)
+	}
+}
+
+// storeLastModified records the Last-Modified value from a successful response when enabled.
+func (c *Client) storeLastModified(req *http.Request, res *http.Response) {
+	if c.lastModified == nil || req.Method != http.MethodGet {
+		return
+	}
+	if v := res.Header.Get("Last-Modified"); v != "" {
+		c.lastModified.mu.Lock()
+		defer c.lastModified.mu.Unlock()
+		c.lastModified.values[req.URL.String()] = v
+	}
+}
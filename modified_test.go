@@ -0,0 +1,48 @@
+package smartaccounts
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestWithIfModifiedSince(t *testing.T) {
+	const lastModified = "Wed, 01 May 2024 10:00:00 GMT"
+	var sent []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		ims := r.Header.Get("If-Modified-Since")
+		sent = append(sent, ims)
+		if ims == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		virtualAccountsHandler(t, map[string][]VirtualAccount{"example.com": {{Name: "VA1"}}})(w, r)
+	}
+
+	c := newTestClient(t, http.HandlerFunc(h), WithIfModifiedSince(true))
+	vas, err := c.GetVirtualAccounts("example.com")
+	if err != nil || len(vas) != 1 {
+		t.Fatalf("200: got %v, %v, want VA1", vas, err)
+	}
+	if _, err := c.GetVirtualAccounts("example.com"); !errors.Is(err, ErrNotModified) {
+		t.Errorf("304: got %v, want ErrNotModified", err)
+	}
+	if _, err := c.GetVirtualAccounts("other.com"); errors.Is(err, ErrNotModified) {
+		t.Errorf("other URL: got %v, want no If-Modified-Since to be sent", err)
+	}
+	if want := []string{"", lastModified, ""}; len(sent) != 3 || sent[0] != want[0] || sent[1] != want[1] || sent[2] != want[2] {
+		t.Errorf("got If-Modified-Since %q, want %q", sent, want)
+	}
+
+	sent = nil
+	c = newTestClient(t, http.HandlerFunc(h))
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetVirtualAccounts("example.com"); err != nil {
+			t.Fatalf("disabled: got %v", err)
+		}
+	}
+	if sent[0] != "" || sent[1] != "" {
+		t.Errorf("disabled: got If-Modified-Since %q, want none", sent)
+	}
+}
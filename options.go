@@ -0,0 +1,120 @@
+package smartaccounts
+
+import (
+	"errors"
+
+	"golang.org/x/time/rate"
+)
+
+// Option allows optional configuration of the Client when calling New.
+type Option func(*Client)
+
+// RateLimitMode determines what happens when a request is not allowed by the client side rate limiter.
+type RateLimitMode int
+
+const (
+	// RateLimitWait will block until the rate limiter allows the request.  This is the default.
+	RateLimitWait RateLimitMode = iota
+	// RateLimitFail will return ErrRateLimited immediately rather than blocking.
+	RateLimitFail
+)
+
+// WithRateLimitMode sets the behaviour when the client side rate limiter disallows a request.
+func WithRateLimitMode(mode RateLimitMode) Option {
+	return func(c *Client) {
+		c.rateLimitMode = mode
+	}
+}
+
+// defaultConcurrency is the number of concurrent requests made by the bulk methods.
+const defaultConcurrency = 5
+
+// WithConcurrency sets the maximum number of concurrent requests made by the bulk methods such as
+// GetVirtualAccountsForDomains.  All requests are still subject to the rate limiter.  The default is 5.
+func WithConcurrency(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithValidateTotals enables checking that the number of records collected by paginated and search requests
+// matches the TotalRecords reported by Cisco, returning ErrTotalMismatch if not.  The default is off.
+func WithValidateTotals(validate bool) Option {
+	return func(c *Client) {
+		c.validateTotals = validate
+	}
+}
+
+// WithRateLimiter replaces the client side rate limiter, which defaults to 100 requests per second.
+func WithRateLimiter(lim *rate.Limiter) Option {
+	return func(c *Client) {
+		if lim != nil {
+			c.lim = lim
+		}
+	}
+}
+
+// WithoutRateLimiting disables the client side rate limiter entirely, which is mostly useful for tests.
+func WithoutRateLimiting() Option {
+	return WithRateLimiter(rate.NewLimiter(rate.Inf, 0))
+}
+
+// WithOnTokenError sets a function that is called whenever the client fails to retrieve a token, e.g. due to
+// invalid credentials or the token endpoint being unavailable.  The error is still returned to the caller.
+func WithOnTokenError(fn func(error)) Option {
+	return func(c *Client) {
+		c.onTokenError = fn
+	}
+}
+
+// WithFixedToken sets a bearer token that is used for every request as is, so the token endpoint is never
+// called.  This is useful for testing, or where the token is obtained some other way.
+func WithFixedToken(token string) Option {
+	return func(c *Client) {
+		c.fixedToken = token
+	}
+}
+
+// WithSecretSource sets a function that is called for the current credentials each time a new token is requested,
+// allowing credentials to be rotated without creating a new client.  The credentials passed to New are used when
+// no source is set.
+func WithSecretSource(fn func() (clientID, secret, username, password string, err error)) Option {
+	return func(c *Client) {
+		c.secretSource = fn
+	}
+}
+
+// WithAutoFetchVirtualAccounts makes GetSmartLicenseUsage retrieve the virtual accounts for the domain when the
+// provided SmartAccount has none, e.g. when it came from GetAllSmartAccounts.  Note this costs an additional
+// request each time.  The default is to return ErrNoVirtualAccounts instead.
+func WithAutoFetchVirtualAccounts(enabled bool) Option {
+	return func(c *Client) {
+		c.autoFetchVAs = enabled
+	}
+}
+
+// WithUseNumber decodes numbers into json.Number rather than float64 wherever a response is decoded into an
+// interface{} value, such as with GetJSON, so that large IDs don't lose precision.  The typed responses in this
+// library are unaffected since their numeric fields are all int.  The default is off.
+func WithUseNumber(enabled bool) Option {
+	return func(c *Client) {
+		c.useNumber = enabled
+	}
+}
+
+// WithTreat404AsEmpty causes the list methods to return an empty result rather than ErrNotFound when Cisco responds
+// with 404 Not Found, as some endpoints do when a domain has no data.  This affects GetAllSmartAccounts,
+// GetVirtualAccounts, the SearchSmartAccounts methods and the license methods, where a 404 for a virtual account is
+// treated as having no licenses.  The default is to return ErrNotFound.
+func WithTreat404AsEmpty() Option {
+	return func(c *Client) {
+		c.treat404AsEmpty = true
+	}
+}
+
+// emptyOn404 reports whether err should be treated as an empty result because of WithTreat404AsEmpty.
+func (c *Client) emptyOn404(err error) bool {
+	return c.treat404AsEmpty && errors.Is(err, ErrNotFound)
+}
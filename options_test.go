@@ -0,0 +1,194 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestWithoutRateLimiting(t *testing.T) {
+	const requests = 20
+	run := func(opts ...Option) time.Duration {
+		c := newTestClient(t, searchHandler(t), opts...)
+		start := time.Now()
+		for i := 0; i < requests; i++ {
+			if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return time.Since(start)
+	}
+	// the default limiter allows 100 requests a second with a burst of 1
+	limited := run(WithRateLimiter(rate.NewLimiter(100, 1)))
+	if limited < (requests-1)*10*time.Millisecond {
+		t.Fatalf("limited: took %s, want at least %s", limited, (requests-1)*10*time.Millisecond)
+	}
+	if unlimited := run(WithoutRateLimiting()); unlimited >= limited/2 {
+		t.Errorf("unlimited: took %s, want much less than the limited %s", unlimited, limited)
+	}
+
+	c := New("id", "secret", "user", "pass", WithoutRateLimiting())
+	for i := 0; i < 1000; i++ {
+		if r := c.lim.Reserve(); !r.OK() || r.Delay() != 0 {
+			t.Fatalf("reservation %d: got ok %v and delay %s, want no delay", i, r.OK(), r.Delay())
+		}
+	}
+}
+
+func TestWithOnTokenError(t *testing.T) {
+	var fail int32 = 1
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if isTokenRequest(r) {
+			if atomic.LoadInt32(&fail) == 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			serveToken(t, w)
+			return
+		}
+		searchHandler(t)(w, r)
+	}
+	var observed []error
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""), WithOnTokenError(func(err error) {
+		observed = append(observed, err)
+	}))
+	_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got %v, want the token error returned", err)
+	}
+	if len(observed) != 1 || !errors.Is(observed[0], ErrUnauthorized) {
+		t.Errorf("got callbacks %v, want one with ErrUnauthorized", observed)
+	}
+
+	atomic.StoreInt32(&fail, 0)
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	if len(observed) != 1 {
+		t.Errorf("got %d callbacks, want none for a successful token request", len(observed)-1)
+	}
+}
+
+func TestWithFixedToken(t *testing.T) {
+	var tokens counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if isTokenRequest(r) {
+			tokens.inc()
+			serveToken(t, w)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer raw-token" {
+			t.Errorf("got Authorization %q, want the fixed token", got)
+		}
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken("raw-token"))
+	for i := 0; i < 2; i++ {
+		if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokens.get() != 0 {
+		t.Errorf("got %d token requests, want none", tokens.get())
+	}
+}
+
+func TestWithSecretSource(t *testing.T) {
+	var seen []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !isTokenRequest(r) {
+			searchHandler(t)(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		seen = append(seen, r.PostForm.Get("client_id")+":"+r.PostForm.Get("client_secret")+":"+r.PostForm.Get("username")+":"+r.PostForm.Get("password"))
+		// expiring within 5 minutes makes the client fetch a new token for every request
+		writeJSON(t, w, map[string]interface{}{"access_token": "short", "token_type": "Bearer", "expires_in": 60})
+	}
+	version := 1
+	source := func() (string, string, string, string, error) {
+		v := strconv.Itoa(version)
+		return "id" + v, "secret" + v, "user" + v, "pass" + v, nil
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""), WithSecretSource(source))
+	for version = 1; version <= 2; version++ {
+		if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"id1:secret1:user1:pass1", "id2:secret2:user2:pass2"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("got credentials %q, want %q", seen, want)
+	}
+
+	// without a source the credentials passed to New are used
+	seen = nil
+	c = newTestClient(t, http.HandlerFunc(h), WithFixedToken(""))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"id:secret:user:pass"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("got credentials %q, want %q", seen, want)
+	}
+
+	failing := func() (string, string, string, string, error) {
+		return "", "", "", "", errors.New("vault sealed")
+	}
+	c = newTestClient(t, http.HandlerFunc(h), WithFixedToken(""), WithSecretSource(failing))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err == nil || !strings.Contains(err.Error(), "vault sealed") {
+		t.Errorf("got %v, want the source's error", err)
+	}
+}
+
+func TestWithTreat404AsEmpty(t *testing.T) {
+	ctx := context.Background()
+	calls := []struct {
+		name string
+		call func(c *Client) (int, error)
+	}{
+		{"GetAllSmartAccounts", func(c *Client) (int, error) { r, err := c.GetAllSmartAccounts(); return len(r), err }},
+		{"GetVirtualAccounts", func(c *Client) (int, error) { r, err := c.GetVirtualAccounts("example.com"); return len(r), err }},
+		{"SearchSmartAccountsByName", func(c *Client) (int, error) {
+			r, err := c.SearchSmartAccountsByName(ctx, "example")
+			if err != nil {
+				return 0, err
+			}
+			return len(r.Accounts), nil
+		}},
+		{"licenses", func(c *Client) (int, error) {
+			// failed virtual accounts are logged and left out, so check a page directly too
+			if _, err := c.GetLicensesPage(ctx, "example.com", "VA1", 0, 10); err != nil {
+				return 0, err
+			}
+			r, err := c.GetSmartLicenseUsage(smartAccountWith("VA1"))
+			return len(*r), err
+		}},
+	}
+	for _, tt := range calls {
+		strict := newTestClient(t, http.NotFoundHandler())
+		if _, err := tt.call(strict); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s default: got %v, want ErrNotFound", tt.name, err)
+		}
+		lenient := newTestClient(t, http.NotFoundHandler(), WithTreat404AsEmpty())
+		if n, err := tt.call(lenient); err != nil || n != 0 {
+			t.Errorf("%s with WithTreat404AsEmpty: got %d results and %v, want an empty result", tt.name, n, err)
+		}
+	}
+
+	// other errors are unaffected
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}), WithTreat404AsEmpty())
+	if _, err := c.GetVirtualAccounts("example.com"); !errors.Is(err, ErrInternalError) {
+		t.Errorf("500: got %v, want ErrInternalError", err)
+	}
+}
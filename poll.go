@@ -0,0 +1,129 @@
+package smartaccounts
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LicenseDiff represents the differences between two sets of licenses, matched on VirtualAccount and License.
+type LicenseDiff struct {
+	Added   []License
+	Removed []License
+	Changed []LicenseChange
+}
+
+// LicenseChange represents a license whose quantities or status differ between two sets of licenses.
+type LicenseChange struct {
+	Before License
+	After  License
+}
+
+// Empty reports whether there are no differences.
+func (d LicenseDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+type licenseKey struct {
+	virtualAccount string
+	license        string
+}
+
+// DiffLicenses compares two sets of licenses, matching them on VirtualAccount and License, and returns those that
+// were added, removed, or whose quantities or status changed.
+func DiffLicenses(before, after []License) LicenseDiff {
+	var diff LicenseDiff
+	prev := make(map[licenseKey]License, len(before))
+	for _, l := range before {
+		prev[licenseKey{l.VirtualAccount, l.License}] = l
+	}
+	seen := make(map[licenseKey]bool, len(after))
+	for _, l := range after {
+		k := licenseKey{l.VirtualAccount, l.License}
+		seen[k] = true
+		p, ok := prev[k]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, l)
+		case p.Quantity != l.Quantity || p.InUse != l.InUse || p.Available != l.Available ||
+			p.Reserved != l.Reserved || p.PendingQuantity != l.PendingQuantity || p.Status != l.Status:
+			diff.Changed = append(diff.Changed, LicenseChange{Before: p, After: l})
+		}
+	}
+	for _, l := range before {
+		if !seen[licenseKey{l.VirtualAccount, l.License}] {
+			diff.Removed = append(diff.Removed, l)
+		}
+	}
+	return diff
+}
+
+// ticker is the part of a *time.Ticker used by PollLicenses, so that tests can control when polls happen.
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type timeTicker struct {
+	*time.Ticker
+}
+
+func (t timeTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// startTicker returns a ticker for the interval, from newTicker if it has been set.
+func (c *Client) startTicker(interval time.Duration) ticker {
+	if c.newTicker != nil {
+		return c.newTicker(interval)
+	}
+	return timeTicker{time.NewTicker(interval)}
+}
+
+// PollLicenses retrieves the licenses for the provided SmartAccount immediately and then every interval until the
+// context is cancelled, calling cb with the latest licenses and the differences from the previous successful poll.
+// The first call reports every license as added.  Should a poll fail, including when the licenses for any of the
+// virtual accounts can't be retrieved in full, onError (if not nil) is called and polling continues; cb isn't called
+// for that poll, so differences are never reported against an incomplete set of licenses.  The error for a partial
+// failure is a *PartialError keyed by virtual account.  As with GetSmartLicenseUsage, the SmartAccount needs its
+// virtual accounts unless WithAutoFetchVirtualAccounts is set.  An interval of zero or less returns an error
+// immediately, otherwise it returns the context error once cancelled.
+func (c *Client) PollLicenses(ctx context.Context, sa SmartAccount, interval time.Duration, cb func([]License, LicenseDiff), onError func(error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("PollLicenses(%s): ccw: invalid poll interval %s", sa.AccountDomain, interval)
+	}
+	t := c.startTicker(interval)
+	defer t.Stop()
+	var previous []License
+	for {
+		licenses, err := c.pollLicenses(ctx, sa)
+		if err != nil {
+			if onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		} else {
+			cb(licenses, DiffLicenses(previous, licenses))
+			previous = licenses
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C():
+		}
+	}
+}
+
+// pollLicenses makes a single poll for PollLicenses, returning an error unless every virtual account succeeded.
+func (c *Client) pollLicenses(ctx context.Context, sa SmartAccount) (_ []License, err error) {
+	defer wrapOp(&err, "PollLicenses(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "PollLicenses")
+	defer cancel()
+	licenses, failures, err := c.getVirtualAccountLicenses(ctx, c.getLicensesPage, sa)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return nil, &PartialError{Result: licenses, Failures: failures}
+	}
+	return licenses, nil
+}
@@ -0,0 +1,141 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTicker is a ticker that only ticks when told to.
+type fakeTicker struct {
+	interval time.Duration
+	c        chan time.Time
+	stopped  chan struct{}
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               { close(t.stopped) }
+func (t *fakeTicker) tick()               { t.c <- time.Now() }
+
+func TestDiffLicenses(t *testing.T) {
+	before := []License{
+		{VirtualAccount: "VA1", License: "L1", Quantity: 10, InUse: 5},
+		{VirtualAccount: "VA1", License: "L2", Quantity: 10},
+		{VirtualAccount: "VA2", License: "L1", Quantity: 1},
+	}
+	after := []License{
+		{VirtualAccount: "VA1", License: "L1", Quantity: 10, InUse: 6},
+		{VirtualAccount: "VA2", License: "L1", Quantity: 1},
+		{VirtualAccount: "VA2", License: "L3", Quantity: 2},
+	}
+	diff := DiffLicenses(before, after)
+	if len(diff.Added) != 1 || diff.Added[0].License != "L3" {
+		t.Errorf("got added %v, want VA2/L3", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].License != "L2" {
+		t.Errorf("got removed %v, want VA1/L2", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Before.InUse != 5 || diff.Changed[0].After.InUse != 6 {
+		t.Errorf("got changed %v, want VA1/L1", diff.Changed)
+	}
+	if !DiffLicenses(after, after).Empty() || diff.Empty() {
+		t.Error("got Empty wrong")
+	}
+}
+
+func TestPollLicenses(t *testing.T) {
+	var mu sync.Mutex
+	licenses := map[string][]License{"VA1": makeLicenses("VA1", 2), "VA2": makeLicenses("VA2", 1)}
+	update := func(fn func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn()
+	}
+	h := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current := map[string][]License{}
+		for k, v := range licenses {
+			current[k] = append([]License(nil), v...)
+		}
+		mu.Unlock()
+		licensesHandler(t, current)(w, r)
+	}
+
+	ft := &fakeTicker{c: make(chan time.Time), stopped: make(chan struct{})}
+	c := newTestClient(t, http.HandlerFunc(h))
+	c.newTicker = func(d time.Duration) ticker {
+		ft.interval = d
+		return ft
+	}
+
+	type poll struct {
+		licenses []License
+		diff     LicenseDiff
+		err      error
+	}
+	polls := make(chan poll)
+	cb := func(l []License, d LicenseDiff) { polls <- poll{licenses: l, diff: d} }
+	onError := func(err error) { polls <- poll{err: err} }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.PollLicenses(ctx, smartAccountWith("VA1", "VA2"), time.Hour, cb, onError)
+	}()
+
+	// the first poll happens immediately and reports everything as added
+	p := <-polls
+	if p.err != nil || len(p.licenses) != 3 || len(p.diff.Added) != 3 {
+		t.Fatalf("first poll: got %+v, want three licenses added", p)
+	}
+	if ft.interval != time.Hour {
+		t.Errorf("got interval %s, want 1h", ft.interval)
+	}
+
+	update(func() { licenses["VA1"][0].InUse = 9 })
+	ft.tick()
+	if p = <-polls; p.err != nil || len(p.diff.Changed) != 1 || p.diff.Changed[0].After.InUse != 9 || len(p.diff.Added) != 0 {
+		t.Fatalf("second poll: got %+v, want only VA1 L000 changed", p)
+	}
+
+	// a virtual account failing is reported, without calling cb with the rest
+	update(func() { delete(licenses, "VA2") })
+	ft.tick()
+	p = <-polls
+	var pe *PartialError
+	if !errors.As(p.err, &pe) || !errors.Is(pe.Failures["VA2"], ErrInternalError) || len(pe.Failures) != 1 {
+		t.Fatalf("third poll: got %+v, want a *PartialError for VA2", p)
+	}
+
+	// once VA2 is back, the diff is against the last complete poll, so nothing was removed and added again
+	update(func() { licenses["VA2"] = makeLicenses("VA2", 1) })
+	ft.tick()
+	if p = <-polls; p.err != nil || !p.diff.Empty() {
+		t.Fatalf("fourth poll: got %+v, want no differences", p)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	select {
+	case <-ft.stopped:
+	default:
+		t.Error("got the ticker left running")
+	}
+}
+
+func TestPollLicensesInvalidInterval(t *testing.T) {
+	c := New("id", "secret", "user", "pass")
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := c.PollLicenses(context.Background(), smartAccountWith("VA1"), interval, func([]License, LicenseDiff) {
+			t.Error("got a poll, want none")
+		}, nil)
+		if err == nil {
+			t.Errorf("%s: got nil, want an error", interval)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// EndpointSpec describes a request to be made with GetRaw.
+type EndpointSpec struct {
+	Method string      // defaults to GET
+	URL    string      // the full URL of the endpoint, including any query parameters
+	Body   interface{} // marshalled with the client's codec and sent as the request body when not nil
+	Accept string      // defaults to application/json
+}
+
+// WithRawHosts allows GetRaw and GetJSON to send requests, and so the bearer token, to the given hosts, e.g.
+// "api.example.com", in addition to the Cisco API hosts.  Only https URLs are ever allowed.
+func WithRawHosts(hosts ...string) Option {
+	return func(c *Client) {
+		if c.rawHosts == nil {
+			c.rawHosts = map[string]bool{}
+		}
+		for _, h := range hosts {
+			c.rawHosts[h] = true
+		}
+	}
+}
+
+// checkRawURL checks the URL for GetRaw, returning an error if it isn't an https URL for one of the Cisco API
+// hosts or a host allowed by WithRawHosts.  Errors don't include the URL, which may contain sensitive values.
+func (c *Client) checkRawURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("ccw: invalid URL: %w", err)
+	}
+	origin := u.Scheme + "://" + u.Host
+	if u.Scheme != "https" || (origin != apxHost && origin != swapiHost && !c.rawHosts[u.Host]) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, origin)
+	}
+	return nil
+}
+
+// rawLabel returns the URL for labelling GetRaw and GetJSON errors, with any query values redacted.
+func rawLabel(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid URL"
+	}
+	return redactURL(u)
+}
+
+// GetRaw makes an authenticated, rate limited request to the given endpoint, returning the response body without
+// decoding it.  This provides an escape hatch for when the types in this library lag behind Cisco's responses.
+// Since the request carries the bearer token, the URL must be https and for one of the Cisco API hosts, or a host
+// allowed with WithRawHosts, otherwise ErrHostNotAllowed is returned.  Query values are redacted in errors.
+func (c *Client) GetRaw(ctx context.Context, spec EndpointSpec) (_ []byte, err error) {
+	defer wrapOp(&err, "GetRaw(%s)", rawLabel(spec.URL))
+	ctx, cancel := c.methodContext(ctx, "GetRaw")
+	defer cancel()
+	if err := c.checkRawURL(spec.URL); err != nil {
+		return nil, err
+	}
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if spec.Body != nil {
+		payload, err := c.marshal(spec.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, spec.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Accept != "" {
+		req.Header.Set("Accept", spec.Accept)
+	}
+	var raw []byte
+	err = c.makeRequest(ctx, req, &raw)
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// GetJSON makes a request to the given endpoint as GetRaw does, but decodes the response into v, which is useful
+// with a map[string]interface{} for endpoints not modelled by this library.  Use WithUseNumber to avoid large
+// numbers losing precision when decoded into interface{} values.
+func (c *Client) GetJSON(ctx context.Context, spec EndpointSpec, v interface{}) (err error) {
+	raw, err := c.GetRaw(ctx, spec)
+	if err != nil {
+		return err
+	}
+	defer wrapOp(&err, "GetJSON(%s)", rawLabel(spec.URL))
+	return c.decodeResponse("Raw", bytes.NewReader(raw), v)
+}
@@ -0,0 +1,139 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetRaw(t *testing.T) {
+	// odd spacing, unknown fields and big numbers would all be lost by decoding
+	const raw = "{\"unknown\":  [1, 2, 3],\n \"big\": 12345678901234567890, \"text\": \"caf\\u00e9\"}\n"
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("got Authorization %q, want the token", got)
+		}
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != `{"id":1}` {
+				t.Errorf("got body %s, want the marshalled spec body", body)
+			}
+		}
+		if got := r.Header.Get("Accept"); r.URL.Path == "/csv" && got != "text/csv" {
+			t.Errorf("got Accept %q, want text/csv", got)
+		}
+		w.Write([]byte(raw))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	for _, spec := range []EndpointSpec{
+		{URL: swapiHost + "/raw?x=1"},
+		{Method: http.MethodPost, URL: apxHost + "/raw", Body: map[string]int{"id": 1}},
+		{URL: swapiHost + "/csv", Accept: "text/csv"},
+	} {
+		got, err := c.GetRaw(context.Background(), spec)
+		if err != nil {
+			t.Fatalf("%s %s: %v", spec.Method, spec.URL, err)
+		}
+		if !bytes.Equal(got, []byte(raw)) {
+			t.Errorf("%s %s: got %q, want %q", spec.Method, spec.URL, got, raw)
+		}
+	}
+}
+
+func TestWithUseNumber(t *testing.T) {
+	// 2^53 + 1 is the first integer a float64 can't represent, and the others exceed int64
+	const body = `{"smartAccountId": 9007199254740993, "max": 9223372036854775807, "over": 18446744073709551616, "ids": [9007199254740993]}`
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+	spec := EndpointSpec{URL: swapiHost + "/big"}
+
+	c := newTestClient(t, http.HandlerFunc(h), WithUseNumber(true))
+	var v map[string]interface{}
+	if err := c.GetJSON(context.Background(), spec, &v); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"smartAccountId": "9007199254740993", "max": "9223372036854775807", "over": "18446744073709551616"} {
+		if n, ok := v[key].(json.Number); !ok || n.String() != want {
+			t.Errorf("%s: got %#v, want json.Number %s", key, v[key], want)
+		}
+	}
+	if ids := v["ids"].([]interface{}); ids[0] != json.Number("9007199254740993") {
+		t.Errorf("ids: got %#v, want json.Number", ids[0])
+	}
+	if n, err := v["max"].(json.Number).Int64(); err != nil || n != math.MaxInt64 {
+		t.Errorf("got %d, %v, want MaxInt64", n, err)
+	}
+
+	c = newTestClient(t, http.HandlerFunc(h))
+	v = nil
+	if err := c.GetJSON(context.Background(), spec, &v); err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := v["smartAccountId"].(float64); !ok || f != 9007199254740992 {
+		t.Errorf("without UseNumber: got %#v, want the float64 that loses precision", v["smartAccountId"])
+	}
+}
+
+func TestGetRawHosts(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.Write([]byte(`{}`))
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	for _, u := range []string{swapiHost + "/x", apxHost + "/x?a=1"} {
+		if _, err := c.GetRaw(context.Background(), EndpointSpec{URL: u}); err != nil {
+			t.Errorf("%s: got %v, want it allowed", u, err)
+		}
+	}
+	for _, u := range []string{"https://example.com/x", "http://swapi.cisco.com/x", "https://swapi.cisco.com.example.com/x", "/relative"} {
+		_, err := c.GetRaw(context.Background(), EndpointSpec{URL: u})
+		if !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("%s: got %v, want ErrHostNotAllowed", u, err)
+		}
+		var v map[string]interface{}
+		if err := c.GetJSON(context.Background(), EndpointSpec{URL: u}, &v); !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("%s: got %v from GetJSON, want ErrHostNotAllowed", u, err)
+		}
+	}
+	if calls.get() != 2 {
+		t.Errorf("got %d requests, want only the 2 allowed", calls.get())
+	}
+
+	c = newTestClient(t, http.HandlerFunc(h), WithRawHosts("example.com"))
+	if _, err := c.GetRaw(context.Background(), EndpointSpec{URL: "https://example.com/x"}); err != nil {
+		t.Errorf("allowed host: got %v, want nil", err)
+	}
+	if _, err := c.GetRaw(context.Background(), EndpointSpec{URL: "http://example.com/x"}); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("allowed host over http: got %v, want ErrHostNotAllowed", err)
+	}
+}
+
+func TestGetRawErrorsRedacted(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	_, err := c.GetRaw(context.Background(), EndpointSpec{URL: swapiHost + "/x?token=s3cret&name=a"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	var v map[string]interface{}
+	jerr := c.GetJSON(context.Background(), EndpointSpec{URL: swapiHost + "/x?token=s3cret"}, &v)
+	_, ierr := c.GetRaw(context.Background(), EndpointSpec{URL: "https://swapi.cisco.com/x?token=s3cret%zz"})
+	for _, err := range []error{err, jerr, ierr} {
+		if err == nil || strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("got %v, want an error without the query values", err)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "GetRaw("+swapiHost+"/x?name=REDACTED&token=REDACTED): ") {
+		t.Errorf("got %q, want it labelled with the redacted URL", err)
+	}
+}
@@ -0,0 +1,164 @@
+package smartaccounts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Interaction is a single request and response captured by WithRecorder.  Request headers aren't recorded, so the
+// Authorization header is never written, and the token request isn't recorded at all.
+type Interaction struct {
+	Endpoint     string      `json:"endpoint"`
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  []byte      `json:"requestBody,omitempty"`
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody []byte      `json:"responseBody,omitempty"`
+}
+
+// WithRecorder records every API request and its response to w as a line of JSON, in the format read by
+// NewReplayClient, so that a real session can be captured once and replayed in tests.  Secrets are not recorded:
+// request headers and the token request are omitted, as is the Set-Cookie response header.  Writes to w are
+// serialised, but a failure to write doesn't fail the request.
+func WithRecorder(w io.Writer) Option {
+	return func(c *Client) {
+		c.recorder = &recorder{w: w}
+	}
+}
+
+// recorder wraps a transport, writing each interaction to w.  Response bodies are read through limitBody so that
+// recording doesn't bypass WithResponseSizeLimit.
+type recorder struct {
+	mu        sync.Mutex
+	w         io.Writer
+	next      http.RoundTripper
+	limitBody func(io.ReadCloser) io.ReadCloser
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		reqBody, _ = io.ReadAll(body)
+		body.Close()
+	}
+	res, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := io.ReadAll(r.limitBody(res.Body))
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+	r.write(Interaction{
+		Endpoint:     requestEndpoint(req),
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		RequestBody:  reqBody,
+		StatusCode:   res.StatusCode,
+		Header:       header,
+		ResponseBody: resBody,
+	})
+	return res, nil
+}
+
+func (r *recorder) write(in Interaction) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(b, '\n'))
+}
+
+// NewReplayClient returns a Client that serves responses from interactions previously recorded with WithRecorder
+// rather than calling Cisco.  Requests are matched on method, URL and body, and repeated requests are served the
+// recorded responses in order, with the last one repeated once they run out.  A request that wasn't recorded
+// fails with an error.  No token is requested and rate limiting is disabled, though the options can still be used
+// to configure the client as for New, except that ErrTransportConflict is returned for options that set the
+// HTTPClient's transport, as the recording is served by one.
+func NewReplayClient(r io.Reader, opts ...Option) (*Client, error) {
+	rt := &replayTransport{interactions: map[string][]Interaction{}}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64*1024*1024)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var in Interaction
+		if err := json.Unmarshal(sc.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("ccw: invalid recording: %w", err)
+		}
+		key := replayKey(in.Method, in.URL, in.RequestBody)
+		rt.interactions[key] = append(rt.interactions[key], in)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	var conflict bool
+	opts = append([]Option{WithFixedToken("replay"), WithoutRateLimiting()}, opts...)
+	opts = append(opts, withFakeTransport(rt, &conflict))
+	c := New("replay", "replay", "replay", "replay", opts...)
+	if conflict {
+		return nil, ErrTransportConflict
+	}
+	return c, nil
+}
+
+// replayTransport serves recorded interactions.
+type replayTransport struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+}
+
+func replayKey(method, url string, body []byte) string {
+	return method + " " + url + " " + string(body)
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	key := replayKey(req.Method, req.URL.String(), body)
+	t.mu.Lock()
+	queue := t.interactions[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("ccw: no recorded response for %s %s", req.Method, req.URL)
+	}
+	in := queue[0]
+	if len(queue) > 1 {
+		t.interactions[key] = queue[1:]
+	}
+	t.mu.Unlock()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+		StatusCode:    in.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(in.ResponseBody)),
+		ContentLength: int64(len(in.ResponseBody)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	f := &fakeCisco{
+		accounts: []SmartAccount{{AccountDomain: "example.com", AccountName: "Example"}},
+		search:   []SearchAccount{{Domain: "example.com", Name: "Example", ID: 1}},
+		vas:      map[string][]VirtualAccount{"example.com": {{Name: "VA1"}, {Name: "VA2"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 120), "VA2": makeLicenses("VA2", 3)},
+		subscriptions: map[int][]SubscriptionSearchSubscription{
+			1: {{SubRefID: "Sub1"}},
+		},
+		reports: map[string]*EASmartAccountSubscriptionConsumptionReportResponse{},
+	}
+	next := f.handler(t)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		next(w, r)
+	}
+
+	// session runs the same calls against a client, returning the results and the error from a failing call.
+	type results struct {
+		accounts  []SmartAccount
+		search    *SearchResponse
+		vas       []VirtualAccount
+		licenses  []License
+		subs      *SubscriptionSearchResponse
+		reportErr error
+	}
+	session := func(t *testing.T, c *Client) results {
+		var r results
+		var err error
+		if r.accounts, err = c.GetAllSmartAccounts(); err != nil {
+			t.Fatal(err)
+		}
+		if r.search, err = c.SearchSmartAccountsByDomain("example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if r.vas, err = c.GetVirtualAccounts("example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if r.licenses, err = c.GetLicensesForDomain(context.Background(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if r.subs, err = c.SearchSubscriptions(1, "example.com"); err != nil {
+			t.Fatal(err)
+		}
+		_, r.reportErr = c.GetEASmartAccountSubscriptionConsumptionReport("example.com", "Sub1")
+		return r
+	}
+
+	var rec bytes.Buffer
+	recorded := session(t, newTestClient(t, http.HandlerFunc(h), WithFixedToken(""), WithRecorder(&rec)))
+	if len(recorded.licenses) != 123 || !errors.Is(recorded.reportErr, ErrNoSubscriptions) {
+		t.Fatalf("got %d licenses and %v, want 123 and ErrNoSubscriptions", len(recorded.licenses), recorded.reportErr)
+	}
+	for _, secret := range []string{"server-token", "Authorization", "secret-cookie", "client_secret", "pass"} {
+		if strings.Contains(rec.String(), secret) {
+			t.Errorf("recording contains %q", secret)
+		}
+	}
+
+	c, err := NewReplayClient(bytes.NewReader(rec.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := session(t, c)
+	if !errors.Is(replayed.reportErr, ErrNoSubscriptions) {
+		t.Errorf("replayed report: got %v, want ErrNoSubscriptions", replayed.reportErr)
+	}
+	recorded.reportErr, replayed.reportErr = nil, nil
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %+v, want the recorded results %+v", replayed, recorded)
+	}
+
+	// the recording can be replayed again, and a request that wasn't recorded fails
+	if _, err := c.GetVirtualAccounts("example.com"); err != nil {
+		t.Errorf("repeated request: got %v, want the last recorded response", err)
+	}
+	if _, err := c.GetVirtualAccounts("other.com"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("unrecorded request: got %v, want no recorded response", err)
+	}
+}
+
+func TestReplayInOrder(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		n := calls.inc()
+		writeJSON(t, w, VirtualAccountResponse{VirtualAccounts: []VirtualAccount{{Name: strings.Repeat("V", n)}}})
+	}
+	var rec bytes.Buffer
+	c := newTestClient(t, http.HandlerFunc(h), WithRecorder(&rec))
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetVirtualAccounts("example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := NewReplayClient(&rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"V", "VV", "VV"} {
+		if got, err := c.GetVirtualAccounts("example.com"); err != nil || len(got) != 1 || got[0].Name != want {
+			t.Errorf("got %v, %v, want %s", got, err, want)
+		}
+	}
+}
+
+func TestNewReplayClientInvalid(t *testing.T) {
+	if _, err := NewReplayClient(strings.NewReader("{\"method\": \"GET\"}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "invalid recording") {
+		t.Errorf("got %v, want an invalid recording error", err)
+	}
+}
+
+func TestRecorderResponseSizeLimit(t *testing.T) {
+	h := searchHandler(t, SearchAccount{Domain: "example.com", Name: strings.Repeat("x", 4096)})
+	var rec bytes.Buffer
+	c := newTestClient(t, h, WithRecorder(&rec), WithResponseSizeLimit(1024))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("got %v, want ErrResponseTooLarge", err)
+	}
+	if rec.Len() != 0 {
+		t.Errorf("recorded %d bytes, want nothing for a response over the limit", rec.Len())
+	}
+}
+
+func TestNewReplayClientOptions(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, VirtualAccountResponse{VirtualAccounts: []VirtualAccount{{Name: "VA1"}}})
+	}
+	var rec bytes.Buffer
+	c := newTestClient(t, http.HandlerFunc(h), WithRecorder(&rec))
+	if _, err := c.GetVirtualAccounts("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	recording := rec.String()
+
+	// a replay can itself be recorded, as the recorder wraps the replay transport rather than being replaced
+	var rerec bytes.Buffer
+	c, err := NewReplayClient(strings.NewReader(recording), WithRecorder(&rerec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.GetVirtualAccounts("example.com"); err != nil || len(got) != 1 || got[0].Name != "VA1" {
+		t.Fatalf("got %v, %v, want VA1", got, err)
+	}
+	if rerec.String() != recording {
+		t.Errorf("got recording %q, want %q", rerec.String(), recording)
+	}
+
+	if _, err := NewReplayClient(strings.NewReader(recording), withTransport(http.DefaultTransport)); !errors.Is(err, ErrTransportConflict) {
+		t.Errorf("with a transport: got %v, want ErrTransportConflict", err)
+	}
+}
@@ -0,0 +1,101 @@
+package smartaccounts
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// The context helpers in this file allow individual calls to be tuned without changing method signatures.  Values
+// in the context take precedence over the equivalent client options for the requests made with that context.
+
+type extraQueryKey struct{}
+
+// WithExtraQuery returns a context that adds the given query parameters to every request made with it, for
+// parameters Cisco supports that the library doesn't yet model.  The parameters are encoded and merged into the
+// URL built by the method, replacing any parameter of the same name.  Only methods that accept a context can be
+// affected.
+func WithExtraQuery(ctx context.Context, params map[string]string) context.Context {
+	merged := map[string]string{}
+	if existing, ok := ctx.Value(extraQueryKey{}).(map[string]string); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, extraQueryKey{}, merged)
+}
+
+// applyExtraQuery merges any parameters added with WithExtraQuery into the request URL.
+func applyExtraQuery(ctx context.Context, req *http.Request) {
+	params, ok := ctx.Value(extraQueryKey{}).(map[string]string)
+	if !ok || len(params) == 0 {
+		return
+	}
+	q := req.URL.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+}
+
+type requestTimeoutKey struct{}
+
+type requestHeadersKey struct{}
+
+type requestRetriesKey struct{}
+
+// WithRequestTimeout returns a context that limits each request made with it, including any retries, to d.  This
+// applies in addition to any method timeout and the context's own deadline, so whichever is shortest wins.
+func WithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, d)
+}
+
+// WithRequestHeaders returns a context that adds the given headers to every request made with it, replacing any
+// header of the same name the client would otherwise send, such as Accept.  The Authorization and request ID
+// headers are always set by the client and can't be replaced, nor can Content-Type on requests with a body.
+func WithRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	merged := http.Header{}
+	if existing, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range headers {
+		merged[http.CanonicalHeaderKey(k)] = v
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, merged)
+}
+
+// WithRequestRetries returns a context that enables or disables retries for the requests made with it, overriding
+// WithRetries.  When enabled the number of retries is still taken from WithRetries.
+func WithRequestRetries(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, requestRetriesKey{}, enabled)
+}
+
+// requestContext applies any WithRequestTimeout from ctx, returning the context to use for the request.
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok && d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return ctx, func() {}
+}
+
+// applyRequestHeaders sets any headers added with WithRequestHeaders on the request.
+func applyRequestHeaders(ctx context.Context, req *http.Request) {
+	if headers, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for k, v := range headers {
+			req.Header[k] = v
+		}
+	}
+}
+
+// maxRetriesFor returns the number of retries allowed for a request made with ctx.
+func (c *Client) maxRetriesFor(ctx context.Context) int {
+	if enabled, ok := ctx.Value(requestRetriesKey{}).(bool); ok && !enabled {
+		return 0
+	}
+	return c.maxRetries
+}
@@ -0,0 +1,166 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithExtraQuery(t *testing.T) {
+	var got url.Values
+	h := func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	ctx := WithExtraQuery(context.Background(), map[string]string{"status": "ACTIVE", "limit": "10"})
+	ctx = WithExtraQuery(ctx, map[string]string{"filter": "a&b=c d"})
+	if _, err := c.SearchSmartAccountsByName(ctx, "example"); err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"name": {"example"}, "type": {"CUSTOMER"}, "limit": {"10"}, "offset": {"0"}, "status": {"ACTIVE"}, "filter": {"a&b=c d"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+
+	// the parameters only apply to requests made with the context
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("status") != "" || got.Get("limit") != "1000" {
+		t.Errorf("got query %v, want no extra parameters", got)
+	}
+}
+
+func TestWithExtraQueryResultCache(t *testing.T) {
+	var queries []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		writeJSON(t, w, SmartAccountResponse{})
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithResultCache(time.Minute))
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetAllSmartAccountsWith(WithExtraQuery(context.Background(), map[string]string{"x": "1"}), AccountsRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetAllSmartAccountsWith(context.Background(), AccountsRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// each distinct query is requested once and then cached
+	if want := []string{"x=1", ""}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("got queries %q, want %q", queries, want)
+	}
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(5), WithBackoff(ConstantBackoff{}))
+	ctx := WithRequestTimeout(context.Background(), 50*time.Millisecond)
+	start := time.Now()
+	_, err := c.SearchSmartAccountsByName(ctx, "example")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the request timeout", err)
+	}
+	// the timeout covers the retries too
+	if time.Since(start) > 150*time.Millisecond || calls.get() != 1 {
+		t.Errorf("took %s with %d attempts, want to stop after 50ms", time.Since(start), calls.get())
+	}
+
+	// the shorter of the context deadline and the request timeout wins
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := c.SearchSmartAccountsByName(WithRequestTimeout(ctx, time.Minute), "example"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context deadline", err)
+	}
+	if time.Since(start) > 150*time.Millisecond {
+		t.Errorf("took %s, want the context deadline to apply", time.Since(start))
+	}
+	if d, ok := WithRequestTimeout(context.Background(), time.Second).Value(requestTimeoutKey{}).(time.Duration); !ok || d != time.Second {
+		t.Errorf("got %v, %v, want 1s stored in the context", d, ok)
+	}
+}
+
+func TestWithRequestHeaders(t *testing.T) {
+	var got http.Header
+	h := func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	ctx := WithRequestHeaders(context.Background(), http.Header{"x-tenant": {"a"}, "Accept": {"application/vnd.cisco+json"}})
+	ctx = WithRequestHeaders(ctx, http.Header{"X-Trace": {"1", "2"}, "Authorization": {"Bearer other"}, "X-Request-ID": {"mine"}})
+	if _, err := c.SearchSmartAccountsByName(ctx, "example"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Tenant") != "a" || !reflect.DeepEqual(got["X-Trace"], []string{"1", "2"}) {
+		t.Errorf("got headers %v, want both sets of headers added", got)
+	}
+	if got.Get("Accept") != "application/vnd.cisco+json" {
+		t.Errorf("got Accept %q, want it replaced", got.Get("Accept"))
+	}
+	if got.Get("Authorization") != "Bearer test-token" || got.Get("X-Request-ID") == "mine" || got.Get("X-Request-ID") == "" {
+		t.Errorf("got Authorization %q and request ID %q, want the client's", got.Get("Authorization"), got.Get("X-Request-ID"))
+	}
+
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Tenant") != "" || got.Get("Accept") != "application/json" {
+		t.Errorf("got headers %v, want none added without the context", got)
+	}
+}
+
+func TestWithRequestRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{"client default", context.Background(), 3},
+		{"enabled", WithRequestRetries(context.Background(), true), 3},
+		{"disabled", WithRequestRetries(context.Background(), false), 1},
+		{"last wins", WithRequestRetries(WithRequestRetries(context.Background(), false), true), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls counter
+			h := func(w http.ResponseWriter, r *http.Request) {
+				calls.inc()
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			c := newTestClient(t, http.HandlerFunc(h), WithRetries(2), WithBackoff(ConstantBackoff{}))
+			if _, err := c.SearchSmartAccountsByName(tt.ctx, "example"); err == nil {
+				t.Fatal("got nil, want an error")
+			}
+			if calls.get() != tt.want {
+				t.Errorf("got %d attempts, want %d", calls.get(), tt.want)
+			}
+		})
+	}
+
+	// enabling retries doesn't add any when the client has none
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	c.SearchSmartAccountsByName(WithRequestRetries(context.Background(), true), "example")
+	if calls.get() != 1 {
+		t.Errorf("got %d attempts, want 1 without WithRetries", calls.get())
+	}
+}
@@ -0,0 +1,45 @@
+package smartaccounts
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// defaultRequestIDHeader is the header used to send the request ID to Cisco.
+const defaultRequestIDHeader = "X-Request-ID"
+
+// WithRequestIDHeader sets the name of the header used to send the generated request ID with each request.  The
+// default is X-Request-ID.
+func WithRequestIDHeader(name string) Option {
+	return func(c *Client) {
+		if name != "" {
+			c.requestIDHeader = name
+		}
+	}
+}
+
+// RequestIDError wraps an error with the ID that was sent with the request, so that it can be quoted to Cisco
+// support.  Use errors.As to retrieve it.
+type RequestIDError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestIDError) Error() string {
+	return fmt.Sprintf("%s (request id: %s)", e.Err, e.RequestID)
+}
+
+func (e *RequestIDError) Unwrap() error {
+	return e.Err
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,40 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	var ids []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get("X-Correlation-ID"))
+		w.WriteHeader(http.StatusForbidden)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRequestIDHeader("X-Correlation-ID"))
+	seen := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+		var rerr *RequestIDError
+		if !errors.As(err, &rerr) || !errors.Is(err, ErrForbidden) {
+			t.Fatalf("got %v, want a *RequestIDError wrapping ErrForbidden", err)
+		}
+		id := ids[len(ids)-1]
+		if !uuidPattern.MatchString(id) {
+			t.Errorf("got id %q, want a version 4 UUID", id)
+		}
+		if rerr.RequestID != id || !strings.Contains(err.Error(), "(request id: "+id+")") {
+			t.Errorf("got %q, want it to include the id sent %q", err, id)
+		}
+		if seen[id] {
+			t.Errorf("got id %q more than once", id)
+		}
+		seen[id] = true
+	}
+}
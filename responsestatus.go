@@ -0,0 +1,67 @@
+package smartaccounts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithErrorOnStatusMessage controls whether a 200 response whose body reports a Status other than SUCCESS is
+// returned as an ErrStatus error.  The default is false, leaving the Status and StatusMessage fields on the
+// response for callers to inspect themselves, as before.
+func WithErrorOnStatusMessage(enabled bool) Option {
+	return func(c *Client) {
+		c.errorOnStatus = enabled
+	}
+}
+
+// statusResponse is implemented by the responses that report a status in their body.
+type statusResponse interface {
+	responseStatus() (status, message string)
+}
+
+func (r *SmartAccountResponse) responseStatus() (string, string) { return r.Status, r.StatusMessage }
+
+func (r *VirtualAccountResponse) responseStatus() (string, string) { return r.Status, r.StatusMessage }
+
+func (r *SearchResponse) responseStatus() (string, string) { return r.Status, r.StatusMessage }
+
+func (r *LicenseResponse) responseStatus() (string, string) { return r.Status, r.StatusMessage }
+
+func (r *licenseSummaryResponse) responseStatus() (string, string) { return r.Status, r.StatusMessage }
+
+func (r *SubscriptionSearchResponse) responseStatus() (string, string) { return r.Status, "" }
+
+// checkStatus returns an ErrStatus error if the response reports a status other than SUCCESS.  An empty
+// status is treated as success.
+func checkStatus(r statusResponse) error {
+	status, message := r.responseStatus()
+	if status == "" || strings.EqualFold(status, "SUCCESS") {
+		return nil
+	}
+	if message == "" {
+		return fmt.Errorf("%w: %s", ErrStatus, status)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrStatus, status, message)
+}
+
+// WithResponseValidator sets a function that is called with the endpoint name, e.g. "GetVirtualAccounts", and the
+// decoded response for every successful request, such as a *VirtualAccountResponse.  Returning an error fails the
+// call with that error, which allows custom invariants to be enforced in one place.  Responses of types the
+// validator isn't interested in should be ignored, as some methods decode into internal types.  Raw responses
+// retrieved as bytes are not validated.  The default is no validation.
+func WithResponseValidator(fn func(endpoint string, v interface{}) error) Option {
+	return func(c *Client) {
+		c.responseValidator = fn
+	}
+}
+
+// validateResponse calls the WithResponseValidator function, if set, for the decoded value v.
+func (c *Client) validateResponse(endpoint string, v interface{}) error {
+	if c.responseValidator == nil {
+		return nil
+	}
+	if _, ok := v.(*[]byte); ok {
+		return nil
+	}
+	return c.responseValidator(endpoint, v)
+}
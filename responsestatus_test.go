@@ -0,0 +1,70 @@
+package smartaccounts
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorOnStatusMessage(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, VirtualAccountResponse{Status: "ERROR", StatusMessage: "domain is not valid"})
+	}
+
+	c := newTestClient(t, http.HandlerFunc(h))
+	if _, err := c.GetVirtualAccounts("example.com"); err != nil {
+		t.Errorf("default: got %v, want nil", err)
+	}
+
+	c = newTestClient(t, http.HandlerFunc(h), WithErrorOnStatusMessage(true))
+	_, err := c.GetVirtualAccounts("example.com")
+	if !errors.Is(err, ErrStatus) || !strings.Contains(err.Error(), "ERROR: domain is not valid") {
+		t.Errorf("strict: got %v, want ErrStatus with the status message", err)
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	for _, status := range []string{"", "SUCCESS", "success"} {
+		if err := checkStatus(&SearchResponse{Status: status}); err != nil {
+			t.Errorf("%q: got %v, want nil", status, err)
+		}
+	}
+	if err := checkStatus(&SubscriptionSearchResponse{Status: "FAILED"}); !errors.Is(err, ErrStatus) || err.Error() != "ccw: unsuccessful status in response: FAILED" {
+		t.Errorf("got %v, want ErrStatus without a message", err)
+	}
+}
+
+func TestWithResponseValidator(t *testing.T) {
+	errInvalid := errors.New("no virtual accounts named")
+	var endpoints []string
+	validator := func(endpoint string, v interface{}) error {
+		endpoints = append(endpoints, endpoint)
+		if vr, ok := v.(*VirtualAccountResponse); ok {
+			for _, va := range vr.VirtualAccounts {
+				if va.Name == "" {
+					return errInvalid
+				}
+			}
+		}
+		return nil
+	}
+	vas := map[string][]VirtualAccount{"good.com": {{Name: "VA1"}}, "bad.com": {{Name: "VA1"}, {}}}
+	c := newTestClient(t, virtualAccountsHandler(t, vas), WithResponseValidator(validator))
+	if got, err := c.GetVirtualAccounts("good.com"); err != nil || len(got) != 1 {
+		t.Errorf("valid: got %v, %v, want VA1", got, err)
+	}
+	if got, err := c.GetVirtualAccounts("bad.com"); !errors.Is(err, errInvalid) || got != nil {
+		t.Errorf("invalid: got %v, %v, want the validator error", got, err)
+	}
+	if want := []string{"GetVirtualAccounts", "GetVirtualAccounts"}; !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("got endpoints %v, want %v", endpoints, want)
+	}
+
+	// a nil validator is ignored
+	c = newTestClient(t, virtualAccountsHandler(t, vas), WithResponseValidator(nil))
+	if _, err := c.GetVirtualAccounts("bad.com"); err != nil {
+		t.Errorf("nil validator: got %v, want no error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithResultCache enables a short lived in memory cache of successful list responses, currently those used by
+// GetAllSmartAccounts and GetVirtualAccounts, keyed by endpoint and parameters.  Repeated calls within ttl of a
+// successful response are answered from the cache without a request to Cisco.  Errors are never cached.  The
+// default is no caching.
+func WithResultCache(ttl time.Duration) Option {
+	return func(c *Client) {
+		if ttl > 0 {
+			c.resultCache = &resultCache{ttl: ttl, entries: map[string]resultCacheEntry{}}
+		}
+	}
+}
+
+// resultCache holds response bodies until they expire.  Bodies are stored rather than decoded values so that
+// each caller receives its own copy.
+type resultCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]resultCacheEntry
+}
+
+type resultCacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+func (rc *resultCache) get(key string) ([]byte, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(rc.entries, key)
+		return nil, false
+	}
+	return e.body, true
+}
+
+// set stores body for key, first removing any expired entries so that keys which aren't requested again don't
+// accumulate.
+func (rc *resultCache) set(key string, body []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	for k, e := range rc.entries {
+		if now.After(e.expires) {
+			delete(rc.entries, k)
+		}
+	}
+	rc.entries[key] = resultCacheEntry{body: body, expires: now.Add(rc.ttl)}
+}
+
+// makeCachedRequest is as makeRequest, but answers from the result cache when enabled with WithResultCache,
+// storing the response there once it has been successfully decoded.
+func (c *Client) makeCachedRequest(ctx context.Context, req *http.Request, v interface{}) error {
+	if c.resultCache == nil {
+		return c.makeRequest(ctx, req, v)
+	}
+	applyExtraQuery(ctx, req)
+	key := requestEndpoint(req) + " " + req.URL.String()
+	if body, ok := c.resultCache.get(key); ok {
+		return c.decodeResponse(requestEndpoint(req), bytes.NewReader(body), v)
+	}
+	var body []byte
+	if err := c.makeRequest(ctx, req, &body); err != nil {
+		return err
+	}
+	if err := c.decodeResponse(requestEndpoint(req), bytes.NewReader(body), v); err != nil {
+		return err
+	}
+	c.resultCache.set(key, body)
+	return nil
+}
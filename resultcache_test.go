@@ -0,0 +1,134 @@
+package smartaccounts
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResultCacheHit(t *testing.T) {
+	var calls counter
+	vas := virtualAccountsHandler(t, map[string][]VirtualAccount{
+		"example.com": {{Name: "VA1"}, {Name: "VA2"}},
+		"example.org": {{Name: "VA3"}},
+	})
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		vas(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithResultCache(time.Minute))
+
+	first, err := c.GetVirtualAccounts("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first[0].Name = "changed"
+	second, err := c.GetVirtualAccounts("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.get(); got != 1 {
+		t.Errorf("got %d requests, want 1 with the second call answered from the cache", got)
+	}
+	if want := []VirtualAccount{{Name: "VA1"}, {Name: "VA2"}}; !reflect.DeepEqual(second, want) {
+		t.Errorf("got %v from the cache, want %v", second, want)
+	}
+
+	// different parameters are cached separately
+	if other, err := c.GetVirtualAccounts("example.org"); err != nil || len(other) != 1 || other[0].Name != "VA3" {
+		t.Errorf("got %v, %v, want VA3", other, err)
+	}
+	if got := calls.get(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestResultCacheDisabledByDefault(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		writeJSON(t, w, SmartAccountResponse{Accounts: []SmartAccount{{AccountName: "Example"}}})
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetAllSmartAccounts(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.get(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestResultCacheErrorsNotCached(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if calls.inc() == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(t, w, SmartAccountResponse{Accounts: []SmartAccount{{AccountName: "Example"}}})
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithResultCache(time.Minute))
+	if _, err := c.GetAllSmartAccounts(); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+	for i := 0; i < 2; i++ {
+		if got, err := c.GetAllSmartAccounts(); err != nil || len(got) != 1 {
+			t.Fatalf("got %v, %v, want the account", got, err)
+		}
+	}
+	if got := calls.get(); got != 2 {
+		t.Errorf("got %d requests, want 2 with the error not cached", got)
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	rc := &resultCache{ttl: time.Minute, entries: map[string]resultCacheEntry{}}
+	rc.set("a", []byte("a"))
+	rc.set("b", []byte("b"))
+	if body, ok := rc.get("a"); !ok || string(body) != "a" {
+		t.Fatalf("got %q, %v, want a", body, ok)
+	}
+
+	e := rc.entries["a"]
+	e.expires = time.Now().Add(-time.Second)
+	rc.entries["a"] = e
+	if _, ok := rc.get("a"); ok {
+		t.Error("got an expired entry, want none")
+	}
+
+	// expired entries that are never requested again are removed when another is stored
+	e = rc.entries["b"]
+	e.expires = time.Now().Add(-time.Second)
+	rc.entries["b"] = e
+	rc.set("c", []byte("c"))
+	if _, ok := rc.entries["b"]; ok || len(rc.entries) != 1 {
+		t.Errorf("got entries %v, want only c", rc.entries)
+	}
+}
+
+func TestResultCacheConcurrent(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		writeJSON(t, w, SmartAccountResponse{Accounts: []SmartAccount{{AccountName: "Example"}}})
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithResultCache(time.Minute))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.GetAllSmartAccounts(); err != nil || len(got) != 1 {
+				t.Errorf("got %v, %v, want the account", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := calls.get(); got < 1 || got > 20 {
+		t.Errorf("got %d requests, want between 1 and 20", got)
+	}
+}
@@ -0,0 +1,212 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultRetryAfterCap is the longest we'll wait for a Retry-After before giving up.
+	defaultRetryAfterCap = 2 * time.Minute
+	// baseRetryDelay is the initial delay used for the exponential backoff between retries.
+	baseRetryDelay = 500 * time.Millisecond
+	// maxRetryDelay is the largest delay used for the exponential backoff between retries.
+	maxRetryDelay = 30 * time.Second
+	// defaultTokenRetries is the number of times a failed token request is retried.
+	defaultTokenRetries = 2
+)
+
+// WithRetries sets the maximum number of times a request will be retried when Cisco responds with
+// a retryable status (429, 502, 503 or 504), or the request fails with a retryable network error as decided by
+// WithRetryableErrors.  The default is 0, i.e. no retries.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.maxRetries = n
+		}
+	}
+}
+
+// WithTokenRetries sets the maximum number of times a token request will be retried when the token endpoint
+// responds with a 5xx status or the request fails with a retryable network error.  The default is 2.
+func WithTokenRetries(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.tokenRetries = n
+		}
+	}
+}
+
+// WithRetryAfterCap sets the longest the client will wait when Cisco responds with a Retry-After header.
+// If the requested wait is longer than this, the client will give up and return the original error.
+// The default is 2 minutes.
+func WithRetryAfterCap(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.retryAfterCap = d
+		}
+	}
+}
+
+// WithRetryableErrors sets the function used to decide whether a request that failed with a network error, i.e.
+// without receiving a response, should be retried.  The default is DefaultRetryableError.
+func WithRetryableErrors(fn func(error) bool) Option {
+	return func(c *Client) {
+		if fn != nil {
+			c.retryableError = fn
+		}
+	}
+}
+
+// DefaultRetryableError reports whether err is a transient network error worth retrying, i.e. a timeout or a
+// refused or reset connection.  Permanent failures such as TLS certificate errors are not retried.
+func DefaultRetryableError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// WithMaxElapsedTime sets the longest a single request may spend being retried, including the delays between
+// attempts.  A retry that would finish its delay after this has elapsed isn't made, and the last error is
+// returned instead.  The context deadline still applies.  The default is no limit other than WithRetries.
+func WithMaxElapsedTime(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.maxElapsedTime = d
+		}
+	}
+}
+
+// isRetryableStatus reports whether a request that failed with the given status should be retried.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the Retry-After header, which may be given in either
+// seconds or as an HTTP date.  It returns zero if the header is missing or invalid.
+func retryAfter(res *http.Response) time.Duration {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// BackoffStrategy determines the delay before each retry.  The attempt is zero based, so the delay before
+// the first retry is NextDelay(0).
+type BackoffStrategy interface {
+	NextDelay(attempt int) time.Duration
+}
+
+// WithBackoff sets the strategy used to determine the delay between retries.  The default is an
+// ExponentialBackoff starting at 500ms, up to a maximum of 30s, with jitter.  A Retry-After header from
+// Cisco takes precedence over the strategy.
+func WithBackoff(strategy BackoffStrategy) Option {
+	return func(c *Client) {
+		if strategy != nil {
+			c.backoff = strategy
+		}
+	}
+}
+
+// ExponentialBackoff doubles the delay for each attempt, starting at Base, up to Max.  With Jitter set, the
+// delay is randomised between half and all of the calculated delay.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter bool
+}
+
+// NextDelay returns the delay before the given attempt.
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	d := b.Base
+	for i := 0; i < attempt && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter && d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)))
+	}
+	return d
+}
+
+// ConstantBackoff waits the same Delay before every attempt.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// NextDelay returns the delay before the given attempt.
+func (b ConstantBackoff) NextDelay(int) time.Duration {
+	return b.Delay
+}
+
+// defaultBackoff is the strategy used when none is set with WithBackoff.
+var defaultBackoff = ExponentialBackoff{Base: baseRetryDelay, Max: maxRetryDelay, Jitter: true}
+
+// sleepContext waits for the given duration, returning early with the context error if it is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// WithBeforeRetry sets a function that is called before each retry, with the retry attempt number (starting
+// at 1), the request, the error from the previous attempt and the delay before the retry is made.
+func WithBeforeRetry(fn func(attempt int, req *http.Request, lastErr error, delay time.Duration)) Option {
+	return func(c *Client) {
+		c.beforeRetry = fn
+	}
+}
+
+// authRetryWindow is how soon after fetching a token a 403 is considered to be due to the token not having
+// propagated yet, and authRetryDelay is how long to wait before retrying.
+const (
+	authRetryWindow = 30 * time.Second
+	authRetryDelay  = 2 * time.Second
+)
+
+// WithAuthRetryOn403 enables retrying a request once, after a short delay, if it fails with a 403 Forbidden
+// within 30 seconds of a new token being fetched.  Cisco occasionally rejects a brand new token that hasn't
+// propagated yet, but since a 403 usually means the request genuinely isn't allowed, this is off by default.
+func WithAuthRetryOn403(enabled bool) Option {
+	return func(c *Client) {
+		c.authRetry403 = enabled
+	}
+}
+
+// shouldRetry403 reports whether the error is a 403 received shortly after fetching a new token.
+func (c *Client) shouldRetry403(err error) bool {
+	if !c.authRetry403 || !errors.Is(err, ErrForbidden) {
+		return false
+	}
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return !c.tokenFetchedAt.IsZero() && time.Since(c.tokenFetchedAt) < authRetryWindow
+}
@@ -0,0 +1,422 @@
+package smartaccounts
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterCap(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(3), WithRetryAfterCap(time.Second))
+	start := time.Now()
+	_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	var ee *EndpointError
+	if !errors.As(err, &ee) || ee.Status != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want the original 503 error", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("took %s, want to give up without waiting", time.Since(start))
+	}
+	if calls.get() != 1 {
+		t.Errorf("got %d requests, want 1", calls.get())
+	}
+}
+
+func TestRetryAfterRespectsContext(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(3))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.SearchSmartAccountsByName(ctx, "example")
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("got %v, want ErrTooManyRequests", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("took %s, want the wait to stop with the context", time.Since(start))
+	}
+	if calls.get() != 1 {
+		t.Errorf("got %d requests, want 1", calls.get())
+	}
+}
+
+func TestBeforeRetry(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	var attempts []int
+	var delays []time.Duration
+	before := func(attempt int, req *http.Request, lastErr error, delay time.Duration) {
+		var ee *EndpointError
+		if req == nil || !errors.As(lastErr, &ee) || ee.Status != http.StatusBadGateway {
+			t.Errorf("attempt %d: got request %v and error %v, want the request and the 502", attempt, req, lastErr)
+		}
+		attempts = append(attempts, attempt)
+		delays = append(delays, delay)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(3), WithBackoff(ConstantBackoff{Delay: time.Millisecond}), WithBeforeRetry(before))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("got attempts %v, want %v", attempts, want)
+	}
+	for _, d := range delays {
+		if d != time.Millisecond {
+			t.Errorf("got delays %v, want the backoff delay", delays)
+			break
+		}
+	}
+	if calls.get() != 4 {
+		t.Errorf("got %d requests, want 4", calls.get())
+	}
+}
+
+func TestTokenRetries(t *testing.T) {
+	tokenHandler := func(tokens *counter, statuses ...int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !isTokenRequest(r) {
+				if got := r.Header.Get("Authorization"); got != "Bearer server-token" {
+					t.Errorf("got Authorization %q, want the server's token", got)
+				}
+				searchHandler(t)(w, r)
+				return
+			}
+			if n := tokens.inc(); n <= len(statuses) {
+				w.WriteHeader(statuses[n-1])
+				return
+			}
+			serveToken(t, w)
+		}
+	}
+
+	t.Run("503 then 200", func(t *testing.T) {
+		var tokens counter
+		c := newTestClient(t, tokenHandler(&tokens, http.StatusServiceUnavailable), WithFixedToken(""))
+		if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+			t.Fatal(err)
+		}
+		if tokens.get() != 2 {
+			t.Errorf("got %d token requests, want 2", tokens.get())
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		var tokens counter
+		c := newTestClient(t, tokenHandler(&tokens, 503, 503, 503), WithFixedToken(""), WithTokenRetries(1))
+		_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+		if !errors.Is(err, ErrInternalError) {
+			t.Errorf("got %v, want ErrInternalError", err)
+		}
+		if tokens.get() != 2 {
+			t.Errorf("got %d token requests, want 2", tokens.get())
+		}
+	})
+
+	t.Run("401 not retried", func(t *testing.T) {
+		var tokens counter
+		c := newTestClient(t, tokenHandler(&tokens, http.StatusUnauthorized), WithFixedToken(""))
+		_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("got %v, want ErrUnauthorized", err)
+		}
+		if tokens.get() != 1 {
+			t.Errorf("got %d token requests, want 1", tokens.get())
+		}
+	})
+}
+
+func TestWithAuthRetryOn403(t *testing.T) {
+	forbiddenOnce := func(calls *counter) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if isTokenRequest(r) {
+				serveToken(t, w)
+				return
+			}
+			if calls.inc() == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			searchHandler(t)(w, r)
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+		want    int
+	}{
+		{"enabled", []Option{WithFixedToken(""), WithAuthRetryOn403(true)}, false, 2},
+		{"disabled", []Option{WithFixedToken("")}, true, 1},
+		// a fixed token was never fetched, so a 403 can't be due to it not having propagated
+		{"fixed token", []Option{WithAuthRetryOn403(true)}, true, 1},
+	} {
+		var calls counter
+		c := newTestClient(t, forbiddenOnce(&calls), tt.opts...)
+		_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+		if gotErr := errors.Is(err, ErrForbidden); gotErr != tt.wantErr || (!tt.wantErr && err != nil) {
+			t.Errorf("%s: got %v, want forbidden %v", tt.name, err, tt.wantErr)
+		}
+		if calls.get() != tt.want {
+			t.Errorf("%s: got %d requests, want %d", tt.name, calls.get(), tt.want)
+		}
+	}
+}
+
+// recordingBackoff is a custom BackoffStrategy that records the attempts it is asked about.
+type recordingBackoff struct {
+	attempts []int
+}
+
+func (b *recordingBackoff) NextDelay(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return time.Duration(attempt+1) * time.Millisecond
+}
+
+func TestBackoffStrategies(t *testing.T) {
+	exp := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second}
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if got := exp.NextDelay(attempt); got != want*time.Millisecond {
+			t.Errorf("exponential attempt %d: got %s, want %s", attempt, got, want*time.Millisecond)
+		}
+	}
+	if got := (ExponentialBackoff{Base: time.Millisecond}).NextDelay(10); got != 1024*time.Millisecond {
+		t.Errorf("exponential without a maximum: got %s, want 1.024s", got)
+	}
+
+	jitter := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second, Jitter: true}
+	for i := 0; i < 100; i++ {
+		if got := jitter.NextDelay(2); got < 200*time.Millisecond || got >= 400*time.Millisecond {
+			t.Fatalf("jitter: got %s, want between 200ms and 400ms", got)
+		}
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		if got := (ConstantBackoff{Delay: 250 * time.Millisecond}).NextDelay(attempt); got != 250*time.Millisecond {
+			t.Errorf("constant attempt %d: got %s, want 250ms", attempt, got)
+		}
+	}
+}
+
+func TestWithBackoffCustom(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	var delays []time.Duration
+	before := func(_ int, _ *http.Request, _ error, delay time.Duration) {
+		delays = append(delays, delay)
+	}
+	b := &recordingBackoff{}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(3), WithBackoff(b), WithBeforeRetry(before))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(b.attempts, want) {
+		t.Errorf("got attempts %v, want %v", b.attempts, want)
+	}
+	if want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("got delays %v, want %v", delays, want)
+	}
+}
+
+// timeoutError is a net.Error that reports a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestDefaultRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "read", Err: timeoutError{}}}, true},
+		{"deadline", &url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}, true},
+		{"refused", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, true},
+		{"reset", fmt.Errorf("read: %w", &net.OpError{Op: "read", Err: syscall.ECONNRESET}), true},
+		{"cert", &url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{"hostname", &url.Error{Op: "Get", URL: "https://example.com", Err: x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}}, false},
+		{"dns", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}}, false},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := DefaultRetryableError(tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryNetworkTimeout(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(2), WithBackoff(ConstantBackoff{}))
+	c.HTTPClient.Timeout = 20 * time.Millisecond
+	_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if got := calls.get(); got != 3 {
+		t.Errorf("got %d attempts, want 3", got)
+	}
+}
+
+func TestNoRetryOnCertificateError(t *testing.T) {
+	var calls counter
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attempts counter
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts.inc()
+		r := req.Clone(req.Context())
+		r.URL.Host, r.Host = u.Host, ""
+		// the default transport doesn't trust the test server's certificate
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	c := New("id", "secret", "user", "pass", WithFixedToken("test-token"), WithoutRateLimiting(),
+		WithRetries(2), WithBackoff(ConstantBackoff{}), withTransport(rt))
+	_, err = c.SearchSmartAccountsByName(context.Background(), "example")
+	var certErr x509.UnknownAuthorityError
+	if !errors.As(err, &certErr) {
+		t.Fatalf("got %v, want an x509.UnknownAuthorityError", err)
+	}
+	if got := attempts.get(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+	if got := calls.get(); got != 0 {
+		t.Errorf("got %d requests to the server, want 0", got)
+	}
+}
+
+func TestWithRetryableErrors(t *testing.T) {
+	var attempts counter
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts.inc()
+		return nil, errors.New("boom")
+	})
+	var seen []error
+	classify := func(err error) bool {
+		seen = append(seen, err)
+		return true
+	}
+	c := New("id", "secret", "user", "pass", WithFixedToken("test-token"), WithoutRateLimiting(),
+		WithRetries(2), WithBackoff(ConstantBackoff{}), withTransport(rt), WithRetryableErrors(classify))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err == nil {
+		t.Fatal("got nil, want an error")
+	}
+	if got := attempts.get(); got != 3 || len(seen) != 3 {
+		t.Errorf("got %d attempts and %d classifications, want 3 of each", got, len(seen))
+	}
+}
+
+// roundTripFunc adapts a function to an http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithMaxElapsedTime(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	var delays []time.Duration
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(10), WithBackoff(ConstantBackoff{Delay: 40 * time.Millisecond}),
+		WithMaxElapsedTime(100*time.Millisecond),
+		WithBeforeRetry(func(attempt int, req *http.Request, lastErr error, delay time.Duration) {
+			delays = append(delays, delay)
+		}))
+	start := time.Now()
+	_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	elapsed := time.Since(start)
+	var ee *EndpointError
+	if !errors.As(err, &ee) || ee.Status != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want the last 503 error", err)
+	}
+	// two 40ms delays fit within 100ms, a third would exceed it
+	if got := calls.get(); got != 3 {
+		t.Errorf("got %d attempts, want 3", got)
+	}
+	if len(delays) != 2 {
+		t.Errorf("got %d retries, want 2", len(delays))
+	}
+	// the budget covers the delays, so allow some time for the final request
+	if elapsed > 150*time.Millisecond {
+		t.Errorf("took %s, want to stop at around the 100ms budget", elapsed)
+	}
+}
+
+func TestWithMaxElapsedTimeRetryAfter(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(3), WithMaxElapsedTime(time.Second))
+	start := time.Now()
+	_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("got %v, want ErrTooManyRequests", err)
+	}
+	if time.Since(start) > 500*time.Millisecond || calls.get() != 1 {
+		t.Errorf("took %s with %d attempts, want to give up at once rather than wait beyond the budget", time.Since(start), calls.get())
+	}
+}
+
+func TestWithMaxElapsedTimeContext(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(10), WithBackoff(ConstantBackoff{Delay: 20 * time.Millisecond}),
+		WithMaxElapsedTime(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.SearchSmartAccountsByName(ctx, "example")
+	if err == nil {
+		t.Fatal("got nil, want an error")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("took %s, want the context deadline to stop retries before the budget", time.Since(start))
+	}
+}
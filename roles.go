@@ -0,0 +1,51 @@
+package smartaccounts
+
+import (
+	"context"
+	"strings"
+)
+
+// RolesByDomain returns the roles held by the authenticated user for each of the provided accounts, keyed
+// by account domain.  Accounts with no roles are included with an empty slice.
+func RolesByDomain(accounts []SmartAccount) map[string][]string {
+	roles := make(map[string][]string, len(accounts))
+	for _, sa := range accounts {
+		r := roles[sa.AccountDomain]
+		if r == nil {
+			r = []string{}
+		}
+		for _, role := range sa.Roles {
+			r = append(r, role.Role)
+		}
+		roles[sa.AccountDomain] = r
+	}
+	return roles
+}
+
+// HasRole reports whether the authenticated user holds the given role on the account.  The comparison ignores case.
+func HasRole(account SmartAccount, role string) bool {
+	for _, r := range account.Roles {
+		if strings.EqualFold(r.Role, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRoleForDomain retrieves the smart accounts the user has access to and reports whether the user holds the given
+// role on the account with the given domain.  It returns false if the user has no access to the domain at all.
+func (c *Client) HasRoleForDomain(ctx context.Context, domain, role string) (_ bool, err error) {
+	defer wrapOp(&err, "HasRoleForDomain(%s, %s)", domain, role)
+	ctx, cancel := c.methodContext(ctx, "HasRoleForDomain")
+	defer cancel()
+	accounts, err := c.getAllSmartAccounts(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, sa := range accounts {
+		if strings.EqualFold(sa.AccountDomain, domain) && HasRole(sa, role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,80 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRolesByDomain(t *testing.T) {
+	accounts := []SmartAccount{
+		{AccountDomain: "a.com", Roles: []Role{{Role: "SMART_ACCOUNT_ADMINISTRATOR"}, {Role: "VIRTUAL_ACCOUNT_USER"}}},
+		{AccountDomain: "b.com", Roles: []Role{{Role: "SMART_ACCOUNT_USER"}}},
+		{AccountDomain: "c.com"},
+	}
+	want := map[string][]string{
+		"a.com": {"SMART_ACCOUNT_ADMINISTRATOR", "VIRTUAL_ACCOUNT_USER"},
+		"b.com": {"SMART_ACCOUNT_USER"},
+		"c.com": {},
+	}
+	if got := RolesByDomain(accounts); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	account := SmartAccount{Roles: []Role{{Role: "SMART_ACCOUNT_ADMINISTRATOR"}, {Role: "VIRTUAL_ACCOUNT_USER"}}}
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{"SMART_ACCOUNT_ADMINISTRATOR", true},
+		{"smart_account_administrator", true},
+		{"Virtual_Account_User", true},
+		{"SMART_ACCOUNT_USER", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := HasRole(account, tt.role); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.role, got, tt.want)
+		}
+	}
+	if HasRole(SmartAccount{}, "SMART_ACCOUNT_USER") {
+		t.Error("no roles: got true, want false")
+	}
+}
+
+func TestHasRoleForDomain(t *testing.T) {
+	f := &fakeCisco{accounts: []SmartAccount{
+		{AccountDomain: "a.com", Roles: []Role{{Role: "SMART_ACCOUNT_ADMINISTRATOR"}}},
+		{AccountDomain: "b.com", Roles: []Role{{Role: "SMART_ACCOUNT_USER"}}},
+	}}
+	c := newTestClient(t, f.handler(t))
+	tests := []struct {
+		domain, role string
+		want         bool
+	}{
+		{"a.com", "smart_account_administrator", true},
+		{"A.COM", "SMART_ACCOUNT_ADMINISTRATOR", true},
+		{"a.com", "SMART_ACCOUNT_USER", false},
+		{"b.com", "SMART_ACCOUNT_USER", true},
+		{"b.com", "SMART_ACCOUNT_ADMINISTRATOR", false},
+		{"unknown.com", "SMART_ACCOUNT_USER", false},
+	}
+	for _, tt := range tests {
+		got, err := c.HasRoleForDomain(context.Background(), tt.domain, tt.role)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s: got %v, %v, want %v", tt.domain, tt.role, got, err, tt.want)
+		}
+	}
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	c = newTestClient(t, http.HandlerFunc(h))
+	if got, err := c.HasRoleForDomain(context.Background(), "a.com", "SMART_ACCOUNT_USER"); got || !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("lookup failure: got %v, %v, want false and ErrUnauthorized", got, err)
+	}
+}
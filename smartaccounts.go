@@ -3,33 +3,98 @@ package smartaccounts
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 )
 
-// Token represents a Cisco Access Token
+// Token represents a Cisco Access Token.  Raw holds every field returned by the token endpoint, including any
+// not modelled here such as issued_at, which can be useful when diagnosing token issues.
 type Token struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int64  `json:"expires_in"`
-	ExpiresAt   time.Time
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	ExpiresAt    time.Time
+	Raw          map[string]interface{} `json:"-"`
 }
 
-// Client represents the entry point to the library
+// Client represents the entry point to the library.
+//
+// A Client is safe for concurrent use by multiple goroutines, and a single Client should be shared rather than one
+// created per request, so that the token and rate limiter are shared.  The token is protected by a mutex, so only one
+// goroutine requests a new token while the others wait for it, and the caches, Last-Modified values and jitter source
+// are each protected by their own mutex.  The options are applied once by New and the configuration isn't changed
+// afterwards.  The exception is HTTPClient, which may be replaced, but only before the Client is shared.  Values
+// supplied by callers are called concurrently: a ResponseCache, Logger, BackoffStrategy, and the callbacks given to
+// options such as WithBeforeRetry, WithOnTokenError and WithResponseValidator must be safe for concurrent use.
 type Client struct {
 	clientID   string
 	secret     string
 	username   string
 	password   string
 	token      *Token
+	tokenMu    sync.Mutex
 	lim        *rate.Limiter
 	HTTPClient *http.Client
+
+	rateLimitMode       RateLimitMode
+	maxRetries          int
+	retryAfterCap       time.Duration
+	concurrency         int
+	validateTotals      bool
+	cache               ResponseCache
+	startupJitter       time.Duration
+	requestJitter       time.Duration
+	startupOnce         sync.Once
+	rng                 *rand.Rand
+	rngMu               sync.Mutex
+	beforeRetry         func(attempt int, req *http.Request, lastErr error, delay time.Duration)
+	errorOnStatus       bool
+	onTrace             func(req *http.Request, timings ConnTimings)
+	tokenRetries        int
+	responseSizeLimit   int64
+	lastModified        *lastModifiedStore
+	tokenClient         *http.Client
+	minTLSVersion       uint16
+	maxIdleConns        *int
+	maxIdleConnsPerHost *int
+	idleConnTimeout     *time.Duration
+	methodTimeouts      map[string]time.Duration
+	gzip                bool
+	onTokenError        func(error)
+	fixedToken          string
+	tokenFetchedAt      time.Time
+	authRetry403        bool
+	requestIDHeader     string
+	backoff             BackoffStrategy
+	secretSource        func() (clientID, secret, username, password string, err error)
+	autoFetchVAs        bool
+	useNumber           bool
+	defaultCallTimeout  time.Duration
+	retryableError      func(error) bool
+	resultCache         *resultCache
+	logger              Logger
+	treat404AsEmpty     bool
+	accountsVersion     AccountsAPIVersion
+	responseValidator   func(endpoint string, v interface{}) error
+	maxElapsedTime      time.Duration
+	codec               Codec
+	recorder            *recorder
+	newTicker           func(time.Duration) ticker
+	rawHosts            map[string]bool
 }
 
 // Err implements the error interface so we can have constant errors.
@@ -39,14 +104,37 @@ func (e Err) Error() string {
 	return string(e)
 }
 
+// wrapOp labels a non nil error with the operation that returned it, e.g. "GetVirtualAccounts(example.com)",
+// while still allowing errors.Is and errors.As to match the wrapped error.
+func wrapOp(err *error, format string, args ...interface{}) {
+	if *err != nil {
+		*err = fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), *err)
+	}
+}
+
+// ErrRateLimited is returned when the client's own rate limiter disallows a request and WithRateLimitMode
+// is set to RateLimitFail; the request was never sent.  ErrTooManyRequests is returned when Cisco itself
+// responded with a 429 Too Many Requests.
 var (
-	ErrBadRequest      = Err("ccw: bad request")
-	ErrUnauthorized    = Err("ccw: unauthorized request")
-	ErrForbidden       = Err("ccw: forbidden")
-	ErrNotFound        = Err("ccw: not found")
-	ErrInternalError   = Err("ccw: internal error")
-	ErrUnknown         = Err("ccw: unexpected error occurred")
-	ErrNoSubscriptions = Err("ccw: no valid subscriptions found") // received from EA Consumption specifically
+	ErrBadRequest         = Err("ccw: bad request")
+	ErrUnauthorized       = Err("ccw: unauthorized request")
+	ErrForbidden          = Err("ccw: forbidden")
+	ErrNotFound           = Err("ccw: not found")
+	ErrInternalError      = Err("ccw: internal error")
+	ErrUnknown            = Err("ccw: unexpected error occurred")
+	ErrNoSubscriptions    = Err("ccw: no valid subscriptions found") // received from EA Consumption specifically
+	ErrRateLimited        = Err("ccw: request not allowed by client rate limiter")
+	ErrTooManyRequests    = Err("ccw: too many requests")
+	ErrNoVirtualAccounts  = Err("ccw: no virtual accounts provided")
+	ErrTotalMismatch      = Err("ccw: records collected do not match total")
+	ErrStatus             = Err("ccw: unsuccessful status in response")
+	ErrResponseTooLarge   = Err("ccw: response body exceeds size limit")
+	ErrNotModified        = Err("ccw: not modified")
+	ErrNetwork            = Err("ccw: network error")
+	ErrMissingCredentials = Err("ccw: missing credentials")
+	ErrAmbiguousAccount   = Err("ccw: more than one smart account matches")
+	ErrHostNotAllowed     = Err("ccw: host not allowed for raw requests")
+	ErrTransportConflict  = Err("ccw: option sets a transport that would be replaced")
 )
 
 // SmartAccountResponse represents the top level response on requesting smart accounts
@@ -58,6 +146,7 @@ type SmartAccountResponse struct {
 
 // SmartAccount represents an individual smart account, allowing you to easily add Virtual Accounts and Licenses
 type SmartAccount struct {
+	ID              int               `json:"id,omitempty"` // Not returned by GetAllSmartAccounts, see SearchAccount.ToSmartAccount
 	AccountStatus   string            `json:"accountStatus"`
 	AccountDomain   string            `json:"accountDomain"`
 	AccountName     string            `json:"accountName"`
@@ -104,9 +193,22 @@ type SearchAccount struct {
 	Status string `json:"status"`
 }
 
+// ToSmartAccount maps the SearchAccount to a partial SmartAccount, populating the ID, AccountDomain, AccountName,
+// AccountType and AccountStatus fields.  Roles, VirtualAccounts and Licenses are left as their zero values.
+func (a SearchAccount) ToSmartAccount() SmartAccount {
+	return SmartAccount{
+		ID:            a.ID,
+		AccountDomain: a.Domain,
+		AccountName:   a.Name,
+		AccountType:   a.Type,
+		AccountStatus: a.Status,
+	}
+}
+
 // LicenseRequest represents the details required to fetch license usage details
 type LicenseRequest struct {
 	VirtualAccounts []string `json:"virtualAccounts"`
+	Licenses        []string `json:"licenses,omitempty"` // not documented by Cisco, see GetSmartLicenseUsageByName
 	Limit           int      `json:"limit"`
 	Offset          int      `json:"offset"`
 }
@@ -154,87 +256,168 @@ type LicenseDetail struct {
 	Status         string `json:"status"`
 }
 
-// New returns a new CCW client for accessing the smart accounts API
-func New(client_id, client_secret, username, password string) *Client {
+// New returns a new CCW client for accessing the smart accounts API.  Optional configuration can be
+// provided using the With... options.
+func New(client_id, client_secret, username, password string, opts ...Option) *Client {
 	limiter := rate.NewLimiter(100, 1)
-	return &Client{
+	c := &Client{
 		clientID: client_id,
 		secret:   client_secret,
 		username: username,
 		password: password,
 		lim:      limiter,
+
+		retryAfterCap:      defaultRetryAfterCap,
+		tokenRetries:       defaultTokenRetries,
+		concurrency:        defaultConcurrency,
+		requestIDHeader:    defaultRequestIDHeader,
+		backoff:            defaultBackoff,
+		retryableError:     DefaultRetryableError,
+		defaultCallTimeout: defaultCallTimeout,
+		minTLSVersion:      tls.VersionTLS12,
 		HTTPClient: &http.Client{
 			Timeout: 60 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	switch t := c.HTTPClient.Transport.(type) {
+	case nil:
+		c.HTTPClient.Transport = newTransport(c)
+	case *http.Transport:
+		hc := *c.HTTPClient
+		hc.Transport = c.configureTransport(t)
+		c.HTTPClient = &hc
+	}
+	// token requests share the configured transport and timeout, but aren't recorded
+	c.tokenClient = &http.Client{Transport: c.HTTPClient.Transport, Timeout: c.HTTPClient.Timeout}
+	if c.recorder != nil {
+		c.recorder.next = c.HTTPClient.Transport
+		c.recorder.limitBody = c.limitBody
+		c.HTTPClient.Transport = c.recorder
+	}
+	return c
 }
 
 // GetSmartLicenseUsage returns the Smart License Usage as per the Cisco documentation:
 // https://apidocs-prod.cisco.com/explore;category=6083723a25042e9035f6a753;sgroup=6083723b25042e9035f6a775;epname=6131c97117b4092245f49d9f
 // Requires the provided SmartAccount to have the AccountDomain field specified and a list of virtual accounts populated.
-func (c *Client) GetSmartLicenseUsage(sa SmartAccount) (*[]License, error) {
-	licenses := []License{}
-	for _, va := range *sa.VirtualAccounts {
-		// log.Println("retrieving licenses for", sa.AccountDomain, va.Name)
-		offset, limit := 0, 100
-		for {
-			url := fmt.Sprintf("https://apx.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts/%s/licenses", sa.AccountDomain)
-			method := "POST"
-			payload, err := json.Marshal(&LicenseRequest{Offset: offset, Limit: limit, VirtualAccounts: []string{va.Name}})
-			if err != nil {
-				return nil, err
-			}
-			req, err := http.NewRequest(method, url, bytes.NewReader(payload))
-			if err != nil {
-				return nil, err
-			}
-			var lr LicenseResponse
-			err = c.makeRequest(context.Background(), req, &lr)
-			if err != nil {
-				log.Printf("error retrieving licenses for %s: %s: %s", sa.AccountDomain, va.Name, err)
-				break
-			}
-			licenses = append(licenses, lr.Licenses...)
-			if lr.TotalRecords < limit {
-				break
-			}
-			offset += limit
-			if offset > lr.TotalRecords {
-				break
-			}
+// The licenses are returned sorted by VirtualAccount and then License.  If VirtualAccounts is nil, ErrNoVirtualAccounts
+// is returned, unless WithAutoFetchVirtualAccounts is set.  Should the licenses for a virtual account not be retrieved
+// in full, the error is logged and that virtual account is left out.
+func (c *Client) GetSmartLicenseUsage(sa SmartAccount) (_ *[]License, err error) {
+	defer wrapOp(&err, "GetSmartLicenseUsage(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(context.Background(), "GetSmartLicenseUsage")
+	defer cancel()
+	return c.getSmartLicenseUsage(ctx, sa)
+}
+
+func (c *Client) getSmartLicenseUsage(ctx context.Context, sa SmartAccount) (*[]License, error) {
+	licenses, failures, err := c.getVirtualAccountLicenses(ctx, c.getLicensesPage, sa)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if c.logger != nil {
+			c.logError(ctx, "error retrieving licenses", failures[name], "endpoint", endpointLicenses.name, "domain", sa.AccountDomain, "virtual_account", name)
+			continue
 		}
+		log.Printf("error retrieving licenses for %s: %s: %s", sa.AccountDomain, name, failures[name])
 	}
 	return &licenses, nil
 }
 
+// HydrateLicenses populates the Licenses field of the provided SmartAccount with the licenses from all of its
+// virtual accounts, aggregated into a single slice.  As with GetSmartLicenseUsage, the AccountDomain and
+// VirtualAccounts fields must already be populated, unless WithAutoFetchVirtualAccounts is set.
+func (c *Client) HydrateLicenses(ctx context.Context, sa *SmartAccount) (err error) {
+	defer wrapOp(&err, "HydrateLicenses(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "HydrateLicenses")
+	defer cancel()
+	licenses, err := c.getSmartLicenseUsage(ctx, *sa)
+	if err != nil {
+		return err
+	}
+	sa.Licenses = licenses
+	return nil
+}
+
 // SearchSmartAccountsByDomain will return any entry that matches your search, so be careful, since a search for
 // e.g. work.com will return wework.com, wewontwork.com, wedontwork.com etc.
 // Also note that there is a hardcoded limit of 1000 entries for the response.
-func (c *Client) SearchSmartAccountsByDomain(domain string) (*SearchResponse, error) {
-	url := fmt.Sprintf("https://apx.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts/search?domain=%s&type=CUSTOMER&limit=1000&offset=0", domain)
-	method := "GET"
-	req, err := http.NewRequest(method, url, nil)
+func (c *Client) SearchSmartAccountsByDomain(domain string) (_ *SearchResponse, err error) {
+	defer wrapOp(&err, "SearchSmartAccountsByDomain(%s)", domain)
+	ctx, cancel := c.methodContext(context.Background(), "SearchSmartAccountsByDomain")
+	defer cancel()
+	return c.searchSmartAccountsByDomain(ctx, domain)
+}
+
+func (c *Client) searchSmartAccountsByDomain(ctx context.Context, domain string) (*SearchResponse, error) {
+	return c.searchSmartAccounts(ctx, "domain", domain)
+}
+
+// SearchSmartAccountsByName will return any entry whose name matches your search, so as with
+// SearchSmartAccountsByDomain, be careful, since it may return more than you expect.
+// Also note that there is a hardcoded limit of 1000 entries for the response.
+func (c *Client) SearchSmartAccountsByName(ctx context.Context, name string) (_ *SearchResponse, err error) {
+	defer wrapOp(&err, "SearchSmartAccountsByName(%s)", name)
+	ctx, cancel := c.methodContext(ctx, "SearchSmartAccountsByName")
+	defer cancel()
+	return c.searchSmartAccounts(ctx, "name", name)
+}
+
+// searchSmartAccounts searches for customer smart accounts using the given query parameter.
+func (c *Client) searchSmartAccounts(ctx context.Context, param, value string) (*SearchResponse, error) {
+	q := url.Values{}
+	q.Set(param, value)
+	q.Set("type", "CUSTOMER")
+	q.Set("limit", "1000")
+	q.Set("offset", "0")
+	req, err := c.newRequest(endpointSearchAccounts, nil, q)
 	if err != nil {
 		return nil, err
 	}
 	var sr SearchResponse
-	err = c.makeRequest(context.Background(), req, &sr)
+	err = c.makeRequest(ctx, req, &sr)
+	if c.emptyOn404(err) {
+		return &SearchResponse{Accounts: []SearchAccount{}}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	// searches are known to be truncated to 1000 entries, so only validate when below that
+	if sr.TotalRecords <= 1000 {
+		if err := c.validateTotal(len(sr.Accounts), sr.TotalRecords); err != nil {
+			return &sr, err
+		}
+	}
 	return &sr, nil
 }
 
 // GetVirtualAccounts will retrieve a list of virtual accounts given a valid smart account domain.
-func (c *Client) GetVirtualAccounts(domain string) ([]VirtualAccount, error) {
-	url := fmt.Sprintf("https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v1/accounts/%s/customer/virtual-accounts", domain)
-	method := "GET"
-	req, err := http.NewRequest(method, url, nil)
+func (c *Client) GetVirtualAccounts(domain string) (_ []VirtualAccount, err error) {
+	defer wrapOp(&err, "GetVirtualAccounts(%s)", domain)
+	ctx, cancel := c.methodContext(context.Background(), "GetVirtualAccounts")
+	defer cancel()
+	return c.getVirtualAccounts(ctx, domain)
+}
+
+func (c *Client) getVirtualAccounts(ctx context.Context, domain string) ([]VirtualAccount, error) {
+	req, err := c.newRequest(endpointVirtualAccounts, nil, nil, domain)
 	if err != nil {
 		return nil, err
 	}
 	var varesp VirtualAccountResponse
-	err = c.makeRequest(context.Background(), req, &varesp)
+	err = c.makeCachedRequest(ctx, req, &varesp)
+	if c.emptyOn404(err) {
+		return []VirtualAccount{}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -244,54 +427,196 @@ func (c *Client) GetVirtualAccounts(domain string) ([]VirtualAccount, error) {
 // GetAllSmartAccounts will retrieve a list of all smart accounts the user account has access to.  Note that
 // this does not (rather annoyingly) return the Smart Account ID that you will likely need.  For that you
 // will have to use SearchSmartAccountsByDomain and match them up yourself.
-func (c *Client) GetAllSmartAccounts() ([]SmartAccount, error) {
-	url := "https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v2/accounts"
-	method := "GET"
-	req, err := http.NewRequest(method, url, nil)
+func (c *Client) GetAllSmartAccounts() (_ []SmartAccount, err error) {
+	defer wrapOp(&err, "GetAllSmartAccounts")
+	ctx, cancel := c.methodContext(context.Background(), "GetAllSmartAccounts")
+	defer cancel()
+	return c.getAllSmartAccounts(ctx)
+}
+
+func (c *Client) getAllSmartAccounts(ctx context.Context) ([]SmartAccount, error) {
+	return c.getSmartAccounts(ctx, AccountsRequest{})
+}
+
+func (c *Client) getSmartAccounts(ctx context.Context, ar AccountsRequest) ([]SmartAccount, error) {
+	if c.accountsVersion == AccountsAPIV1 {
+		return c.getSmartAccountsV1(ctx)
+	}
+	req, err := c.newRequest(endpointAccounts, nil, ar.query())
 	if err != nil {
 		return nil, err
 	}
 	var sar SmartAccountResponse
-	err = c.makeRequest(context.Background(), req, &sar)
+	err = c.makeCachedRequest(ctx, req, &sar)
+	if c.emptyOn404(err) {
+		return []SmartAccount{}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	return sar.Accounts, nil
 }
 
-// makeRequest provides a single function to add common items to the request.
+// makeRequest provides a single function to add common items to the request, including a generated request ID
+// which is included in any error returned as a *RequestIDError wrapping an *EndpointError.  If v is a *[]byte the raw
+// response body is returned rather than being decoded, and an Accept header already set on the request
+// is left in place so that non JSON responses such as CSV can be requested.  Requests that fail with
+// a retryable status will be retried according to the retry options, by default they are not retried.
 func (c *Client) makeRequest(ctx context.Context, req *http.Request, v interface{}) error {
-	token, err := c.getToken()
+	if err := c.waitJitter(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := requestContext(ctx)
+	defer cancel()
+	applyExtraQuery(ctx, req)
+	applyRequestHeaders(ctx, req)
+	id := newRequestID()
+	req.Header.Set(c.requestIDHeader, id)
+	if err := c.sendRequest(ctx, req, v); err != nil {
+		return &RequestIDError{RequestID: id, Err: err}
+	}
+	return nil
+}
+
+// sendRequest sends the request, retrying as required.  The same request ID is used for all attempts.  Any error
+// is returned as an *EndpointError.
+func (c *Client) sendRequest(ctx context.Context, req *http.Request, v interface{}) (err error) {
+	attempts := 0
+	defer func() {
+		if err != nil {
+			err = newEndpointError(req, attempts, err)
+		}
+	}()
+	retried403 := false
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		retryable, after, err := c.doRequest(ctx, req, v)
+		attempts++
+		c.logAttempt(ctx, req, attempt, err)
+		if !retried403 && c.shouldRetry403(err) {
+			retried403 = true
+			if serr := sleepContext(ctx, authRetryDelay); serr != nil {
+				return err
+			}
+			if berr := rewindBody(req); berr != nil {
+				return berr
+			}
+			attempt--
+			continue
+		}
+		if err == nil || !retryable || attempt >= c.maxRetriesFor(ctx) {
+			return err
+		}
+		delay := c.backoff.NextDelay(attempt)
+		if after > 0 {
+			if after > c.retryAfterCap {
+				return err
+			}
+			delay = after
+		}
+		if c.maxElapsedTime > 0 && time.Since(start)+delay > c.maxElapsedTime {
+			return err
+		}
+		if c.beforeRetry != nil {
+			c.beforeRetry(attempt+1, req, err, delay)
+		}
+		if serr := sleepContext(ctx, delay); serr != nil {
+			return err
+		}
+		if berr := rewindBody(req); berr != nil {
+			return berr
+		}
+	}
+}
+
+// rewindBody resets the request body so that the request can be sent again.
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
 	if err != nil {
 		return err
 	}
+	req.Body = body
+	return nil
+}
+
+// doRequest performs a single attempt of the request, reporting whether a failure may be retried and any
+// delay the server asked for using the Retry-After header.
+func (c *Client) doRequest(ctx context.Context, req *http.Request, v interface{}) (bool, time.Duration, error) {
+	token, err := c.getToken(ctx)
+	if err != nil {
+		return false, 0, err
+	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	if !c.lim.Allow() {
-		c.lim.Wait(ctx)
+		if c.rateLimitMode == RateLimitFail {
+			return false, 0, ErrRateLimited
+		}
+		if err := c.lim.Wait(ctx); err != nil {
+			return false, 0, err
+		}
+	}
+
+	cacheKey := c.cacheKey(req)
+	if cacheKey != "" {
+		if etag, _, ok := c.cache.Get(cacheKey); ok {
+			req.Header.Set("If-None-Match", etag)
+		}
 	}
 
-	rc := req.WithContext(ctx)
+	c.setIfModifiedSince(req)
+	if c.gzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	tctx, traced := c.traceContext(withRequestEndpoint(ctx, req), req)
+	rc := req.WithContext(tctx)
 	res, err := c.HTTPClient.Do(rc)
+	traced()
 	if err != nil {
-		return err
+		return ctx.Err() == nil && c.retryableError(err), 0, err
 	}
 	defer res.Body.Close()
+	if c.gzip {
+		if res.Body, err = gzipBody(res); err != nil {
+			return false, 0, err
+		}
+	}
+	res.Body = c.limitBody(res.Body)
+	if res.StatusCode == http.StatusNotModified && cacheKey != "" {
+		if _, body, ok := c.cache.Get(cacheKey); ok {
+			return false, 0, c.decodeResponse(requestEndpoint(req), bytes.NewReader(body), v)
+		}
+	}
+	if res.StatusCode == http.StatusNotModified {
+		return false, 0, &EndpointError{Status: res.StatusCode, Err: ErrNotModified}
+	}
 	// if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusBadRequest {
 	if res.StatusCode != http.StatusOK {
 		var ccwErr error
+		text := nonJSONErrorText(res)
 		switch res.StatusCode {
 		case 400:
 			ccwErr = ErrBadRequest
+			if text != "" {
+				break
+			}
 			var subserr EAConsumptionReportError
-			if err = json.NewDecoder(res.Body).Decode(&subserr); err == nil {
+			if b, rerr := io.ReadAll(res.Body); rerr == nil && c.unmarshal(b, &subserr) == nil && (subserr.Code != 0 || subserr.Message != "") {
 				if subserr.Code == 400001 && subserr.Message == "No Valid Subscriptions found" {
 					ccwErr = ErrNoSubscriptions
 				} else {
-					ccwErr = fmt.Errorf("%w: %d %s", ccwErr, subserr.Code, subserr.Message)
+					ccwErr = &subserr
 				}
 			}
 		case 401:
@@ -300,52 +625,219 @@ func (c *Client) makeRequest(ctx context.Context, req *http.Request, v interface
 			ccwErr = ErrForbidden
 		case 404:
 			ccwErr = ErrNotFound
+		case 429:
+			ccwErr = ErrTooManyRequests
 		case 500:
 			ccwErr = ErrInternalError
 		default:
 			// ccwErr = ErrUnknown
 			ccwErr = fmt.Errorf("unknown error: %s", res.Status)
 		}
-		return ccwErr
+		if text != "" {
+			ccwErr = fmt.Errorf("%w: %s", ccwErr, text)
+		}
+		return isRetryableStatus(res.StatusCode), retryAfter(res), &EndpointError{Status: res.StatusCode, Err: ccwErr}
 	}
+	c.storeLastModified(req, res)
 	if res.StatusCode == http.StatusCreated {
-		return nil
+		return false, 0, nil
 	}
-	if err = json.NewDecoder(res.Body).Decode(&v); err != nil {
+	var body io.Reader = res.Body
+	if etag := res.Header.Get("ETag"); etag != "" && cacheKey != "" {
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			return false, 0, err
+		}
+		c.cache.Set(cacheKey, etag, b)
+		body = bytes.NewReader(b)
+	}
+	return false, 0, c.decodeResponse(requestEndpoint(req), body, v)
+}
+
+// decodeResponse decodes the response body into v and, when WithErrorOnStatusMessage is set, checks the
+// status reported in the body.  Decoded values are then passed to the WithResponseValidator function, if set.
+func (c *Client) decodeResponse(endpoint string, r io.Reader, v interface{}) error {
+	if err := c.decodeBody(r, v); err != nil {
 		return err
 	}
-	return nil
+	if c.errorOnStatus {
+		if sr, ok := v.(statusResponse); ok {
+			if err := checkStatus(sr); err != nil {
+				return err
+			}
+		}
+	}
+	return c.validateResponse(endpoint, v)
+}
+
+// bufferPool holds the buffers response bodies are read into before being decoded, reducing allocations for clients
+// making many requests.  Decoding doesn't keep references to the buffer, so it is returned to the pool once decoding
+// has finished, unless it has grown beyond maxPooledBuffer so that one large response doesn't pin its memory.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledBuffer is the largest buffer returned to bufferPool.
+const maxPooledBuffer = 1 << 20
+
+// decodeBody decodes the JSON response body into v, or if v is a *[]byte, reads the raw body into it.  An empty
+// body leaves v untouched.  With useNumber set, numbers decoded into interface{} values are json.Number.
+func decodeBody(r io.Reader, v interface{}, useNumber bool) error {
+	if raw, ok := v.(*[]byte); ok {
+		var err error
+		*raw, err = io.ReadAll(r)
+		return err
+	}
+	if sd, ok := v.(streamDecoder); ok {
+		return sd.decodeStream(r)
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+		// an empty body is a success with nothing to decode
+		return nil
+	}
+	if useNumber {
+		dec := json.NewDecoder(buf)
+		dec.UseNumber()
+		return dec.Decode(&v)
+	}
+	return json.Unmarshal(buf.Bytes(), &v)
+}
+
+// CurrentToken returns a copy of the token most recently used by the client, or nil if no token has been
+// retrieved yet.  It never requests a new token.  With WithFixedToken, the fixed token is returned, with no expiry.
+func (c *Client) CurrentToken() *Token {
+	if c.fixedToken != "" {
+		return &Token{AccessToken: c.fixedToken, TokenType: "Bearer"}
+	}
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.token == nil {
+		return nil
+	}
+	t := *c.token
+	if t.Raw != nil {
+		t.Raw = make(map[string]interface{}, len(c.token.Raw))
+		for k, v := range c.token.Raw {
+			t.Raw[k] = v
+		}
+	}
+	return &t
 }
 
 // getToken returns a new token for use with the SmartAccounts API.  It can be used as required since
-// it will memoise an existing token until 5 minutes before expiry.
-func (c *Client) getToken() (*Token, error) {
+// it will memoise an existing token until 5 minutes before expiry.  It is safe for concurrent use.
+// Token requests that fail with a 5xx status or a network error are retried according to WithTokenRetries.
+func (c *Client) getToken(ctx context.Context) (*Token, error) {
+	if c.fixedToken != "" {
+		return &Token{AccessToken: c.fixedToken, TokenType: "Bearer"}, nil
+	}
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
 	now := time.Now().UTC()
 	if c.token != nil && c.token.ExpiresAt.Sub(now).Minutes() > 5 {
 		return c.token, nil
 	}
-	url := "https://cloudsso.cisco.com/as/token.oauth2"
-	method := "POST"
-	pl := fmt.Sprintf("client_id=%s&client_secret=%s&username=%s&password=%s&grant_type=password", c.clientID, c.secret, c.username, c.password)
-	payload := strings.NewReader(pl)
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, payload)
+	for attempt := 0; ; attempt++ {
+		t, retryable, err := c.requestToken(ctx, now)
+		if err == nil {
+			c.token = t
+			c.tokenFetchedAt = time.Now()
+			return t, nil
+		}
+		if !retryable || attempt >= c.tokenRetries {
+			c.tokenError(err)
+			return nil, err
+		}
+		if serr := sleepContext(ctx, c.backoff.NextDelay(attempt)); serr != nil {
+			c.tokenError(err)
+			return nil, err
+		}
+	}
+}
+
+// tokenError reports a failure to retrieve a token to the WithOnTokenError callback, if set.
+func (c *Client) tokenError(err error) {
+	if c.onTokenError != nil {
+		c.onTokenError(err)
+	}
+}
+
+// checkCredentials ensures all the credentials required for the password grant are present, rather than sending a
+// request Cisco will reject.
+func checkCredentials(clientID, secret, username, password string) error {
+	missing := []string{}
+	for _, f := range []struct{ name, value string }{
+		{"client id", clientID}, {"client secret", secret}, {"username", username}, {"password", password},
+	} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingCredentials, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// requestToken makes a single request to the token endpoint, reporting whether a failure may be retried.
+func (c *Client) requestToken(ctx context.Context, now time.Time) (*Token, bool, error) {
+	clientID, secret, username, password := c.clientID, c.secret, c.username, c.password
+	if c.secretSource != nil {
+		var err error
+		if clientID, secret, username, password, err = c.secretSource(); err != nil {
+			return nil, false, fmt.Errorf("ccw: secret source: %w", err)
+		}
+	}
+	if err := checkCredentials(clientID, secret, username, password); err != nil {
+		return nil, false, err
+	}
+	payload := strings.NewReader(url.Values{
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"username":      {username},
+		"password":      {password},
+		"grant_type":    {"password"},
+	}.Encode())
+	req, err := http.NewRequestWithContext(ctx, endpointToken.method, endpointToken.url(nil), payload)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	res, err := client.Do(req)
+	res, err := c.tokenClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, ctx.Err() == nil && c.retryableError(err), err
 	}
 	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		if res.StatusCode >= http.StatusInternalServerError {
+			return nil, true, fmt.Errorf("%w: token request failed: %s", ErrInternalError, res.Status)
+		}
+		return nil, false, fmt.Errorf("%w: token request failed: %s", ErrUnauthorized, res.Status)
+	}
 
-	var t Token
-	err = json.NewDecoder(res.Body).Decode(&t)
+	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, ctx.Err() == nil && c.retryableError(err), err
+	}
+	var t Token
+	if err := c.unmarshal(body, &t); err != nil {
+		return nil, false, err
+	}
+	if err := c.unmarshal(body, &t.Raw); err != nil {
+		return nil, false, err
 	}
 	t.ExpiresAt = time.Unix(now.Unix()+t.ExpiresIn, 0)
-	c.token = &t
-	return &t, nil
+	return &t, false, nil
 }
@@ -0,0 +1,677 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rewriteTransport sends every request to the test server rather than the Cisco host it was built for.
+type rewriteTransport struct {
+	host string
+	next http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = "http", t.host, ""
+	return t.next.RoundTrip(r)
+}
+
+// newTestClient starts a server for handler and returns a client whose API and token requests are sent to it.  The
+// client uses a fixed token and no rate limiting, either of which can be replaced by opts, e.g. WithFixedToken("")
+// to request tokens from the server with serveToken.
+func newTestClient(t testing.TB, handler http.Handler, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]Option{WithFixedToken("test-token"), WithoutRateLimiting()}, opts...)
+	c := New("id", "secret", "user", "pass", opts...)
+	if c.recorder != nil {
+		c.recorder.next = &rewriteTransport{host: u.Host, next: c.recorder.next}
+	} else {
+		c.HTTPClient.Transport = &rewriteTransport{host: u.Host, next: c.HTTPClient.Transport}
+	}
+	c.tokenClient = &http.Client{Transport: &rewriteTransport{host: u.Host, next: c.tokenClient.Transport}}
+	return c
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(t testing.TB, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+// isTokenRequest reports whether r is a request for a token.
+func isTokenRequest(r *http.Request) bool {
+	return r.URL.Path == endpointToken.path
+}
+
+// serveToken responds to a token request with a token valid for an hour.
+func serveToken(t testing.TB, w http.ResponseWriter) {
+	writeJSON(t, w, map[string]interface{}{"access_token": "server-token", "token_type": "Bearer", "expires_in": 3600})
+}
+
+// counter counts requests made to a test server.
+type counter struct {
+	n int32
+}
+
+func (c *counter) inc() int {
+	return int(atomic.AddInt32(&c.n, 1))
+}
+
+func (c *counter) get() int {
+	return int(atomic.LoadInt32(&c.n))
+}
+
+// searchHandler responds to account searches with the given accounts.
+func searchHandler(t testing.TB, accounts ...SearchAccount) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, SearchResponse{TotalRecords: len(accounts), Accounts: accounts, Status: "SUCCESS"})
+	}
+}
+
+// virtualAccountsHandler responds to requests for virtual accounts with those for the domain in the path.  Domains
+// not in the map fail with a 500.
+func virtualAccountsHandler(t testing.TB, vas map[string][]VirtualAccount) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/")
+		if len(parts) < 3 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		list, ok := vas[parts[len(parts)-3]]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(t, w, VirtualAccountResponse{VirtualAccounts: list, Status: "SUCCESS"})
+	}
+}
+
+func TestRateLimitModes(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		searchHandler(t)(w, r)
+	}
+	saturated := func() *rate.Limiter {
+		lim := rate.NewLimiter(rate.Every(100*time.Millisecond), 1)
+		lim.Allow()
+		return lim
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		calls = counter{}
+		c := newTestClient(t, http.HandlerFunc(h), WithRateLimiter(saturated()), WithRateLimitMode(RateLimitFail))
+		start := time.Now()
+		_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+		if !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("got %v, want ErrRateLimited", err)
+		}
+		if time.Since(start) > 50*time.Millisecond {
+			t.Errorf("took %s, want an immediate failure", time.Since(start))
+		}
+		if calls.get() != 0 {
+			t.Errorf("got %d requests, want none", calls.get())
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		calls = counter{}
+		c := newTestClient(t, http.HandlerFunc(h), WithRateLimiter(saturated()))
+		start := time.Now()
+		if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(start) < 50*time.Millisecond {
+			t.Errorf("took %s, want to wait for the limiter", time.Since(start))
+		}
+		if calls.get() != 1 {
+			t.Errorf("got %d requests, want 1", calls.get())
+		}
+	})
+
+	t.Run("wait cancelled", func(t *testing.T) {
+		lim := rate.NewLimiter(rate.Every(time.Hour), 1)
+		lim.Allow()
+		c := newTestClient(t, http.HandlerFunc(h), WithRateLimiter(lim))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := c.SearchSmartAccountsByName(ctx, "example")
+		if err == nil || errors.Is(err, ErrRateLimited) {
+			t.Fatalf("got %v, want a context error", err)
+		}
+	})
+}
+
+func TestSearchAccountToSmartAccount(t *testing.T) {
+	sa := SearchAccount{Domain: "example.com", Name: "Example", ID: 123, Type: "CUSTOMER", Status: "ACTIVE"}.ToSmartAccount()
+	want := SmartAccount{ID: 123, AccountDomain: "example.com", AccountName: "Example", AccountType: "CUSTOMER", AccountStatus: "ACTIVE"}
+	if !reflect.DeepEqual(sa, want) {
+		t.Errorf("got %+v, want %+v", sa, want)
+	}
+	if sa.Roles != nil || sa.VirtualAccounts != nil || sa.Licenses != nil {
+		t.Errorf("got %+v, want Roles, VirtualAccounts and Licenses left as zero values", sa)
+	}
+}
+
+func TestRateLimitedVersusTooManyRequests(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+
+	c := newTestClient(t, http.HandlerFunc(h))
+	_, err := c.SearchSmartAccountsByName(context.Background(), "example")
+	if !errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrRateLimited) {
+		t.Errorf("server 429: got %v, want ErrTooManyRequests only", err)
+	}
+
+	lim := rate.NewLimiter(rate.Every(time.Hour), 1)
+	lim.Allow()
+	c = newTestClient(t, http.HandlerFunc(h), WithRateLimiter(lim), WithRateLimitMode(RateLimitFail))
+	_, err = c.SearchSmartAccountsByName(context.Background(), "example")
+	if !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("client limiter: got %v, want ErrRateLimited only", err)
+	}
+}
+
+// licensePageJSON returns a page of 100 licenses as it would be returned by Cisco.
+func licensePageJSON(t testing.TB) []byte {
+	lr := LicenseResponse{TotalRecords: 100, Licenses: makeLicenses("VA1", 100), Status: "SUCCESS"}
+	for i := range lr.Licenses {
+		lr.Licenses[i].LicenseDetails = []LicenseDetail{{LicenseType: "TERM", Quantity: 5, StartDate: "2024-01-01", EndDate: "2025-01-01"}}
+	}
+	b, err := json.Marshal(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeBody(t *testing.T) {
+	page := licensePageJSON(t)
+	var want LicenseResponse
+	if err := json.Unmarshal(page, &want); err != nil {
+		t.Fatal(err)
+	}
+	// decode repeatedly so that pooled buffers are reused
+	for i := 0; i < 3; i++ {
+		var got LicenseResponse
+		if err := decodeBody(bytes.NewReader(page), &got, false); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("decode %d: got a different response from encoding/json", i)
+		}
+	}
+
+	var empty LicenseResponse
+	if err := decodeBody(strings.NewReader(" \n"), &empty, false); err != nil || empty.Licenses != nil {
+		t.Errorf("empty body: got %v, %+v, want nil and an untouched value", err, empty)
+	}
+
+	var m map[string]interface{}
+	if err := decodeBody(strings.NewReader(`{"id": 12345678901234567890}`), &m, true); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := m["id"].(json.Number); !ok || n.String() != "12345678901234567890" {
+		t.Errorf("got %#v, want a json.Number", m["id"])
+	}
+}
+
+// BenchmarkDecodeBody decodes a page of licenses with decodeBody, which reads the body into a pooled buffer.
+func BenchmarkDecodeBody(b *testing.B) {
+	page := licensePageJSON(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for i := 0; i < b.N; i++ {
+		var lr LicenseResponse
+		if err := decodeBody(bytes.NewReader(page), &lr, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeBodyUnpooled decodes the same page with a new json.Decoder for each body, as was done before
+// the buffers were pooled, for comparison with BenchmarkDecodeBody.
+func BenchmarkDecodeBodyUnpooled(b *testing.B) {
+	page := licensePageJSON(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for i := 0; i < b.N; i++ {
+		var lr LicenseResponse
+		if err := json.NewDecoder(bytes.NewReader(page)).Decode(&lr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// fakeCisco is a test server for the Cisco APIs used when combining calls.  Searches match accounts by domain,
+// virtual accounts and EA reports fail as their handlers do, and licenses are looked up by virtual account name.
+// Virtual accounts in failAfterFirstPage return their first page of licenses but fail on any other.
+type fakeCisco struct {
+	accounts           []SmartAccount
+	search             []SearchAccount
+	vas                map[string][]VirtualAccount
+	licenses           map[string][]License
+	failAfterFirstPage map[string]bool
+	subscriptions      map[int][]SubscriptionSearchSubscription
+	reports            map[string]*EASmartAccountSubscriptionConsumptionReportResponse
+}
+
+func (f *fakeCisco) handler(t testing.TB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch p := r.URL.Path; {
+		case isTokenRequest(r):
+			serveToken(t, w)
+		case p == endpointAccounts.path:
+			writeJSON(t, w, SmartAccountResponse{Accounts: f.accounts, Status: "SUCCESS"})
+		case p == endpointSearchAccounts.path:
+			found := []SearchAccount{}
+			for _, a := range f.search {
+				if strings.EqualFold(a.Domain, r.URL.Query().Get("domain")) {
+					found = append(found, a)
+				}
+			}
+			searchHandler(t, found...)(w, r)
+		case strings.HasSuffix(p, "/virtual-accounts"):
+			virtualAccountsHandler(t, f.vas)(w, r)
+		case strings.HasSuffix(p, "/licenses"):
+			body, _ := io.ReadAll(r.Body)
+			var lreq LicenseRequest
+			if json.Unmarshal(body, &lreq) == nil && len(lreq.VirtualAccounts) == 1 && f.failAfterFirstPage[lreq.VirtualAccounts[0]] && lreq.Offset > 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			licensesHandler(t, f.licenses)(w, r)
+		case p == endpointSubscriptionSearch.path:
+			var req SubscriptionSearchRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.SmartAccounts) != 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			id := req.SmartAccounts[0].SmartAccountID
+			od := SubscriptionSearchOfferDetails{SmartAccountID: strconv.Itoa(id), Subscriptions: f.subscriptions[id]}
+			writeJSON(t, w, SubscriptionSearchResponse{Status: "SUCCESS", OfferDetails: []SubscriptionSearchOfferDetails{od}})
+		case strings.HasSuffix(p, "/consumption"):
+			eaReportHandler(t, f.reports)(w, r)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, p)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestErrorsLabelledWithOperation(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	ctx := context.Background()
+	for _, tt := range []struct {
+		op   string
+		call func() error
+	}{
+		{"GetAllSmartAccounts", func() error { _, err := c.GetAllSmartAccounts(); return err }},
+		{"GetVirtualAccounts(example.com)", func() error { _, err := c.GetVirtualAccounts("example.com"); return err }},
+		{"SearchSmartAccountsByDomain(example.com)", func() error { _, err := c.SearchSmartAccountsByDomain("example.com"); return err }},
+		{"SearchSmartAccountsByName(Example)", func() error { _, err := c.SearchSmartAccountsByName(ctx, "Example"); return err }},
+		{"SearchSubscriptions(123, example.com)", func() error { _, err := c.SearchSubscriptions(123, "example.com"); return err }},
+		{"GetLicensesPage(example.com, VA1, 0)", func() error { _, err := c.GetLicensesPage(ctx, "example.com", "VA1", 0, 10); return err }},
+	} {
+		err := tt.call()
+		if !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s: got %v, want ErrForbidden", tt.op, err)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.op+": ") {
+			t.Errorf("got %q, want it to start with %q", err, tt.op)
+		}
+	}
+}
+
+func TestCurrentToken(t *testing.T) {
+	var tokens counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if isTokenRequest(r) {
+			tokens.inc()
+			serveToken(t, w)
+			return
+		}
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""))
+	if tok := c.CurrentToken(); tok != nil {
+		t.Fatalf("before any call: got %+v, want nil", tok)
+	}
+	if tokens.get() != 0 {
+		t.Fatalf("got %d token requests, want CurrentToken not to request one", tokens.get())
+	}
+
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	tok := c.CurrentToken()
+	if tok == nil || tok.AccessToken != "server-token" || tok.TokenType != "Bearer" {
+		t.Fatalf("after a call: got %+v, want the server's token", tok)
+	}
+	if until := time.Until(tok.ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("got ExpiresAt in %s, want an hour", until)
+	}
+
+	// the copy can be changed without affecting the client
+	tok.AccessToken = "changed"
+	tok.Raw["access_token"] = "changed"
+	if again := c.CurrentToken(); again.AccessToken != "server-token" || again.Raw["access_token"] != "server-token" {
+		t.Errorf("got %+v, want the client's token unchanged", again)
+	}
+	if tokens.get() != 1 {
+		t.Errorf("got %d token requests, want 1", tokens.get())
+	}
+}
+
+func TestCurrentTokenFixed(t *testing.T) {
+	var auth string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if isTokenRequest(r) {
+			t.Error("got a token request, want the fixed token used")
+		}
+		auth = r.Header.Get("Authorization")
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken("fixed-token"))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	tok := c.CurrentToken()
+	if tok == nil || tok.AccessToken != "fixed-token" || tok.TokenType != "Bearer" || auth != "Bearer "+tok.AccessToken {
+		t.Fatalf("got %+v, want the fixed token that was sent as %q", tok, auth)
+	}
+	tok.AccessToken = "changed"
+	if again := c.CurrentToken(); again.AccessToken != "fixed-token" {
+		t.Errorf("got %+v, want the client's token unchanged", again)
+	}
+}
+
+func TestSearchSmartAccountsQuery(t *testing.T) {
+	var got []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Query().Encode())
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "Example & Co"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SearchSmartAccountsByDomain("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"limit=1000&name=Example+%26+Co&offset=0&type=CUSTOMER",
+		"domain=example.com&limit=1000&offset=0&type=CUSTOMER",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got queries %q, want %q", got, want)
+	}
+}
+
+func TestEmptyResponseBody(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	c := newTestClient(t, http.HandlerFunc(h))
+	vas, err := c.GetVirtualAccounts("example.com")
+	if err != nil {
+		t.Fatalf("got %v, want no error for an empty body", err)
+	}
+	if len(vas) != 0 {
+		t.Errorf("got %v, want no virtual accounts", vas)
+	}
+
+	v := map[string]string{"untouched": "yes"}
+	if err := c.GetJSON(context.Background(), EndpointSpec{URL: swapiHost + "/anything"}, &v); err != nil || v["untouched"] != "yes" {
+		t.Errorf("got %v, %v, want nil and v left untouched", err, v)
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	var calls counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls.inc()
+		serveToken(t, w)
+	}
+	names := []string{"client id", "client secret", "username", "password"}
+	// every combination of present and missing credentials, as a bit per field
+	for mask := 1; mask < 1<<len(names); mask++ {
+		creds := []string{"id", "secret", "user", "pass"}
+		missing := []string{}
+		for i := range creds {
+			if mask&(1<<i) != 0 {
+				creds[i] = ""
+				missing = append(missing, names[i])
+			}
+		}
+		c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""))
+		c.clientID, c.secret, c.username, c.password = creds[0], creds[1], creds[2], creds[3]
+		_, err := c.getToken(context.Background())
+		if !errors.Is(err, ErrMissingCredentials) {
+			t.Errorf("missing %v: got %v, want ErrMissingCredentials", missing, err)
+			continue
+		}
+		if want := "ccw: missing credentials: " + strings.Join(missing, ", "); !strings.Contains(err.Error(), want) {
+			t.Errorf("got %q, want it to contain %q", err, want)
+		}
+	}
+	if got := calls.get(); got != 0 {
+		t.Errorf("got %d token requests, want none", got)
+	}
+
+	// credentials from a secret source are checked in the same way
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""), WithSecretSource(func() (string, string, string, string, error) {
+		return "id", "secret", "", "pass", nil
+	}))
+	if _, err := c.getToken(context.Background()); !errors.Is(err, ErrMissingCredentials) || !strings.HasSuffix(err.Error(), ": username") {
+		t.Errorf("secret source: got %v, want ErrMissingCredentials for the username", err)
+	}
+}
+
+func TestTokenRequestEncoding(t *testing.T) {
+	var form url.Values
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+			t.Errorf("got Content-Type %q, want application/x-www-form-urlencoded", got)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		form = r.PostForm
+		serveToken(t, w)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""))
+	c.clientID, c.secret, c.username, c.password = "id+1", "s&cret=", "user name", "p%ss#word"
+	if _, err := c.getToken(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"client_id": {"id+1"}, "client_secret": {"s&cret="}, "username": {"user name"}, "password": {"p%ss#word"}, "grant_type": {"password"}}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("got %v, want %v", form, want)
+	}
+}
+
+func TestTokenRawFields(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if isTokenRequest(r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "abc", "token_type": "Bearer", "expires_in": 3599, "refresh_token": "def",
+				"scope": "read", "issued_at": "1700000000", "refresh_expires_in": 86400, "id_token": null,
+				"extra": {"nested": true}}`))
+			return
+		}
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+		t.Fatal(err)
+	}
+	tok := c.CurrentToken()
+	if tok == nil || tok.AccessToken != "abc" || tok.TokenType != "Bearer" || tok.ExpiresIn != 3599 || tok.RefreshToken != "def" || tok.Scope != "read" {
+		t.Fatalf("got %+v, want the standard fields decoded", tok)
+	}
+	want := map[string]interface{}{
+		"access_token": "abc", "token_type": "Bearer", "expires_in": 3599.0, "refresh_token": "def", "scope": "read",
+		"issued_at": "1700000000", "refresh_expires_in": 86400.0, "id_token": nil, "extra": map[string]interface{}{"nested": true},
+	}
+	if !reflect.DeepEqual(tok.Raw, want) {
+		t.Errorf("got raw %v, want %v", tok.Raw, want)
+	}
+
+	// the copy returned can't change the client's token
+	tok.Raw["access_token"] = "changed"
+	if got := c.CurrentToken().Raw["access_token"]; got != "abc" {
+		t.Errorf("got %v after changing the copy, want abc", got)
+	}
+}
+
+func TestClientConcurrentUse(t *testing.T) {
+	f := &fakeCisco{
+		accounts: []SmartAccount{{AccountDomain: "example.com", AccountName: "Example", Roles: []Role{{Role: "SMART_ACCOUNT_USER"}}}},
+		search:   []SearchAccount{{Domain: "example.com", Name: "Example", ID: 1}},
+		vas:      map[string][]VirtualAccount{"example.com": {{Name: "VA1"}, {Name: "VA2"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 120), "VA2": makeLicenses("VA2", 30)},
+		subscriptions: map[int][]SubscriptionSearchSubscription{
+			1: {{SubRefID: "Sub1"}},
+		},
+	}
+	var tokens counter
+	next := f.handler(t)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if isTokenRequest(r) {
+			tokens.inc()
+			// give other goroutines the chance to race for the token
+			time.Sleep(20 * time.Millisecond)
+		} else if r.Method == http.MethodGet {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		}
+		next(w, r)
+	}
+	logger := &recordingLogger{}
+	c := newTestClient(t, http.HandlerFunc(h), WithFixedToken(""), WithResponseCache(NewMemoryResponseCache()),
+		WithResultCache(time.Minute), WithIfModifiedSince(true), WithRequestJitter(time.Millisecond),
+		WithLogger(logger), WithConcurrency(4))
+
+	ctx := context.Background()
+	calls := []func() error{
+		func() error { _, err := c.GetAllSmartAccounts(); return err },
+		func() error { _, err := c.SearchSmartAccountsByDomain("example.com"); return err },
+		func() error { _, err := c.SearchSmartAccountsByName(ctx, "Example"); return err },
+		func() error { _, err := c.GetVirtualAccounts("example.com"); return err },
+		func() error {
+			_, err := c.GetSmartLicenseUsage(SmartAccount{AccountDomain: "example.com", VirtualAccounts: &[]VirtualAccount{{Name: "VA1"}}})
+			return err
+		},
+		func() error { _, err := c.GetLicensesForDomain(ctx, "example.com"); return err },
+		func() error { _, err := c.SearchSubscriptions(1, "example.com"); return err },
+		func() error { _, err := c.HasRoleForDomain(ctx, "example.com", "SMART_ACCOUNT_USER"); return err },
+		func() error {
+			_, err := c.GetAllSmartAccountsWith(ctx, AccountsRequest{IncludeVirtualAccounts: true, IncludeLicenses: true})
+			return err
+		},
+		func() error { c.CurrentToken(); return nil },
+	}
+	const rounds = 5
+	errs := make(chan error, rounds*len(calls))
+	var wg sync.WaitGroup
+	for i := 0; i < rounds; i++ {
+		for _, call := range calls {
+			wg.Add(1)
+			go func(call func() error) {
+				defer wg.Done()
+				errs <- call()
+			}(call)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := tokens.get(); got != 1 {
+		t.Errorf("got %d token requests, want 1 shared by every goroutine", got)
+	}
+}
+
+func TestContentTypeOnlyWithBody(t *testing.T) {
+	f := &fakeCisco{
+		search:   []SearchAccount{{Domain: "example.com", ID: 1}},
+		vas:      map[string][]VirtualAccount{"example.com": {{Name: "VA1"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 1)},
+	}
+	var mu sync.Mutex
+	got := map[string]string{}
+	fake := f.handler(t)
+	var attempts counter
+	h := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got[r.Method+" "+r.URL.Path] = r.Header.Get("Content-Type")
+		mu.Unlock()
+		// fail the first subscription search so that the retried POST is checked too
+		if r.URL.Path == endpointSubscriptionSearch.path && attempts.inc() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fake(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithRetries(1), WithBackoff(ConstantBackoff{}))
+	if _, err := c.SearchSmartAccountsByDomain("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVirtualAccounts("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetSmartLicenseUsage(smartAccountWith("VA1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SearchSubscriptions(1, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if attempts.get() != 2 {
+		t.Errorf("got %d subscription searches, want a retry", attempts.get())
+	}
+	want := map[string]string{
+		"GET " + endpointSearchAccounts.path:                              "",
+		"GET " + fmt.Sprintf(endpointVirtualAccounts.path, "example.com"): "",
+		"POST " + fmt.Sprintf(endpointLicenses.path, "example.com"):       "application/json",
+		"POST " + endpointSubscriptionSearch.path:                         "application/json",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got Content-Type %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package smartaccounts
+
+import (
+	"context"
+	"time"
+)
+
+// AvailabilitySnapshot represents the license totals across a portfolio of smart accounts.  ByLicense is only
+// populated when requested, keyed by license name.
+type AvailabilitySnapshot struct {
+	GeneratedAt time.Time
+	Accounts    int
+	Totals      LicenseTotals
+	ByLicense   map[string]LicenseTotals
+}
+
+// NewAvailabilitySnapshot sums the quantities of the licenses, optionally also grouping them by license name.  No
+// licenses results in zero totals.  Accounts is left for the caller to set.
+func NewAvailabilitySnapshot(licenses []License, byLicense bool) *AvailabilitySnapshot {
+	s := &AvailabilitySnapshot{GeneratedAt: time.Now().UTC()}
+	if byLicense {
+		s.ByLicense = map[string]LicenseTotals{}
+	}
+	for _, l := range licenses {
+		s.Totals.Add(l)
+		if byLicense {
+			t := s.ByLicense[l.License]
+			t.Add(l)
+			s.ByLicense[l.License] = t
+		}
+	}
+	return s
+}
+
+// GetAvailabilitySnapshot retrieves the licenses for every virtual account of every smart account the user has
+// access to and returns their totals as an AvailabilitySnapshot, optionally grouped by license name.  Accounts are
+// retrieved concurrently, subject to WithConcurrency, with the virtual accounts of each retrieved in turn so that
+// the limit applies to the whole portfolio.  Failures for individual accounts or virtual accounts don't stop the
+// snapshot being produced, instead they are returned as a *PartialError keyed by "domain" or "domain/virtual
+// account" along with the snapshot of everything else.  Only virtual accounts retrieved in full are included.
+func (c *Client) GetAvailabilitySnapshot(ctx context.Context, byLicense bool) (_ *AvailabilitySnapshot, err error) {
+	defer wrapOp(&err, "GetAvailabilitySnapshot")
+	ctx, cancel := c.methodContext(ctx, "GetAvailabilitySnapshot")
+	defer cancel()
+	accounts, err := c.getAllSmartAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found := make([][]License, len(accounts))
+	vaFailures := make([]map[string]error, len(accounts))
+	failed := runBounded(ctx, len(accounts), c.concurrency, func(i int) (err error) {
+		sa := accounts[i]
+		vas, err := c.getVirtualAccounts(ctx, sa.AccountDomain)
+		if err != nil {
+			return err
+		}
+		sa.VirtualAccounts = &vas
+		found[i], vaFailures[i], err = c.getVirtualAccountLicenses(ctx, c.getLicensesPage, sa)
+		return err
+	})
+	licenses := []License{}
+	errs := map[string]error{}
+	for i, sa := range accounts {
+		licenses = append(licenses, found[i]...)
+		if failed[i] != nil {
+			errs[sa.AccountDomain] = failed[i]
+		}
+		for va, err := range vaFailures[i] {
+			errs[sa.AccountDomain+"/"+va] = err
+		}
+	}
+	snapshot := NewAvailabilitySnapshot(licenses, byLicense)
+	snapshot.Accounts = len(accounts)
+	if len(errs) > 0 {
+		return snapshot, &PartialError{Result: snapshot, Failures: errs}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,161 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// snapshotFake is a portfolio of three accounts, with the licenses for b.com's VA split across pages.
+func snapshotFake() *fakeCisco {
+	return &fakeCisco{
+		accounts: []SmartAccount{{AccountDomain: "a.com"}, {AccountDomain: "b.com"}, {AccountDomain: "c.com"}},
+		vas: map[string][]VirtualAccount{
+			"a.com": {{Name: "A1"}, {Name: "A2"}},
+			"b.com": {{Name: "B1"}},
+			"c.com": {},
+		},
+		licenses: map[string][]License{
+			"A1": {
+				{License: "DNA Advantage", VirtualAccount: "A1", Quantity: 10, InUse: 4, Available: 6, Reserved: 1},
+				{License: "ISE Base", VirtualAccount: "A1", Quantity: 100, InUse: 20, Available: 80},
+			},
+			"A2": {
+				{License: "DNA Advantage", VirtualAccount: "A2", Quantity: 5, InUse: 7, Available: -2, PendingQuantity: 3},
+			},
+			"B1": append([]License{
+				{License: "DNA Advantage", VirtualAccount: "B1", Quantity: 20, InUse: 20, Reserved: 5},
+			}, makeLicenses("B1", 150)...),
+		},
+	}
+}
+
+func TestNewAvailabilitySnapshot(t *testing.T) {
+	licenses := []License{
+		{License: "X", Quantity: 10, InUse: 4, Available: 6, Reserved: 2},
+		{License: "Y", Quantity: 1, InUse: 3, Available: -2, PendingQuantity: 1},
+		{License: "X", Quantity: 5, InUse: 5},
+	}
+	s := NewAvailabilitySnapshot(licenses, true)
+	if want := (LicenseTotals{Licenses: 3, Quantity: 16, InUse: 12, Available: 4, Reserved: 2, PendingQuantity: 1}); s.Totals != want {
+		t.Errorf("got totals %+v, want %+v", s.Totals, want)
+	}
+	wantBy := map[string]LicenseTotals{
+		"X": {Licenses: 2, Quantity: 15, InUse: 9, Available: 6, Reserved: 2},
+		"Y": {Licenses: 1, Quantity: 1, InUse: 3, Available: -2, PendingQuantity: 1},
+	}
+	if !reflect.DeepEqual(s.ByLicense, wantBy) {
+		t.Errorf("got by license %+v, want %+v", s.ByLicense, wantBy)
+	}
+	if s.GeneratedAt.IsZero() || time.Since(s.GeneratedAt) > time.Minute {
+		t.Errorf("got GeneratedAt %s, want now", s.GeneratedAt)
+	}
+	if s := NewAvailabilitySnapshot(licenses, false); s.ByLicense != nil {
+		t.Errorf("got by license %v, want nil when not requested", s.ByLicense)
+	}
+}
+
+func TestGetAvailabilitySnapshot(t *testing.T) {
+	c := newTestClient(t, snapshotFake().handler(t))
+	s, err := c.GetAvailabilitySnapshot(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// makeLicenses gives 150 licenses each of quantity 10, with InUse cycling 0-9 and Available the remainder
+	generated := LicenseTotals{Licenses: 150, Quantity: 1500, InUse: 15 * 45, Available: 1500 - 15*45}
+	want := LicenseTotals{
+		Licenses:        4 + generated.Licenses,
+		Quantity:        10 + 100 + 5 + 20 + generated.Quantity,
+		InUse:           4 + 20 + 7 + 20 + generated.InUse,
+		Available:       6 + 80 - 2 + 0 + generated.Available,
+		Reserved:        1 + 5,
+		PendingQuantity: 3,
+	}
+	if s.Totals != want {
+		t.Errorf("got totals %+v, want %+v", s.Totals, want)
+	}
+	if s.Accounts != 3 {
+		t.Errorf("got %d accounts, want 3", s.Accounts)
+	}
+	if len(s.ByLicense) != 152 {
+		t.Errorf("got %d license names, want 152", len(s.ByLicense))
+	}
+	wantDNA := LicenseTotals{Licenses: 3, Quantity: 35, InUse: 31, Available: 4, Reserved: 6, PendingQuantity: 3}
+	if got := s.ByLicense["DNA Advantage"]; got != wantDNA {
+		t.Errorf("got DNA Advantage %+v, want %+v", got, wantDNA)
+	}
+	if got := s.ByLicense["ISE Base"]; got != (LicenseTotals{Licenses: 1, Quantity: 100, InUse: 20, Available: 80}) {
+		t.Errorf("got ISE Base %+v", got)
+	}
+}
+
+func TestGetAvailabilitySnapshotEmpty(t *testing.T) {
+	c := newTestClient(t, (&fakeCisco{}).handler(t))
+	s, err := c.GetAvailabilitySnapshot(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Accounts != 0 || s.Totals != (LicenseTotals{}) || s.ByLicense == nil || len(s.ByLicense) != 0 {
+		t.Errorf("got %+v, want zero totals and an empty map", s)
+	}
+}
+
+func TestGetAvailabilitySnapshotPartial(t *testing.T) {
+	f := snapshotFake()
+	f.accounts = append(f.accounts, SmartAccount{AccountDomain: "broken.com"})
+	f.failAfterFirstPage = map[string]bool{"B1": true}
+	c := newTestClient(t, f.handler(t))
+	s, err := c.GetAvailabilitySnapshot(context.Background(), false)
+	var pe *PartialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a PartialError", err)
+	}
+	if len(pe.Failures) != 2 || !errors.Is(pe.Failures["broken.com"], ErrInternalError) || pe.Failures["b.com/B1"] == nil {
+		t.Errorf("got failures %v, want broken.com and b.com/B1", pe.Failures)
+	}
+	// B1's first page isn't included since the VA wasn't retrieved in full
+	want := LicenseTotals{Licenses: 3, Quantity: 115, InUse: 31, Available: 84, Reserved: 1, PendingQuantity: 3}
+	if s.Totals != want || pe.Result != s || s.Accounts != 4 {
+		t.Errorf("got %+v, want totals %+v for the rest", s, want)
+	}
+}
+
+func TestGetAvailabilitySnapshotConcurrency(t *testing.T) {
+	f := snapshotFake()
+	for _, d := range []string{"d.com", "e.com", "f.com"} {
+		f.accounts = append(f.accounts, SmartAccount{AccountDomain: d})
+		f.vas[d] = []VirtualAccount{{Name: "A1"}, {Name: "A2"}}
+	}
+	fake := f.handler(t)
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/licenses") && !strings.HasSuffix(r.URL.Path, "/virtual-accounts") {
+			fake(w, r)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		fake(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithConcurrency(2))
+	if _, err := c.GetAvailabilitySnapshot(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if maxInFlight != 2 {
+		t.Errorf("got at most %d requests in flight, want 2 across every account and virtual account", maxInFlight)
+	}
+}
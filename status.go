@@ -0,0 +1,96 @@
+package smartaccounts
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// SubscriptionStatus represents the status of an EA subscription.  Values not covered by the constants
+// below are kept as received.  EASubscription.Status remains a string for compatibility, use its TypedStatus
+// method to compare it against the constants.
+type SubscriptionStatus string
+
+// Commonly seen EA subscription statuses.
+const (
+	SubscriptionStatusActive     SubscriptionStatus = "ACTIVE"
+	SubscriptionStatusExpired    SubscriptionStatus = "EXPIRED"
+	SubscriptionStatusCancelled  SubscriptionStatus = "CANCELLED"
+	SubscriptionStatusTerminated SubscriptionStatus = "TERMINATED"
+	SubscriptionStatusPending    SubscriptionStatus = "PENDING"
+)
+
+// Is reports whether the status matches other, ignoring case.
+func (s SubscriptionStatus) Is(other SubscriptionStatus) bool {
+	return strings.EqualFold(string(s), string(other))
+}
+
+// Known reports whether the status is one of the defined constants.
+func (s SubscriptionStatus) Known() bool {
+	for _, k := range []SubscriptionStatus{SubscriptionStatusActive, SubscriptionStatusExpired, SubscriptionStatusCancelled, SubscriptionStatusTerminated, SubscriptionStatusPending} {
+		if s.Is(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON tolerates the status being sent as something other than a string.
+func (s *SubscriptionStatus) UnmarshalJSON(b []byte) error {
+	*s = SubscriptionStatus(tolerantString(b))
+	return nil
+}
+
+// CommitmentType represents the commitment type of an EA suite or SKU.  Values not covered by the constants
+// below are kept as received.  The CommitmentType fields of EASuite and EACommerceSKU remain strings for
+// compatibility, use their TypedCommitmentType methods to compare them against the constants.
+type CommitmentType string
+
+// Commonly seen EA commitment types.
+const (
+	CommitmentTypeFull    CommitmentType = "FULL"
+	CommitmentTypePartial CommitmentType = "PARTIAL"
+)
+
+// Is reports whether the commitment type matches other, ignoring case.
+func (t CommitmentType) Is(other CommitmentType) bool {
+	return strings.EqualFold(string(t), string(other))
+}
+
+// Known reports whether the commitment type is one of the defined constants.
+func (t CommitmentType) Known() bool {
+	return t.Is(CommitmentTypeFull) || t.Is(CommitmentTypePartial)
+}
+
+// UnmarshalJSON tolerates the commitment type being sent as something other than a string.
+func (t *CommitmentType) UnmarshalJSON(b []byte) error {
+	*t = CommitmentType(tolerantString(b))
+	return nil
+}
+
+// TypedStatus returns the Status of the subscription as a SubscriptionStatus.
+func (s EASubscription) TypedStatus() SubscriptionStatus {
+	return SubscriptionStatus(s.Status)
+}
+
+// TypedCommitmentType returns the CommitmentType of the suite as a CommitmentType.
+func (s EASuite) TypedCommitmentType() CommitmentType {
+	return CommitmentType(s.CommitmentType)
+}
+
+// TypedCommitmentType returns the CommitmentType of the SKU as a CommitmentType.
+func (s EACommerceSKU) TypedCommitmentType() CommitmentType {
+	return CommitmentType(s.CommitmentType)
+}
+
+// tolerantString returns the JSON string value, an empty string for null, or the raw JSON for any other value.
+func tolerantString(b []byte) string {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		return s
+	}
+	raw := strings.TrimSpace(string(b))
+	if raw == "null" {
+		return ""
+	}
+	return raw
+}
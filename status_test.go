@@ -0,0 +1,77 @@
+package smartaccounts
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSubscriptionStatus(t *testing.T) {
+	tests := []struct {
+		status SubscriptionStatus
+		known  bool
+		active bool
+	}{
+		{SubscriptionStatusActive, true, true},
+		{"active", true, true},
+		{SubscriptionStatusExpired, true, false},
+		{"Cancelled", true, false},
+		{"SUSPENDED", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Known(); got != tt.known {
+			t.Errorf("%q.Known() = %v, want %v", tt.status, got, tt.known)
+		}
+		if got := tt.status.Is(SubscriptionStatusActive); got != tt.active {
+			t.Errorf("%q.Is(ACTIVE) = %v, want %v", tt.status, got, tt.active)
+		}
+	}
+}
+
+func TestCommitmentType(t *testing.T) {
+	if !CommitmentType("full").Is(CommitmentTypeFull) || !CommitmentType("PARTIAL").Known() {
+		t.Error("known commitment types not matched")
+	}
+	if CommitmentType("SOMETIMES").Known() {
+		t.Error("unknown commitment type reported as known")
+	}
+}
+
+func TestTypedAccessors(t *testing.T) {
+	var sub EASubscription
+	err := json.Unmarshal([]byte(`{"status": "SUSPENDED", "accounts": [{"vitualAccounts": [{"suites": [
+		{"commitmentType": "full", "commerceSkus": [{"commitmentType": "NONE"}]}]}]}]}`), &sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status string = sub.Status
+	if status != "SUSPENDED" || sub.TypedStatus().Known() {
+		t.Errorf("got status %q, want the unknown value kept as received", status)
+	}
+	suite := sub.Accounts[0].VirtualAccounts[0].Suites[0]
+	if !suite.TypedCommitmentType().Is(CommitmentTypeFull) {
+		t.Errorf("got commitment type %q, want FULL", suite.CommitmentType)
+	}
+	if sku := suite.CommerceSkUs[0]; sku.CommitmentType != "NONE" || sku.TypedCommitmentType().Known() {
+		t.Errorf("got SKU commitment type %q, want the unknown value kept as received", sku.CommitmentType)
+	}
+}
+
+func TestTolerantUnmarshal(t *testing.T) {
+	tests := map[string]SubscriptionStatus{
+		`"ACTIVE"`: SubscriptionStatusActive,
+		`null`:     "",
+		`1`:        "1",
+		`true`:     "true",
+	}
+	for in, want := range tests {
+		var s SubscriptionStatus
+		if err := json.Unmarshal([]byte(in), &s); err != nil || s != want {
+			t.Errorf("%s: got %q, %v, want %q", in, s, err, want)
+		}
+	}
+	var ct CommitmentType
+	if err := json.Unmarshal([]byte(`2`), &ct); err != nil || ct != "2" {
+		t.Errorf("got %q, %v, want the raw value", ct, err)
+	}
+}
@@ -0,0 +1,128 @@
+package smartaccounts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// streamDecoder is implemented by decode targets that read the response body themselves.
+type streamDecoder interface {
+	decodeStream(r io.Reader) error
+}
+
+// licenseStream decodes a page of licenses one at a time, passing each to fn rather than holding the whole
+// page in memory.  The remaining fields of the response are kept.
+type licenseStream struct {
+	fn            func(License) error
+	fnErr         error
+	count         int
+	TotalRecords  int
+	StatusMessage string
+	Status        string
+}
+
+func (s *licenseStream) responseStatus() (string, string) { return s.Status, s.StatusMessage }
+
+// decodeStream reads the response object token by token, decoding each element of the licenses array in turn.
+func (s *licenseStream) decodeStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return fmt.Errorf("ccw: unexpected license response token %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		switch key {
+		case "licenses":
+			if err := s.decodeLicenses(dec); err != nil {
+				return err
+			}
+		case "totalRecords":
+			err = dec.Decode(&s.TotalRecords)
+		case "statusMessage":
+			err = dec.Decode(&s.StatusMessage)
+		case "status":
+			err = dec.Decode(&s.Status)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeLicenses decodes the licenses array, which may also be null.
+func (s *licenseStream) decodeLicenses(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("ccw: unexpected licenses token %v", tok)
+	}
+	for dec.More() {
+		var l License
+		if err := dec.Decode(&l); err != nil {
+			return err
+		}
+		s.count++
+		if s.fnErr = s.fn(l); s.fnErr != nil {
+			return s.fnErr
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// StreamLicenses retrieves the licenses for each of the virtual accounts on the provided SmartAccount, calling fn
+// for each license as it is decoded from the response.  Unlike GetSmartLicenseUsage, not even a whole page of
+// licenses is held in memory.  Any error from fn or from retrieving the licenses stops the stream and is returned.
+func (c *Client) StreamLicenses(ctx context.Context, sa SmartAccount, fn func(License) error) (err error) {
+	defer wrapOp(&err, "StreamLicenses(%s)", sa.AccountDomain)
+	ctx, cancel := c.methodContext(ctx, "StreamLicenses")
+	defer cancel()
+	if sa.VirtualAccounts == nil {
+		return fmt.Errorf("%w for %s", ErrNoVirtualAccounts, sa.AccountDomain)
+	}
+	for _, va := range *sa.VirtualAccounts {
+		var ferr error
+		err := c.pageLicenses(func(offset, limit int) (int, int, error) {
+			ls := &licenseStream{fn: fn}
+			err := c.fetchLicensesPage(ctx, sa.AccountDomain, va.Name, offset, limit, ls)
+			if ls.fnErr != nil {
+				ferr = ls.fnErr
+				return 0, 0, errStopPaging
+			}
+			if err != nil {
+				return 0, 0, err
+			}
+			return ls.count, ls.TotalRecords, nil
+		})
+		if ferr != nil {
+			return ferr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package smartaccounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// largeLicensePageJSON returns a single page of n licenses with details, as a large response would be.
+func largeLicensePageJSON(t testing.TB, n int) []byte {
+	lr := LicenseResponse{TotalRecords: n, Licenses: makeLicenses("VA1", n), Status: "SUCCESS"}
+	for i := range lr.Licenses {
+		lr.Licenses[i].LicenseDetails = []LicenseDetail{{LicenseType: "TERM", Quantity: 5, StartDate: "2024-01-01", EndDate: "2025-01-01"}}
+	}
+	b, err := json.Marshal(lr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// streamPage decodes the page with licenseStream, returning the licenses passed to the callback.
+func streamPage(page []byte) ([]License, *licenseStream, error) {
+	var got []License
+	ls := &licenseStream{fn: func(l License) error {
+		got = append(got, l)
+		return nil
+	}}
+	err := ls.decodeStream(bytes.NewReader(page))
+	return got, ls, err
+}
+
+func TestLicenseStreamMatchesBuffered(t *testing.T) {
+	page := largeLicensePageJSON(t, 250)
+	var want LicenseResponse
+	if err := decodeBody(bytes.NewReader(page), &want, false); err != nil {
+		t.Fatal(err)
+	}
+	got, ls, err := streamPage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want.Licenses) {
+		t.Error("got streamed licenses that differ from the buffered decode")
+	}
+	if ls.count != 250 || ls.TotalRecords != want.TotalRecords || ls.Status != want.Status {
+		t.Errorf("got count %d, total %d and status %q, want %d, %d and %q", ls.count, ls.TotalRecords, ls.Status, 250, want.TotalRecords, want.Status)
+	}
+}
+
+func TestLicenseStreamShapes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		body    string
+		want    []string
+		total   int
+		wantErr bool
+	}{
+		{"fields after licenses", `{"licenses": [{"license": "L1"}, {"license": "L2"}], "totalRecords": 2, "status": "SUCCESS"}`, []string{"L1", "L2"}, 2, false},
+		{"unknown fields", `{"totalRecords": 1, "extra": {"a": [1, 2]}, "licenses": [{"license": "L1", "new": true}]}`, []string{"L1"}, 1, false},
+		{"null licenses", `{"totalRecords": 0, "licenses": null}`, nil, 0, false},
+		{"empty body", ``, nil, 0, false},
+		{"not an object", `[{"license": "L1"}]`, nil, 0, true},
+		{"truncated", `{"licenses": [{"license": "L1"}, {"lic`, []string{"L1"}, 0, true},
+	} {
+		got, ls, err := streamPage([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		var names []string
+		for _, l := range got {
+			names = append(names, l.License)
+		}
+		if !reflect.DeepEqual(names, tt.want) || ls.TotalRecords != tt.total {
+			t.Errorf("%s: got %v and total %d, want %v and %d", tt.name, names, ls.TotalRecords, tt.want, tt.total)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	ls := &licenseStream{fn: func(License) error {
+		calls++
+		return stop
+	}}
+	if err := ls.decodeStream(strings.NewReader(`{"licenses": [{"license": "L1"}, {"license": "L2"}]}`)); err != stop || calls != 1 {
+		t.Errorf("got %v after %d calls, want the callback's error after 1", err, calls)
+	}
+}
+
+func TestStreamLicensesMatchesGetSmartLicenseUsage(t *testing.T) {
+	c := newTestClient(t, licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 250), "VA2": makeLicenses("VA2", 3)}))
+	sa := smartAccountWith("VA1", "VA2")
+	want, err := c.GetSmartLicenseUsage(sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []License
+	if err := c.StreamLicenses(context.Background(), sa, func(l License) error {
+		got = append(got, l)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, *want) {
+		t.Errorf("got %d streamed licenses that differ from the %d retrieved", len(got), len(*want))
+	}
+}
+
+func TestStreamLicensesPagingRules(t *testing.T) {
+	lying := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, LicenseResponse{TotalRecords: 5, Licenses: makeLicenses("VA1", 3)})
+	}
+	c := newTestClient(t, http.HandlerFunc(lying), WithValidateTotals(true))
+	err := c.StreamLicenses(context.Background(), smartAccountWith("VA1"), func(License) error { return nil })
+	if !errors.Is(err, ErrTotalMismatch) {
+		t.Errorf("got %v, want ErrTotalMismatch", err)
+	}
+
+	// the callback's error is returned as is, even one that looks like the end of the data
+	stop := fmt.Errorf("stop: %w", ErrBadRequest)
+	c = newTestClient(t, offsetLimitHandler(t, makeLicenses("VA1", 200), -1))
+	n := 0
+	err = c.StreamLicenses(context.Background(), smartAccountWith("VA1"), func(License) error {
+		if n++; n == 150 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || n != 150 {
+		t.Errorf("got %v after %d licenses, want the callback's error after 150", err, n)
+	}
+}
+
+// liveHeap returns the bytes of live heap objects after garbage collection.  Collecting twice also frees anything
+// only held by a sync.Pool.
+func liveHeap() uint64 {
+	runtime.GC()
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// The license decoding benchmarks report peak-B, the live heap while a page of licenses is being decoded, along
+// with the usual allocations.  Streaming holds a single license at a time where the buffered decode holds the page.
+
+func BenchmarkLicenseStream(b *testing.B) {
+	page := largeLicensePageJSON(b, 5000)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for i := 0; i < b.N; i++ {
+		if _, err := streamLicensePage(page, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	var peak uint64
+	base := liveHeap()
+	streamLicensePage(page, func(count int) {
+		if count == 5000 {
+			peak = liveHeap() - base
+		}
+	})
+	runtime.KeepAlive(page)
+	b.ReportMetric(float64(peak), "peak-B")
+}
+
+func BenchmarkLicenseBuffered(b *testing.B) {
+	page := largeLicensePageJSON(b, 5000)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for i := 0; i < b.N; i++ {
+		var lr LicenseResponse
+		if err := decodeBody(bytes.NewReader(page), &lr, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	base := liveHeap()
+	var lr LicenseResponse
+	decodeBody(bytes.NewReader(page), &lr, false)
+	peak := liveHeap() - base
+	runtime.KeepAlive(lr)
+	runtime.KeepAlive(page)
+	b.ReportMetric(float64(peak), "peak-B")
+}
+
+// streamLicensePage streams the page, counting the licenses without keeping them, and calling seen with the
+// count so far if it isn't nil.
+func streamLicensePage(page []byte, seen func(count int)) (int, error) {
+	ls := &licenseStream{}
+	ls.fn = func(License) error {
+		if seen != nil {
+			seen(ls.count)
+		}
+		return nil
+	}
+	err := ls.decodeStream(bytes.NewReader(page))
+	return ls.count, err
+}
@@ -1,10 +1,11 @@
 package smartaccounts
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"net/http"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // SubscriptionSearchRequest represents the request required to return subscription data.
@@ -63,23 +64,158 @@ type SubscriptionSearchAdditionalParameters struct {
 // a smart account ID and domain it will search for subscriptions.  Note you may receive duplicates
 // in the response since it is a search.
 // https://apidocs-prod.cisco.com/explore;category=6083723a25042e9035f6a753;sgroup=6091ff087b37a601010bf23c;epname=614b1bc3b39ea324506c580d
-func (c *Client) SearchSubscriptions(smartAccountID int, smartAccountDomain string) (*SubscriptionSearchResponse, error) {
-	url := "https://swapi.cisco.com/services/api/smart-accounts-and-licensing/v1/subscription/search"
-	payload, err := json.Marshal(&SubscriptionSearchRequest{
+func (c *Client) SearchSubscriptions(smartAccountID int, smartAccountDomain string) (_ *SubscriptionSearchResponse, err error) {
+	defer wrapOp(&err, "SearchSubscriptions(%d, %s)", smartAccountID, smartAccountDomain)
+	ctx, cancel := c.methodContext(context.Background(), "SearchSubscriptions")
+	defer cancel()
+	return c.searchSubscriptions(ctx, smartAccountID, smartAccountDomain)
+}
+
+func (c *Client) searchSubscriptions(ctx context.Context, smartAccountID int, smartAccountDomain string) (*SubscriptionSearchResponse, error) {
+	req, err := c.newRequest(endpointSubscriptionSearch, &SubscriptionSearchRequest{
 		Source:        "",
-		SmartAccounts: []SubscriptionSearchRequestSmartAccount{{smartAccountID, smartAccountDomain}}})
+		SmartAccounts: []SubscriptionSearchRequestSmartAccount{{smartAccountID, smartAccountDomain}}}, nil)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	var ssr SubscriptionSearchResponse
+	err = c.makeRequest(ctx, req, &ssr)
 	if err != nil {
 		return nil, err
 	}
-	var ssr SubscriptionSearchResponse
-	err = c.makeRequest(context.Background(), req, &ssr)
+	return &ssr, nil
+
+}
+
+// SearchSubscriptionsByDomain searches for the subscriptions of the smart account with the given domain, first
+// resolving the smart account ID that SearchSubscriptions requires by searching on the domain.  Only an account
+// whose domain matches exactly, ignoring case, is used.  ErrNotFound is returned if there isn't one, and
+// ErrAmbiguousAccount if there is more than one.
+func (c *Client) SearchSubscriptionsByDomain(ctx context.Context, domain string) (_ *SubscriptionSearchResponse, err error) {
+	defer wrapOp(&err, "SearchSubscriptionsByDomain(%s)", domain)
+	ctx, cancel := c.methodContext(ctx, "SearchSubscriptionsByDomain")
+	defer cancel()
+	sr, err := c.searchSmartAccountsByDomain(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
-	return &ssr, nil
+	ids := []string{}
+	var id int
+	for _, a := range sr.Accounts {
+		if strings.EqualFold(a.Domain, domain) {
+			id = a.ID
+			ids = append(ids, strconv.Itoa(a.ID))
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return nil, fmt.Errorf("%w: smart account %s", ErrNotFound, domain)
+	case 1:
+		return c.searchSubscriptions(ctx, id, domain)
+	default:
+		return nil, fmt.Errorf("%w %s: ids %s", ErrAmbiguousAccount, domain, strings.Join(ids, ", "))
+	}
+}
+
+// SubscriptionsByArchitecture returns the subscriptions that have at least one suite with the given
+// architecture, e.g. "DNA".  The comparison ignores case.
+func (r *SubscriptionSearchResponse) SubscriptionsByArchitecture(architecture string) []SubscriptionSearchSubscription {
+	subs := []SubscriptionSearchSubscription{}
+	for _, od := range r.OfferDetails {
+		for _, sub := range od.Subscriptions {
+			for _, suite := range sub.Suites {
+				if strings.EqualFold(suite.Architecture, architecture) {
+					subs = append(subs, sub)
+					break
+				}
+			}
+		}
+	}
+	return subs
+}
 
+// SuitesByArchitecture returns the suites across all subscriptions with the given architecture.  The comparison
+// ignores case.
+func (r *SubscriptionSearchResponse) SuitesByArchitecture(architecture string) []SubscriptionSearchSuite {
+	suites := []SubscriptionSearchSuite{}
+	for _, od := range r.OfferDetails {
+		for _, sub := range od.Subscriptions {
+			for _, suite := range sub.Suites {
+				if strings.EqualFold(suite.Architecture, architecture) {
+					suites = append(suites, suite)
+				}
+			}
+		}
+	}
+	return suites
+}
+
+// SuiteCatalog returns the unique suites across all subscriptions, sorted by Architecture, SuiteName and then
+// AtoName.  Suites are considered the same when all three fields match exactly.
+func (r *SubscriptionSearchResponse) SuiteCatalog() []SubscriptionSearchSuite {
+	seen := map[SubscriptionSearchSuite]bool{}
+	catalog := []SubscriptionSearchSuite{}
+	for _, od := range r.OfferDetails {
+		for _, sub := range od.Subscriptions {
+			for _, suite := range sub.Suites {
+				if seen[suite] {
+					continue
+				}
+				seen[suite] = true
+				catalog = append(catalog, suite)
+			}
+		}
+	}
+	sort.Slice(catalog, func(i, j int) bool {
+		a, b := catalog[i], catalog[j]
+		if a.Architecture != b.Architecture {
+			return a.Architecture < b.Architecture
+		}
+		if a.SuiteName != b.SuiteName {
+			return a.SuiteName < b.SuiteName
+		}
+		return a.AtoName < b.AtoName
+	})
+	return catalog
+}
+
+// SubscriptionLocation identifies where a subscription appears within a SubscriptionSearchResponse.
+type SubscriptionLocation struct {
+	OfferDetailsIndex int
+	SmartAccountID    string
+}
+
+// DuplicateSubscriptions returns the SubRefIDs that appear more than once in the response, whether within the same
+// OfferDetails entry or across several, along with each location they appear in.  Subscriptions without a
+// SubRefID are ignored.
+func (r *SubscriptionSearchResponse) DuplicateSubscriptions() map[string][]SubscriptionLocation {
+	locations := map[string][]SubscriptionLocation{}
+	for i, od := range r.OfferDetails {
+		for _, sub := range od.Subscriptions {
+			if sub.SubRefID == "" {
+				continue
+			}
+			locations[sub.SubRefID] = append(locations[sub.SubRefID], SubscriptionLocation{OfferDetailsIndex: i, SmartAccountID: od.SmartAccountID})
+		}
+	}
+	for id, locs := range locations {
+		if len(locs) < 2 {
+			delete(locations, id)
+		}
+	}
+	return locations
+}
+
+// SmartAccountIDInt returns the SmartAccountID as an int, to make correlating with the int smart account ID
+// used in the request easier.  An error is returned if the ID is empty or not numeric.
+func (od SubscriptionSearchOfferDetails) SmartAccountIDInt() (int, error) {
+	id := strings.TrimSpace(od.SmartAccountID)
+	if id == "" {
+		return 0, fmt.Errorf("ccw: empty smart account id")
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, fmt.Errorf("ccw: invalid smart account id %q", od.SmartAccountID)
+	}
+	return n, nil
 }
@@ -0,0 +1,177 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// subscriptionSearchFixture returns a response with subscriptions across several architectures.
+func subscriptionSearchFixture() *SubscriptionSearchResponse {
+	return &SubscriptionSearchResponse{OfferDetails: []SubscriptionSearchOfferDetails{
+		{SmartAccountID: "101", Subscriptions: []SubscriptionSearchSubscription{
+			{SubRefID: "Sub-1", Suites: []SubscriptionSearchSuite{
+				{SuiteName: "DNA Advantage", AtoName: "E3-DNA", Architecture: "DNA"},
+				{SuiteName: "ISE Plus", AtoName: "E3-SEC", Architecture: "Security"},
+			}},
+			{SubRefID: "Sub-2", Suites: []SubscriptionSearchSuite{
+				{SuiteName: "Webex", AtoName: "E3-COLLAB", Architecture: "Collaboration"},
+			}},
+		}},
+		{SmartAccountID: "102", Subscriptions: []SubscriptionSearchSubscription{
+			{SubRefID: "Sub-3", Suites: []SubscriptionSearchSuite{
+				{SuiteName: "DNA Essentials", AtoName: "E3-DNA", Architecture: "dna"},
+			}},
+		}},
+	}}
+}
+
+func TestSubscriptionSearchByArchitecture(t *testing.T) {
+	r := subscriptionSearchFixture()
+	ids := []string{}
+	for _, s := range r.SubscriptionsByArchitecture("DNA") {
+		ids = append(ids, s.SubRefID)
+	}
+	if want := []string{"Sub-1", "Sub-3"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+	suites := []string{}
+	for _, s := range r.SuitesByArchitecture("dna") {
+		suites = append(suites, s.SuiteName)
+	}
+	if want := []string{"DNA Advantage", "DNA Essentials"}; !reflect.DeepEqual(suites, want) {
+		t.Errorf("got %v, want %v", suites, want)
+	}
+	if got := r.SubscriptionsByArchitecture("Data Center"); got == nil || len(got) != 0 {
+		t.Errorf("got %v, want an empty slice", got)
+	}
+}
+
+func TestSmartAccountIDInt(t *testing.T) {
+	for _, v := range []string{"12345", " 12345 "} {
+		if got, err := (SubscriptionSearchOfferDetails{SmartAccountID: v}).SmartAccountIDInt(); err != nil || got != 12345 {
+			t.Errorf("%q: got %d, %v, want 12345", v, got, err)
+		}
+	}
+	for _, v := range []string{"", "  ", "abc", "12.5", "99999999999999999999"} {
+		if got, err := (SubscriptionSearchOfferDetails{SmartAccountID: v}).SmartAccountIDInt(); err == nil || got != 0 {
+			t.Errorf("%q: got %d, %v, want an error", v, got, err)
+		}
+	}
+}
+
+func TestSuiteCatalog(t *testing.T) {
+	dna := SubscriptionSearchSuite{SuiteName: "DNA Advantage", AtoName: "E3-DNA", Architecture: "DNA"}
+	ise := SubscriptionSearchSuite{SuiteName: "ISE Plus", AtoName: "E3-SEC", Architecture: "Security"}
+	r := &SubscriptionSearchResponse{OfferDetails: []SubscriptionSearchOfferDetails{
+		{Subscriptions: []SubscriptionSearchSubscription{
+			{Suites: []SubscriptionSearchSuite{ise, dna}},
+			{Suites: []SubscriptionSearchSuite{dna, {SuiteName: "DNA Advantage", AtoName: "E3-DNA-2", Architecture: "DNA"}}},
+		}},
+		{Subscriptions: []SubscriptionSearchSubscription{
+			{Suites: []SubscriptionSearchSuite{ise, {SuiteName: "DNA Advantage", AtoName: "E3-DNA", Architecture: "dna"}}},
+			{},
+		}},
+	}}
+	want := []SubscriptionSearchSuite{
+		dna,
+		{SuiteName: "DNA Advantage", AtoName: "E3-DNA-2", Architecture: "DNA"},
+		ise,
+		{SuiteName: "DNA Advantage", AtoName: "E3-DNA", Architecture: "dna"},
+	}
+	if got := r.SuiteCatalog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := (&SubscriptionSearchResponse{}).SuiteCatalog(); got == nil || len(got) != 0 {
+		t.Errorf("empty: got %v, want an empty slice", got)
+	}
+}
+
+func TestDuplicateSubscriptions(t *testing.T) {
+	subs := func(ids ...string) []SubscriptionSearchSubscription {
+		list := []SubscriptionSearchSubscription{}
+		for _, id := range ids {
+			list = append(list, SubscriptionSearchSubscription{SubRefID: id})
+		}
+		return list
+	}
+	r := &SubscriptionSearchResponse{OfferDetails: []SubscriptionSearchOfferDetails{
+		{SmartAccountID: "101", Subscriptions: subs("Sub-1", "Sub-2", "Sub-1", "")},
+		{SmartAccountID: "102", Subscriptions: subs("Sub-2", "Sub-3", "")},
+		{SmartAccountID: "101", Subscriptions: subs("Sub-2", "Sub-4")},
+	}}
+	want := map[string][]SubscriptionLocation{
+		"Sub-1": {{OfferDetailsIndex: 0, SmartAccountID: "101"}, {OfferDetailsIndex: 0, SmartAccountID: "101"}},
+		"Sub-2": {{OfferDetailsIndex: 0, SmartAccountID: "101"}, {OfferDetailsIndex: 1, SmartAccountID: "102"}, {OfferDetailsIndex: 2, SmartAccountID: "101"}},
+	}
+	if got := r.DuplicateSubscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := subscriptionSearchFixture().DuplicateSubscriptions(); len(got) != 0 {
+		t.Errorf("no duplicates: got %v, want none", got)
+	}
+}
+
+func TestSearchSubscriptionsByDomain(t *testing.T) {
+	f := &fakeCisco{subscriptions: map[int][]SubscriptionSearchSubscription{
+		1: {{SubRefID: "Sub1"}},
+		2: {{SubRefID: "Sub2"}},
+	}}
+	tests := []struct {
+		name     string
+		search   []SearchAccount
+		want     string
+		wantErr  error
+		wantText string
+	}{
+		{"single match", []SearchAccount{{Domain: "example.com", ID: 1}}, "Sub1", nil, ""},
+		{"ignores case", []SearchAccount{{Domain: "EXAMPLE.com", ID: 2}}, "Sub2", nil, ""},
+		{"ignores partial matches", []SearchAccount{{Domain: "sub.example.com", ID: 1}, {Domain: "example.com", ID: 2}}, "Sub2", nil, ""},
+		{"no match", []SearchAccount{{Domain: "example.org", ID: 1}}, "", ErrNotFound, "smart account example.com"},
+		{"ambiguous", []SearchAccount{{Domain: "example.com", ID: 1}, {Domain: "Example.com", ID: 2}}, "", ErrAmbiguousAccount, "ids 1, 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var searched, subscriptions counter
+			next := f.handler(t)
+			h := func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case endpointSearchAccounts.path:
+					searched.inc()
+					if got := r.URL.Query().Get("domain"); got != "example.com" {
+						t.Errorf("got search for %q, want example.com", got)
+					}
+					searchHandler(t, tt.search...)(w, r)
+				case endpointSubscriptionSearch.path:
+					subscriptions.inc()
+					next(w, r)
+				default:
+					next(w, r)
+				}
+			}
+			c := newTestClient(t, http.HandlerFunc(h))
+			got, err := c.SearchSubscriptionsByDomain(context.Background(), "example.com")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.wantText) || got != nil {
+					t.Errorf("got %v, %v, want %v with %q", got, err, tt.wantErr, tt.wantText)
+				}
+				if subscriptions.get() != 0 {
+					t.Errorf("got %d subscription searches, want none", subscriptions.get())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.OfferDetails) != 1 || len(got.OfferDetails[0].Subscriptions) != 1 || got.OfferDetails[0].Subscriptions[0].SubRefID != tt.want {
+				t.Errorf("got %+v, want %s", got, tt.want)
+			}
+			if searched.get() != 1 || subscriptions.get() != 1 {
+				t.Errorf("got %d account and %d subscription searches, want 1 of each", searched.get(), subscriptions.get())
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package smartaccounts
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// lookupTimeout is the default timeout for methods that make a single request.
+	lookupTimeout = 2 * time.Minute
+	// aggregateTimeout is the default timeout for methods that make many requests.
+	aggregateTimeout = 30 * time.Minute
+	// defaultCallTimeout is the timeout for calls without a method timeout when the context has no deadline.
+	defaultCallTimeout = 5 * time.Minute
+)
+
+// defaultMethodTimeouts holds the default overall timeout for each method, applied when the context passed has no
+// deadline of its own.  Methods that make a single request default to 2 minutes, whereas those that page through or
+// aggregate many requests default to 30 minutes.  Note that each individual HTTP request is also subject to the
+// HTTPClient timeout.
+var defaultMethodTimeouts = map[string]time.Duration{
+	"GetAllSmartAccounts":                                lookupTimeout,
+	"HasRoleForDomain":                                   lookupTimeout,
+	"GetVirtualAccounts":                                 lookupTimeout,
+	"SearchSmartAccountsByDomain":                        lookupTimeout,
+	"SearchSmartAccountsByName":                          lookupTimeout,
+	"SearchSubscriptions":                                lookupTimeout,
+	"SearchSubscriptionsByDomain":                        lookupTimeout,
+	"GetEASmartAccountSubscriptionConsumptionReport":     lookupTimeout,
+	"GetEASmartAccountSubscriptionConsumptionReportAsOf": lookupTimeout,
+	"GetEASmartAccountSubscriptionConsumptionReportCSV":  lookupTimeout,
+	"GetRaw":                       lookupTimeout,
+	"GetLicensesPage":              lookupTimeout,
+	"GetSmartLicenseUsage":         aggregateTimeout,
+	"GetSmartLicenseUsageSummary":  aggregateTimeout,
+	"GetSmartLicenseUsageByName":   aggregateTimeout,
+	"GetLicensesForDomain":         aggregateTimeout,
+	"GetAvailabilitySnapshot":      aggregateTimeout,
+	"GetOverconsumedLicenses":      aggregateTimeout,
+	"HydrateLicenses":              aggregateTimeout,
+	"StreamLicenses":               aggregateTimeout,
+	"WriteLicensesJSONL":           aggregateTimeout,
+	"GetVirtualAccountsForDomains": aggregateTimeout,
+	"GetEAPortfolioConsumption":    aggregateTimeout,
+	"GetEAConsumptionReports":      aggregateTimeout,
+	"GetAllSmartAccountsWith":      aggregateTimeout,
+	"GetAccountLicenseRows":        aggregateTimeout,
+	"GenerateAuditReport":          aggregateTimeout,
+	"Hydrate":                      aggregateTimeout,
+}
+
+// WithMethodTimeout sets the overall timeout for the named method, e.g. "GetSmartLicenseUsage", overriding
+// the default.  A timeout of zero removes the timeout for that method, leaving the WithDefaultCallTimeout.  Method
+// timeouts only apply when the context passed has no deadline, so a caller's deadline always takes precedence,
+// whether it is shorter or longer.
+func WithMethodTimeout(method string, d time.Duration) Option {
+	return func(c *Client) {
+		if c.methodTimeouts == nil {
+			c.methodTimeouts = map[string]time.Duration{}
+		}
+		c.methodTimeouts[method] = d
+	}
+}
+
+// methodContext returns a context with the timeout configured for the method applied, unless ctx already has a
+// deadline, in which case the caller's deadline is kept.
+func (c *Client) methodContext(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	d, ok := c.methodTimeouts[method]
+	if !ok {
+		d = defaultMethodTimeouts[method]
+	}
+	if d <= 0 {
+		d = c.defaultCallTimeout
+	}
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// WithDefaultCallTimeout sets the timeout applied to calls that have no method timeout, such as
+// LicensesIterator.Next and each poll made by PollLicenses, or a method whose timeout has been removed with
+// WithMethodTimeout, when the context passed has no deadline of its own.  A caller's deadline always takes
+// precedence.  The default is 5 minutes, and zero removes it.
+func WithDefaultCallTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= 0 {
+			c.defaultCallTimeout = d
+		}
+	}
+}
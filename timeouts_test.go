@@ -0,0 +1,126 @@
+package smartaccounts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMethodTimeouts(t *testing.T) {
+	f := &fakeCisco{
+		vas:      map[string][]VirtualAccount{"example.com": {{Name: "VA1"}, {Name: "VA2"}, {Name: "VA3"}, {Name: "VA4"}}},
+		licenses: map[string][]License{"VA1": makeLicenses("VA1", 1), "VA2": makeLicenses("VA2", 1), "VA3": makeLicenses("VA3", 1), "VA4": makeLicenses("VA4", 1)},
+	}
+	const delay = 20 * time.Millisecond
+	slow := func(d time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(d)
+			f.handler(t)(w, r)
+		}
+	}
+	// scaled down versions of the defaults: a short timeout for lookups, a long one for aggregations
+	timeouts := []Option{
+		WithConcurrency(1),
+		WithMethodTimeout("GetVirtualAccounts", 50*time.Millisecond),
+		WithMethodTimeout("GetLicensesForDomain", 5*time.Second),
+	}
+	c := newTestClient(t, slow(delay), timeouts...)
+
+	// five sequential requests take longer than the lookup timeout but not the aggregation timeout
+	start := time.Now()
+	licenses, err := c.GetLicensesForDomain(context.Background(), "example.com")
+	if err != nil || len(licenses) != 4 {
+		t.Fatalf("aggregation: got %d licenses, %v, want 4", len(licenses), err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*delay {
+		t.Fatalf("aggregation: took %s, want at least %s for the test to be meaningful", elapsed, 5*delay)
+	}
+
+	c = newTestClient(t, slow(5*delay), timeouts...)
+	if _, err := c.GetVirtualAccounts("example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lookup: got %v, want it cut off by its timeout", err)
+	}
+}
+
+func TestDefaultMethodTimeouts(t *testing.T) {
+	c := New("id", "secret", "user", "pass", WithMethodTimeout("GetRaw", time.Second), WithMethodTimeout("GetLicensesPage", 0))
+	for _, tt := range []struct {
+		method string
+		want   time.Duration
+	}{
+		{"GetVirtualAccounts", lookupTimeout},
+		{"GetLicensesForDomain", aggregateTimeout},
+		{"GetRaw", time.Second},
+		{"GetLicensesPage", defaultCallTimeout},
+		{"Unknown", defaultCallTimeout},
+	} {
+		ctx, cancel := c.methodContext(context.Background(), tt.method)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if got := time.Until(deadline); !ok || got > tt.want || got < tt.want-time.Second {
+			t.Errorf("%s: got a deadline in %s, want %s", tt.method, got, tt.want)
+		}
+	}
+
+	// a caller's deadline is kept, even when it is longer than the method timeout
+	parent, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+	for _, method := range []string{"Unknown", "GetVirtualAccounts", "GetRaw", "GetLicensesForDomain"} {
+		ctx, cancel := c.methodContext(parent, method)
+		deadline, _ := ctx.Deadline()
+		cancel()
+		if got := time.Until(deadline); got < 119*time.Minute {
+			t.Errorf("%s: got a deadline in %s, want the caller's 2 hours", method, got)
+		}
+	}
+}
+
+func TestMethodTimeoutCallerDeadline(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		searchHandler(t)(w, r)
+	}
+	c := newTestClient(t, http.HandlerFunc(h), WithMethodTimeout("SearchSmartAccountsByName", 20*time.Millisecond))
+	if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("no caller deadline: got %v, want the method timeout to apply", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.SearchSmartAccountsByName(ctx, "example"); err != nil {
+		t.Errorf("caller deadline: got %v, want the longer deadline kept", err)
+	}
+}
+
+func TestWithDefaultCallTimeout(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		licensesHandler(t, map[string][]License{"VA1": makeLicenses("VA1", 1)})(w, r)
+	}
+	next := func(c *Client, ctx context.Context) error {
+		_, err := c.NewLicensesIterator(smartAccountWith("VA1")).Next(ctx)
+		return err
+	}
+
+	c := newTestClient(t, http.HandlerFunc(slow), WithDefaultCallTimeout(20*time.Millisecond))
+	if err := next(c, context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("no caller deadline: got %v, want the default to apply", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := next(c, ctx); err != nil {
+		t.Errorf("caller deadline: got %v, want the caller's deadline to take precedence", err)
+	}
+
+	c = newTestClient(t, http.HandlerFunc(slow), WithDefaultCallTimeout(0))
+	if err := next(c, context.Background()); err != nil {
+		t.Errorf("removed: got %v, want no timeout", err)
+	}
+	ctx, cancel = c.methodContext(context.Background(), "LicensesIterator.Next")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("removed: got a deadline, want none")
+	}
+}
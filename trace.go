@@ -0,0 +1,77 @@
+package smartaccounts
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnTimings represents the connection phase timings for a single request.  Phases that didn't happen,
+// e.g. DNS and TLS on a reused connection, are left as zero.
+type ConnTimings struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration // from the start of the request to the first byte of the response
+	Reused       bool
+}
+
+// WithHTTPTrace sets a function that is called with the connection timings for each request made to Cisco,
+// which can help to tell Cisco being slow apart from local network issues.  The default is no tracing.
+func WithHTTPTrace(fn func(req *http.Request, timings ConnTimings)) Option {
+	return func(c *Client) {
+		c.onTrace = fn
+	}
+}
+
+// traceContext returns a context that records connection timings for the request, along with a function
+// to call once the response has been received to report them.
+func (c *Client) traceContext(ctx context.Context, req *http.Request) (context.Context, func()) {
+	if c.onTrace == nil {
+		return ctx, func() {}
+	}
+	// the hooks may be called from other goroutines, and ConnectStart and ConnectDone once for each address
+	// dialled, so the timings are guarded and only the first successful connection is recorded
+	var mu sync.Mutex
+	var t ConnTimings
+	var dnsStart, connStart, tlsStart time.Time
+	start := time.Now()
+	record := func(fn func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { record(func() { dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { record(func() { t.DNS = time.Since(dnsStart) }) },
+		ConnectStart: func(string, string) {
+			record(func() {
+				if connStart.IsZero() {
+					connStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			record(func() {
+				if err == nil && t.Connect == 0 {
+					t.Connect = time.Since(connStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() { record(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { record(func() { t.TLSHandshake = time.Since(tlsStart) }) },
+		GotConn:           func(info httptrace.GotConnInfo) { record(func() { t.Reused = info.Reused }) },
+		GotFirstResponseByte: func() {
+			record(func() { t.FirstByte = time.Since(start) })
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), func() {
+		mu.Lock()
+		timings := t
+		mu.Unlock()
+		c.onTrace(req, timings)
+	}
+}
@@ -0,0 +1,59 @@
+package smartaccounts
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestWithHTTPTrace(t *testing.T) {
+	var mu sync.Mutex
+	var got []ConnTimings
+	trace := WithHTTPTrace(func(req *http.Request, timings ConnTimings) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, timings)
+	})
+	c := newTestClient(t, searchHandler(t), trace)
+	for i := 0; i < 2; i++ {
+		if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 {
+		t.Fatalf("got %d callbacks, want 2", len(got))
+	}
+	if got[0].Reused || got[0].Connect <= 0 || got[0].FirstByte <= 0 {
+		t.Errorf("first request: got %+v, want a new connection with connect and first byte timings", got[0])
+	}
+	if !got[1].Reused || got[1].Connect != 0 || got[1].FirstByte <= 0 {
+		t.Errorf("second request: got %+v, want a reused connection with only a first byte timing", got[1])
+	}
+}
+
+func TestWithHTTPTraceConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	c := newTestClient(t, searchHandler(t), WithHTTPTrace(func(*http.Request, ConnTimings) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.SearchSmartAccountsByName(context.Background(), "example"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 8 {
+		t.Errorf("got %d callbacks, want 8", calls)
+	}
+}
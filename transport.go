@@ -0,0 +1,79 @@
+package smartaccounts
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// WithMinTLSVersion sets the minimum TLS version used for connections to Cisco, for both API and token requests.
+// It must be one of the tls.VersionTLS* constants, otherwise the default of TLS 1.2 is used.  It is also applied to
+// a *http.Transport set on HTTPClient by an option passed to New, but not to any other RoundTripper, nor to a
+// client or transport replaced after New.
+func WithMinTLSVersion(version uint16) Option {
+	return func(c *Client) {
+		switch version {
+		case tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+			c.minTLSVersion = version
+		}
+	}
+}
+
+// WithMaxIdleConns sets MaxIdleConns on the client's transport.  The default is Go's default.
+// As with WithMinTLSVersion, it also applies to a *http.Transport set on HTTPClient by an option.
+func WithMaxIdleConns(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.maxIdleConns = &n
+		}
+	}
+}
+
+// WithMaxIdleConnsPerHost sets MaxIdleConnsPerHost on the client's transport.  The default is Go's default.
+// As with WithMinTLSVersion, it also applies to a *http.Transport set on HTTPClient by an option.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.maxIdleConnsPerHost = &n
+		}
+	}
+}
+
+// WithIdleConnTimeout sets IdleConnTimeout on the client's transport.  The default is Go's default.
+// As with WithMinTLSVersion, it also applies to a *http.Transport set on HTTPClient by an option.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= 0 {
+			c.idleConnTimeout = &d
+		}
+	}
+}
+
+// newTransport returns a clone of the default transport configured with the minimum TLS version and any
+// connection pool options.
+func newTransport(c *Client) *http.Transport {
+	return c.configureTransport(http.DefaultTransport.(*http.Transport))
+}
+
+// configureTransport returns a clone of t with the minimum TLS version and any connection pool options applied.
+// New uses this for a *http.Transport set on HTTPClient by an option, so that the minimum still applies.  Other
+// RoundTrippers, and clients or transports replaced after New, are left as they are.
+func (c *Client) configureTransport(t *http.Transport) *http.Transport {
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if t.TLSClientConfig.MinVersion < c.minTLSVersion {
+		t.TLSClientConfig.MinVersion = c.minTLSVersion
+	}
+	if c.maxIdleConns != nil {
+		t.MaxIdleConns = *c.maxIdleConns
+	}
+	if c.maxIdleConnsPerHost != nil {
+		t.MaxIdleConnsPerHost = *c.maxIdleConnsPerHost
+	}
+	if c.idleConnTimeout != nil {
+		t.IdleConnTimeout = *c.idleConnTimeout
+	}
+	return t
+}
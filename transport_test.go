@@ -0,0 +1,109 @@
+package smartaccounts
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withTransport returns an option setting the transport of the client's HTTPClient.
+func withTransport(t http.RoundTripper) Option {
+	return func(c *Client) {
+		c.HTTPClient = &http.Client{Transport: t}
+	}
+}
+
+func minTLSVersion(t *testing.T, rt http.RoundTripper) uint16 {
+	t.Helper()
+	tr, ok := rt.(*http.Transport)
+	if !ok || tr.TLSClientConfig == nil {
+		t.Fatalf("got transport %T, want a *http.Transport with a TLS config", rt)
+	}
+	return tr.TLSClientConfig.MinVersion
+}
+
+func TestWithMinTLSVersion(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want uint16
+	}{
+		{"default", nil, tls.VersionTLS12},
+		{"TLS 1.3", []Option{WithMinTLSVersion(tls.VersionTLS13)}, tls.VersionTLS13},
+		{"invalid", []Option{WithMinTLSVersion(0x9999)}, tls.VersionTLS12},
+	} {
+		c := New("id", "secret", "user", "pass", tt.opts...)
+		if got := minTLSVersion(t, c.HTTPClient.Transport); got != tt.want {
+			t.Errorf("%s: got API minimum %x, want %x", tt.name, got, tt.want)
+		}
+		if got := minTLSVersion(t, c.tokenClient.Transport); got != tt.want {
+			t.Errorf("%s: got token minimum %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithMinTLSVersionCustomTransport(t *testing.T) {
+	custom := &http.Transport{TLSClientConfig: &tls.Config{ServerName: "cisco.example"}}
+	c := New("id", "secret", "user", "pass", withTransport(custom), WithMinTLSVersion(tls.VersionTLS13))
+	tr := c.HTTPClient.Transport.(*http.Transport)
+	if tr == custom || custom.TLSClientConfig.MinVersion != 0 {
+		t.Error("got the caller's transport modified, want a clone")
+	}
+	if tr.TLSClientConfig.MinVersion != tls.VersionTLS13 || tr.TLSClientConfig.ServerName != "cisco.example" {
+		t.Errorf("got %+v, want TLS 1.3 and the caller's settings kept", tr.TLSClientConfig)
+	}
+
+	// a higher minimum on the caller's transport is kept
+	custom = &http.Transport{TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS13}}
+	c = New("id", "secret", "user", "pass", withTransport(custom))
+	if got := minTLSVersion(t, c.HTTPClient.Transport); got != tls.VersionTLS13 {
+		t.Errorf("got %x, want the caller's TLS 1.3 kept", got)
+	}
+}
+
+func TestWithMinTLSVersionHandshake(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	// the test server's transport trusts its certificate
+	trusted := srv.Client().Transport.(*http.Transport)
+
+	c := New("id", "secret", "user", "pass", withTransport(trusted))
+	res, err := c.HTTPClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("TLS 1.2 minimum: got %v, want the handshake to succeed", err)
+	}
+	res.Body.Close()
+
+	c = New("id", "secret", "user", "pass", withTransport(trusted), WithMinTLSVersion(tls.VersionTLS13))
+	if _, err := c.HTTPClient.Get(srv.URL); err == nil {
+		t.Error("TLS 1.3 minimum: got a connection to a TLS 1.2 server, want the handshake to fail")
+	}
+}
+
+func TestConnectionPoolOptions(t *testing.T) {
+	def := http.DefaultTransport.(*http.Transport)
+	c := New("id", "secret", "user", "pass")
+	tr := c.HTTPClient.Transport.(*http.Transport)
+	if tr.MaxIdleConns != def.MaxIdleConns || tr.MaxIdleConnsPerHost != def.MaxIdleConnsPerHost || tr.IdleConnTimeout != def.IdleConnTimeout {
+		t.Errorf("default: got %d, %d, %s, want Go's defaults", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+
+	c = New("id", "secret", "user", "pass", WithMaxIdleConns(50), WithMaxIdleConnsPerHost(20), WithIdleConnTimeout(time.Minute))
+	for name, rt := range map[string]http.RoundTripper{"API": c.HTTPClient.Transport, "token": c.tokenClient.Transport} {
+		tr := rt.(*http.Transport)
+		if tr.MaxIdleConns != 50 || tr.MaxIdleConnsPerHost != 20 || tr.IdleConnTimeout != time.Minute {
+			t.Errorf("%s: got %d, %d, %s, want 50, 20, 1m0s", name, tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+		}
+	}
+
+	custom := &http.Transport{MaxIdleConns: 5, IdleConnTimeout: time.Second}
+	c = New("id", "secret", "user", "pass", withTransport(custom), WithMaxIdleConnsPerHost(20))
+	tr = c.HTTPClient.Transport.(*http.Transport)
+	if tr.MaxIdleConns != 5 || tr.MaxIdleConnsPerHost != 20 || tr.IdleConnTimeout != time.Second {
+		t.Errorf("custom transport: got %d, %d, %s, want only MaxIdleConnsPerHost changed", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+}